@@ -0,0 +1,380 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 连接被拒绝或消息被丢弃的原因，对应 aviator_ws_rejections_total 的 reason 标签
+const (
+	RejectOrigin      = "origin"      // 浏览器来源不在白名单
+	RejectBanned      = "banned"      // IP 处于临时封禁中
+	RejectIPLimit     = "ipLimit"     // 同一 IP 的连接数超限
+	RejectMessageSize = "messageSize" // 消息超过大小上限
+	RejectRateLimit   = "rateLimit"   // 消息或扩展命令超过频率限制
+)
+
+// RateLimit 令牌桶：每秒补充 Rate 个，最多积累 Burst 个
+type RateLimit struct {
+	Rate  float64 `json:"rate"`
+	Burst float64 `json:"burst"`
+}
+
+// AbuseConfig 连接级防刷设置，读取 abuse.json（可选）
+type AbuseConfig struct {
+	MaxMessageBytes  int64                `json:"maxMessageBytes"`  // 单条 websocket 消息大小上限
+	MaxConnsPerIP    int                  `json:"maxConnsPerIP"`    // 同一 IP 同时打开的连接数
+	Messages         RateLimit            `json:"messages"`         // 每个连接所有消息合计
+	Commands         map[string]RateLimit `json:"commands"`         // 每个扩展命令，按连接和按账号分别计算；"*" 为未列出命令的默认值
+	BanThreshold     int                  `json:"banThreshold"`     // 窗口内被拒绝的次数达到该值时封禁 IP
+	BanWindowSeconds int                  `json:"banWindowSeconds"` // 统计被拒绝次数的窗口
+	BanSeconds       int                  `json:"banSeconds"`       // 封禁时长
+	DemoAccounts     RateLimit            `json:"demoAccounts"`     // 每个 IP 通过不带令牌的启动链接新开试玩账号
+}
+
+func DefaultAbuseConfig() AbuseConfig {
+	return AbuseConfig{
+		MaxMessageBytes: 16 * 1024,
+		MaxConnsPerIP:   20,
+		Messages:        RateLimit{Rate: 20, Burst: 40},
+		Commands: map[string]RateLimit{
+			"*":                      {Rate: 5, Burst: 10},
+			"betHandler":             {Rate: 4, Burst: 8},
+			"cancelBetHandler":       {Rate: 4, Burst: 8},
+			"cashOutHandler":         {Rate: 4, Burst: 8},
+			"autoBetHandler":         {Rate: 1, Burst: 4},
+			"cancelAutoBetHandler":   {Rate: 1, Burst: 4},
+			"sendChatMessageHandler": {Rate: 0.5, Burst: 3},
+			"CLOCK_SYNC":             {Rate: 2, Burst: 10}, // 一次同步连续发送多个样本
+		},
+		BanThreshold:     30,
+		BanWindowSeconds: 60,
+		BanSeconds:       300,
+		DemoAccounts:     RateLimit{Rate: 1.0 / 60, Burst: 3},
+	}
+}
+
+func LoadAbuseConfig(path string) (AbuseConfig, error) {
+	config := DefaultAbuseConfig()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	// 文件中的命令覆盖同名默认值，未列出的保留
+	commands := config.Commands
+	config.Commands = nil
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parse %s: %v", path, err)
+	}
+	for cmd, limit := range config.Commands {
+		commands[cmd] = limit
+	}
+	config.Commands = commands
+
+	if config.MaxMessageBytes <= 0 || config.MaxConnsPerIP <= 0 {
+		return config, fmt.Errorf("%s: maxMessageBytes and maxConnsPerIP must be positive", path)
+	}
+	if config.BanThreshold <= 0 || config.BanWindowSeconds <= 0 || config.BanSeconds <= 0 {
+		return config, fmt.Errorf("%s: banThreshold, banWindowSeconds and banSeconds must be positive", path)
+	}
+	for cmd, limit := range config.Commands {
+		if limit.Rate <= 0 || limit.Burst < 1 {
+			return config, fmt.Errorf("%s: command %q needs rate > 0 and burst >= 1", path, cmd)
+		}
+	}
+	if config.Messages.Rate <= 0 || config.Messages.Burst < 1 {
+		return config, fmt.Errorf("%s: messages needs rate > 0 and burst >= 1", path)
+	}
+	if config.DemoAccounts.Rate <= 0 || config.DemoAccounts.Burst < 1 {
+		return config, fmt.Errorf("%s: demoAccounts needs rate > 0 and burst >= 1", path)
+	}
+	return config, nil
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take 取一个令牌，新建的桶是满的
+func (b *tokenBucket) take(limit RateLimit, now time.Time) bool {
+	if b.last.IsZero() {
+		b.tokens = limit.Burst
+	} else {
+		b.tokens = min(limit.Burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+type abuseViolations struct {
+	count int
+	since time.Time
+}
+
+// AbuseGuard 每个 IP 的连接数、每个连接和账号的令牌桶、被拒绝次数和临时封禁
+type AbuseGuard struct {
+	mutex       sync.Mutex
+	config      AbuseConfig
+	ipConns     map[string]int
+	connIPs     map[*websocket.Conn]string
+	connBuckets map[*websocket.Conn]map[string]*tokenBucket // "" 为所有消息合计
+	accBuckets  map[string]map[string]*tokenBucket
+	demoBuckets map[string]*tokenBucket // IP -> 新开试玩账号
+	violations  map[string]*abuseViolations
+	bans        map[string]time.Time // IP -> 解封时间
+}
+
+var abuse = NewAbuseGuard(DefaultAbuseConfig())
+
+func NewAbuseGuard(config AbuseConfig) *AbuseGuard {
+	g := &AbuseGuard{
+		config:      config,
+		ipConns:     make(map[string]int),
+		connIPs:     make(map[*websocket.Conn]string),
+		connBuckets: make(map[*websocket.Conn]map[string]*tokenBucket),
+		accBuckets:  make(map[string]map[string]*tokenBucket),
+		demoBuckets: make(map[string]*tokenBucket),
+		violations:  make(map[string]*abuseViolations),
+		bans:        make(map[string]time.Time),
+	}
+	go g.sweepLoop()
+	return g
+}
+
+// SetConfig 启动时读取配置文件后调用
+func (g *AbuseGuard) SetConfig(config AbuseConfig) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.config = config
+}
+
+func (g *AbuseGuard) MaxMessageBytes() int64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.config.MaxMessageBytes
+}
+
+// Admit 升级 websocket 前检查 IP，通过时占用一个连接名额，需在连接关闭后调用 Release
+func (g *AbuseGuard) Admit(ip string) (string, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if until, ok := g.bans[ip]; ok && time.Now().Before(until) {
+		return RejectBanned, false
+	}
+	if g.ipConns[ip] >= g.config.MaxConnsPerIP {
+		g.violate(ip, time.Now())
+		return RejectIPLimit, false
+	}
+	g.ipConns[ip]++
+	return "", true
+}
+
+// Attach 升级成功后记录连接所属 IP
+func (g *AbuseGuard) Attach(conn *websocket.Conn, ip string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.connIPs[conn] = ip
+	g.connBuckets[conn] = make(map[string]*tokenBucket)
+}
+
+// Release 释放 Admit 占用的名额
+func (g *AbuseGuard) Release(conn *websocket.Conn, ip string) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.ipConns[ip]--; g.ipConns[ip] <= 0 {
+		delete(g.ipConns, ip)
+	}
+	if conn != nil {
+		delete(g.connIPs, conn)
+		delete(g.connBuckets, conn)
+	}
+}
+
+// AllowMessage 每个连接所有消息合计的频率限制；IP 被封禁后同一 IP 的其他连接也不再放行
+func (g *AbuseGuard) AllowMessage(conn *websocket.Conn) (string, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := time.Now()
+	if until, ok := g.bans[g.connIPs[conn]]; ok && now.Before(until) {
+		return RejectBanned, false
+	}
+	if g.bucket(g.connBuckets[conn], "").take(g.config.Messages, now) {
+		return "", true
+	}
+	g.violate(g.connIPs[conn], now)
+	return RejectRateLimit, false
+}
+
+// AllowCommand 扩展命令的频率限制，同一连接和同一账号（跨连接）都不能超过
+func (g *AbuseGuard) AllowCommand(conn *websocket.Conn, accountId string, cmd string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	limit, ok := g.config.Commands[cmd]
+	if !ok {
+		limit = g.config.Commands["*"]
+	}
+	now := time.Now()
+	allowed := g.bucket(g.connBuckets[conn], cmd).take(limit, now)
+	if allowed && accountId != "" {
+		buckets, ok := g.accBuckets[accountId]
+		if !ok {
+			buckets = make(map[string]*tokenBucket)
+			g.accBuckets[accountId] = buckets
+		}
+		allowed = g.bucket(buckets, cmd).take(limit, now)
+	}
+	if !allowed {
+		g.violate(g.connIPs[conn], now)
+	}
+	return allowed
+}
+
+// AllowDemoAccount 不带令牌的启动链接新开试玩账号的频率限制，按 IP 计算
+func (g *AbuseGuard) AllowDemoAccount(ip string) (string, bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := time.Now()
+	if until, ok := g.bans[ip]; ok && now.Before(until) {
+		return RejectBanned, false
+	}
+	if g.bucket(g.demoBuckets, ip).take(g.config.DemoAccounts, now) {
+		return "", true
+	}
+	g.violate(ip, now)
+	return RejectRateLimit, false
+}
+
+// Violation 记录一次被拒绝，如消息过大
+func (g *AbuseGuard) Violation(conn *websocket.Conn) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	g.violate(g.connIPs[conn], time.Now())
+}
+
+// Banned 连接所属 IP 是否已被封禁
+func (g *AbuseGuard) Banned(conn *websocket.Conn) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	until, ok := g.bans[g.connIPs[conn]]
+	return ok && time.Now().Before(until)
+}
+
+// Bans 当前封禁的 IP 数
+func (g *AbuseGuard) Bans() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	now := time.Now()
+	n := 0
+	for _, until := range g.bans {
+		if now.Before(until) {
+			n++
+		}
+	}
+	return n
+}
+
+func (g *AbuseGuard) bucket(buckets map[string]*tokenBucket, key string) *tokenBucket {
+	if buckets == nil {
+		// 连接已释放，不再计数
+		return &tokenBucket{}
+	}
+	b, ok := buckets[key]
+	if !ok {
+		b = &tokenBucket{}
+		buckets[key] = b
+	}
+	return b
+}
+
+// violate 窗口内被拒绝次数达到阈值时封禁 IP，调用方需持有 g.mutex
+func (g *AbuseGuard) violate(ip string, now time.Time) {
+	if ip == "" {
+		return
+	}
+	window := time.Duration(g.config.BanWindowSeconds) * time.Second
+	v, ok := g.violations[ip]
+	if !ok || now.Sub(v.since) > window {
+		v = &abuseViolations{since: now}
+		g.violations[ip] = v
+	}
+	v.count++
+	if v.count < g.config.BanThreshold {
+		return
+	}
+	delete(g.violations, ip)
+	g.bans[ip] = now.Add(time.Duration(g.config.BanSeconds) * time.Second)
+	metricWsBans.Inc()
+	logWs.Warn("IP 临时封禁", "ip", ip, "violations", v.count, "banSeconds", g.config.BanSeconds)
+}
+
+// sweepLoop 定期清理过期的封禁、计数和空闲的账号令牌桶
+func (g *AbuseGuard) sweepLoop() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		g.mutex.Lock()
+		for ip, until := range g.bans {
+			if now.After(until) {
+				delete(g.bans, ip)
+			}
+		}
+		window := time.Duration(g.config.BanWindowSeconds) * time.Second
+		for ip, v := range g.violations {
+			if now.Sub(v.since) > window {
+				delete(g.violations, ip)
+			}
+		}
+		for accountId, buckets := range g.accBuckets {
+			idle := true
+			for _, b := range buckets {
+				if now.Sub(b.last) < time.Minute {
+					idle = false
+					break
+				}
+			}
+			if idle {
+				delete(g.accBuckets, accountId)
+			}
+		}
+		for ip, b := range g.demoBuckets {
+			// 桶已补满
+			if now.Sub(b.last).Seconds()*g.config.DemoAccounts.Rate >= g.config.DemoAccounts.Burst {
+				delete(g.demoBuckets, ip)
+			}
+		}
+		g.mutex.Unlock()
+	}
+}
+
+// rejectWs 统计一次拒绝；连接所属 IP 已被封禁时通知客户端并断开
+func rejectWs(conn *websocket.Conn, reason string) {
+	metricWsRejections.Inc(reason)
+	logWs.Debug("拒绝消息", "conn", connId(conn), "reason", reason)
+	if abuse.Banned(conn) {
+		WritePacketAndClose(conn, BuildSFSMessage(SFSEventDisconnection, 0, map[string]interface{}{
+			"dr": byte(SFSDisconnectBan),
+		}), nil)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 新开试玩账号的起始编号
+const firstUserId = 100000
+
+// Account 玩家账号，启动链接和登录令牌都指向一个账号
+type Account struct {
+	UserId    int    `json:"userId"`
+	UserName  string `json:"userName"`
+	Operator  string `json:"operator"`
+	Currency  string `json:"currency"`
+	TimeZone  string `json:"timeZone"`
+	Lvl       int    `json:"lvl"`
+	Status    int    `json:"userStatus"`
+	IsDemo    bool   `json:"isDemo"`
+	CreatedAt int64  `json:"createdAt"` // 毫秒时间戳
+}
+
+// AccountId 游戏内的账号，格式与钱包、排行榜一致："33687&&demo"
+func (u *Account) AccountId() string {
+	return fmt.Sprintf("%d&&%s", u.UserId, u.Operator)
+}
+
+// Uid 前端显示的账号 "demo000428@XX"
+func (u *Account) Uid() string {
+	return fmt.Sprintf("%s%s@%s", u.Operator, u.UserName, u.Currency)
+}
+
+// ErrDemoAccountLimit 试玩账号数量已达上限
+var ErrDemoAccountLimit = errors.New("demo account limit reached")
+
+// AccountStore 账号存储，新建账号追加写入 data/accounts.jsonl 并立即落盘；
+// 旧版本整体保存的 data/accounts.json 启动时一并读取，不再写入
+type AccountStore struct {
+	mutex    sync.Mutex
+	file     *os.File
+	nextId   int
+	demos    int
+	accounts map[int]*Account
+}
+
+var accounts = NewAccountStore()
+
+// NewAccountStore 只保存在内存中
+func NewAccountStore() *AccountStore {
+	return &AccountStore{
+		nextId:   firstUserId,
+		accounts: make(map[int]*Account),
+	}
+}
+
+func OpenAccountStore() (*AccountStore, error) {
+	if err := os.MkdirAll(DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	s := NewAccountStore()
+
+	legacy := filepath.Join(DataDir, "accounts.json")
+	data, err := os.ReadFile(legacy)
+	if err == nil {
+		list := make([]*Account, 0)
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("parse %s: %v", legacy, err)
+		}
+		for _, user := range list {
+			s.add(user)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	path := filepath.Join(DataDir, "accounts.jsonl")
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var user Account
+			if err := json.Unmarshal(scanner.Bytes(), &user); err != nil {
+				// 写到一半崩溃的最后一行
+				logStore.Warn("跳过损坏的账号", "path", path, "err", err)
+				continue
+			}
+			s.add(&user)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	return s, nil
+}
+
+func (s *AccountStore) add(user *Account) {
+	if _, ok := s.accounts[user.UserId]; !ok && user.IsDemo {
+		s.demos++
+	}
+	s.accounts[user.UserId] = user
+	s.nextId = max(s.nextId, user.UserId+1)
+}
+
+// Get 返回账号的副本
+func (s *AccountStore) Get(userId int) (Account, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, ok := s.accounts[userId]
+	if !ok {
+		return Account{}, false
+	}
+	return *user, true
+}
+
+// CreateDemo 新开一个试玩账号，落盘后才生效；试玩账号达到 limit 个时返回 ErrDemoAccountLimit，limit 为0表示不限
+func (s *AccountStore) CreateDemo(operator string, currency string, timeZone string, limit int) (Account, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if limit > 0 && s.demos >= limit {
+		return Account{}, ErrDemoAccountLimit
+	}
+	user := &Account{
+		UserId:    s.nextId,
+		UserName:  fmt.Sprintf("%06d", s.nextId),
+		Operator:  operator,
+		Currency:  currency,
+		TimeZone:  timeZone,
+		IsDemo:    true,
+		CreatedAt: time.Now().UnixMilli(),
+	}
+	if err := s.append(user); err != nil {
+		logStore.Error("账号写入失败", "err", err)
+		return Account{}, err
+	}
+	s.add(user)
+	return *user, nil
+}
+
+// append 追加一行并落盘
+func (s *AccountStore) append(user *Account) error {
+	if s.file == nil {
+		return nil
+	}
+	data, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *AccountStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const adminTokenMinLength = 16
+
+// AdminOperators 运营后台操作人及其令牌，读取 admin_operators.json（可选），格式为 {"操作人": "令牌"}。
+// 没有配置时运营后台拒绝所有请求
+type AdminOperators struct {
+	tokens map[string]string // 令牌 -> 操作人
+}
+
+var adminOperators = &AdminOperators{tokens: map[string]string{}}
+
+func LoadAdminOperators(path string) (*AdminOperators, error) {
+	operators := &AdminOperators{tokens: map[string]string{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return operators, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var byName map[string]string
+	if err := json.Unmarshal(data, &byName); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	for name, token := range byName {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("%s: operator name must not be empty", path)
+		}
+		if len(token) < adminTokenMinLength {
+			return nil, fmt.Errorf("%s: token of %q must be at least %d characters", path, name, adminTokenMinLength)
+		}
+		if other, ok := operators.tokens[token]; ok {
+			return nil, fmt.Errorf("%s: %q and %q share a token", path, other, name)
+		}
+		operators.tokens[token] = name
+	}
+	return operators, nil
+}
+
+func (o *AdminOperators) Len() int {
+	return len(o.tokens)
+}
+
+// Lookup 令牌对应的操作人；逐个比较所有令牌，耗时与令牌内容无关
+func (o *AdminOperators) Lookup(token string) (string, bool) {
+	operator := ""
+	for known, name := range o.tokens {
+		if subtle.ConstantTimeCompare([]byte(known), []byte(token)) == 1 {
+			operator = name
+		}
+	}
+	return operator, operator != ""
+}
+
+// adminOperatorKey gin 上下文中保存已鉴权操作人的键
+const adminOperatorKey = "adminOperator"
+
+// adminAuth 运营后台鉴权，每个操作人一个令牌，见 AdminOperators。
+// 令牌放在 X-Admin-Token 头中，也可以用 Authorization: Bearer（供 Prometheus 抓取）
+func adminAuth(c *gin.Context) {
+	got := c.GetHeader("X-Admin-Token")
+	if got == "" {
+		got = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	operator, ok := adminOperators.Lookup(got)
+	if got == "" || !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
+	c.Set(adminOperatorKey, operator)
+	c.Next()
+}
+
+type GrantFreeBetsRequest struct {
+	AccountId     string  `json:"accountId"`
+	Amount        Money   `json:"amount"`
+	Count         int     `json:"count"`
+	ExpiresAt     int64   `json:"expiresAt"` // 毫秒时间戳，0 表示不过期
+	MinMultiplier float64 `json:"minMultiplier"`
+}
+
+func adminListFreeBets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": freeBets.List(c.Query("accountId"))})
+}
+
+func adminGrantFreeBets(c *gin.Context) {
+	var req GrantFreeBetsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format", "detail": err.Error()})
+		return
+	}
+
+	voucher, err := freeBets.Grant(req.AccountId, req.Amount, req.Count, req.ExpiresAt, req.MinMultiplier)
+	audit(c, "grantFreeBets", req.AccountId, req, err)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	notifyFreeBets(req.AccountId)
+	c.JSON(http.StatusOK, gin.H{"data": voucher})
+}
+
+func adminRevokeFreeBet(c *gin.Context) {
+	voucher, err := freeBets.Revoke(c.Param("id"))
+	if err != nil {
+		audit(c, "revokeFreeBet", c.Param("id"), nil, err)
+		status := http.StatusNotFound
+		if errors.Is(err, ErrFreeBetReserved) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	audit(c, "revokeFreeBet", c.Param("id"), nil, nil)
+	notifyFreeBets(voucher.AccountId)
+	c.JSON(http.StatusOK, gin.H{"data": voucher})
+}
+
+// notifyFreeBets 玩家在线时推送最新的免费下注
+func notifyFreeBets(accountId string) {
+	for _, room := range rooms.Rooms() {
+		g := room.g
+		g.mutex.Lock()
+		if player := g.FindPlayer(accountId); player != nil {
+			g.S2cActiveFreeBetsInfo(player)
+		}
+		g.mutex.Unlock()
+	}
+}
+
+type ChatRestrictionRequest struct {
+	AccountId  string `json:"accountId"`
+	Kind       string `json:"kind"`       // mute 或 ban
+	DurationMs int64  `json:"durationMs"` // 0 表示永久
+	Reason     string `json:"reason"`
+}
+
+func adminListChatRestrictions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": chatModeration.List()})
+}
+
+func adminRestrictChat(c *gin.Context) {
+	var req ChatRestrictionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format", "detail": err.Error()})
+		return
+	}
+
+	restriction, err := chatModeration.Restrict(req.AccountId, req.Kind, req.DurationMs, req.Reason)
+	audit(c, "restrictChat", req.AccountId, req, err)
+	if err != nil {
+		// 返回了限制说明参数有效、只是写盘失败
+		status := http.StatusBadRequest
+		if restriction != nil {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	// 封禁时删除该账号在所有房间的聊天消息
+	if restriction.Kind == ChatRestrictionBan {
+		for _, room := range rooms.Rooms() {
+			room.g.mutex.Lock()
+			room.g.RemoveChatMessages(restriction.AccountId)
+			room.g.mutex.Unlock()
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": restriction})
+}
+
+func adminLiftChatRestriction(c *gin.Context) {
+	restriction, ok := chatModeration.Lift(c.Param("accountId"))
+	if !ok {
+		audit(c, "liftChatRestriction", c.Param("accountId"), nil, errors.New("restriction not found"))
+		c.JSON(http.StatusNotFound, gin.H{"error": "restriction not found"})
+		return
+	}
+	audit(c, "liftChatRestriction", c.Param("accountId"), nil, nil)
+	c.JSON(http.StatusOK, gin.H{"data": restriction})
+}
+
+type PromoRainRequest struct {
+	RoomId     int    `json:"roomId"`
+	Currency   string `json:"currency"` // 为空时使用房间币种或主币种
+	Amount     Money  `json:"amount"`
+	NumOfUsers int    `json:"numOfUsers"`
+}
+
+// adminPromoRain 运营方发起的红包雨，不扣任何玩家的余额
+func adminPromoRain(c *gin.Context) {
+	var req PromoRainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format", "detail": err.Error()})
+		return
+	}
+	if !chatSettings.IsEnabled || !chatSettings.Promo.IsEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "promo rain is disabled"})
+		return
+	}
+	room := rooms.Room(req.RoomId)
+	if room == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+		return
+	}
+	if req.Currency == "" {
+		req.Currency = room.Currency
+	}
+	if req.Currency == "" {
+		req.Currency = MainCurrency()
+	}
+	if req.NumOfUsers == 0 {
+		req.NumOfUsers = chatSettings.Rain.DefaultNumOfUsers
+	}
+
+	room.g.mutex.Lock()
+	msg, reason := room.g.StartRain(nil, req.Amount, req.Currency, req.NumOfUsers)
+	room.g.mutex.Unlock()
+	if msg == nil {
+		audit(c, "promoRain", fmt.Sprint(req.RoomId), req, errors.New(reason))
+		c.JSON(http.StatusBadRequest, gin.H{"error": reason})
+		return
+	}
+	audit(c, "promoRain", fmt.Sprint(req.RoomId), req, nil)
+	c.JSON(http.StatusOK, gin.H{"data": msg})
+}
+
+// adminRoom 路径参数 :id 对应的房间，不存在时返回404
+func adminRoom(c *gin.Context) *GameRoom {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err == nil {
+		if room := rooms.Room(id); room != nil {
+			return room
+		}
+	}
+	c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+	return nil
+}
+
+func roomState(room *GameRoom) RoomState {
+	room.g.mutex.Lock()
+	defer room.g.mutex.Unlock()
+
+	state := room.g.AdminState()
+	state.Name = room.Name
+	return state
+}
+
+func adminListRooms(c *gin.Context) {
+	list := make([]RoomState, 0)
+	for _, room := range rooms.Rooms() {
+		list = append(list, roomState(room))
+	}
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func adminGetRoom(c *gin.Context) {
+	room := adminRoom(c)
+	if room == nil {
+		return
+	}
+	// 概况和下注在同一次加锁中读取，保证来自同一局
+	room.g.mutex.Lock()
+	state := room.g.AdminState()
+	state.Name = room.Name
+	bets := room.g.AdminOpenBets()
+	room.g.mutex.Unlock()
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"state": state, "bets": bets}})
+}
+
+func adminListPlayers(c *gin.Context) {
+	room := adminRoom(c)
+	if room == nil {
+		return
+	}
+	room.g.mutex.Lock()
+	players := room.g.AdminPlayers()
+	room.g.mutex.Unlock()
+	c.JSON(http.StatusOK, gin.H{"data": players})
+}
+
+func adminKickPlayer(c *gin.Context) {
+	room := adminRoom(c)
+	if room == nil {
+		return
+	}
+	accountId := c.Param("accountId")
+	if !rooms.Kick(room, accountId) {
+		audit(c, "kickPlayer", fmt.Sprintf("%d/%s", room.Id, accountId), nil, errors.New("player not connected"))
+		c.JSON(http.StatusNotFound, gin.H{"error": "player not connected"})
+		return
+	}
+	audit(c, "kickPlayer", fmt.Sprintf("%d/%s", room.Id, accountId), nil, nil)
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"accountId": accountId}})
+}
+
+func adminPauseRoom(c *gin.Context) {
+	room := adminRoom(c)
+	if room == nil {
+		return
+	}
+	room.g.mutex.Lock()
+	err := room.g.Pause()
+	room.g.mutex.Unlock()
+	audit(c, "pauseRoom", fmt.Sprint(room.Id), nil, err)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": roomState(room)})
+}
+
+func adminResumeRoom(c *gin.Context) {
+	room := adminRoom(c)
+	if room == nil {
+		return
+	}
+	room.g.mutex.Lock()
+	err := room.g.Resume()
+	room.g.mutex.Unlock()
+	audit(c, "resumeRoom", fmt.Sprint(room.Id), nil, err)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": roomState(room)})
+}
+
+type LimitsRequest struct {
+	MinBet     Money `json:"minBet"`
+	MaxBet     Money `json:"maxBet"`
+	MaxUserWin Money `json:"maxUserWin"` // 仅币种限额，0 表示不修改
+}
+
+func adminSetRoomLimits(c *gin.Context) {
+	room := adminRoom(c)
+	if room == nil {
+		return
+	}
+	var req LimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format", "detail": err.Error()})
+		return
+	}
+
+	room.g.mutex.Lock()
+	err := room.g.SetLimits(req.MinBet, req.MaxBet)
+	room.g.mutex.Unlock()
+	audit(c, "setRoomLimits", fmt.Sprint(room.Id), req, err)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rooms.SetRoomVariables(room, []RoomVariable{
+		{Name: "minBet", Type: VarTypeDouble, Value: req.MinBet, IsPersistent: true},
+		{Name: "maxBet", Type: VarTypeDouble, Value: req.MaxBet, IsPersistent: true},
+	}, true)
+	c.JSON(http.StatusOK, gin.H{"data": roomState(room)})
+}
+
+func adminSetCurrencyLimits(c *gin.Context) {
+	var req LimitsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format", "detail": err.Error()})
+		return
+	}
+
+	info, err := currencies.SetLimits(c.Param("code"), req.MinBet, req.MaxBet, req.MaxUserWin)
+	audit(c, "setCurrencyLimits", c.Param("code"), req, err)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": info})
+}
+
+type VoidRoundRequest struct {
+	Reason        string `json:"reason"`
+	CashOutPolicy string `json:"cashOutPolicy"` // keep 或 reverse，为空时使用默认策略
+}
+
+func adminVoidRound(c *gin.Context) {
+	room := adminRoom(c)
+	if room == nil {
+		return
+	}
+	var req VoidRoundRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+
+	room.g.mutex.Lock()
+	result, err := room.g.VoidRound(req.Reason, req.CashOutPolicy)
+	room.g.mutex.Unlock()
+	audit(c, "voidRound", fmt.Sprintf("%d/%d", room.Id, result.RoundId), req, err)
+	if errors.Is(err, ErrVoidIncomplete) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+func adminAuditLog(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > auditKeep {
+		limit = 100
+	}
+	c.JSON(http.StatusOK, gin.H{"data": auditLog.Recent(limit, c.Query("action"))})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoadAdminOperators(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", `{"alice": "0123456789abcdef", "bob": "fedcba9876543210"}`, false},
+		{"short token", `{"alice": "short"}`, true},
+		{"shared token", `{"alice": "0123456789abcdef", "bob": "0123456789abcdef"}`, true},
+		{"empty name", `{" ": "0123456789abcdef"}`, true},
+		{"invalid json", `[`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "admin_operators.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadAdminOperators(path); (err != nil) != tt.wantErr {
+				t.Errorf("LoadAdminOperators() err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	operators, err := LoadAdminOperators(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || operators.Len() != 0 {
+		t.Errorf("missing file: operators = %d, err = %v", operators.Len(), err)
+	}
+}
+
+func TestAdminAuthRecordsOperator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := adminOperators
+	defer func() { adminOperators = saved }()
+	adminOperators = &AdminOperators{tokens: map[string]string{
+		"0123456789abcdef": "alice",
+		"fedcba9876543210": "bob",
+	}}
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+		wantActor  string
+	}{
+		{"alice", "X-Admin-Token", "0123456789abcdef", http.StatusOK, "alice"},
+		{"bob via bearer", "Authorization", "Bearer fedcba9876543210", http.StatusOK, "bob"},
+		{"unknown token", "X-Admin-Token", "0000000000000000", http.StatusUnauthorized, ""},
+		{"no token", "", "", http.StatusUnauthorized, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", adminAuth, func(c *gin.Context) {
+				c.String(http.StatusOK, adminActor(c))
+			})
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			// 请求头中自称的操作人不被采用
+			req.Header.Set("X-Admin-User", "mallory")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusOK && w.Body.String() != tt.wantActor {
+				t.Errorf("actor = %q, want %q", w.Body.String(), tt.wantActor)
+			}
+		})
+	}
+}
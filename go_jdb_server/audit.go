@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const auditKeep = 1000 // 内存中保留的审计记录条数
+
+// AuditEntry 一次运营后台操作
+type AuditEntry struct {
+	Time   int64       `json:"time"` // 毫秒时间戳
+	Actor  string      `json:"actor"`
+	Remote string      `json:"remote"`
+	Action string      `json:"action"`
+	Target string      `json:"target"`
+	Params interface{} `json:"params,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// AuditLog 运营操作审计日志，追加写入 data/audit.jsonl，只追加不删除
+type AuditLog struct {
+	mutex   sync.Mutex
+	file    *os.File
+	entries []AuditEntry
+}
+
+var auditLog *AuditLog = nil
+
+func OpenAuditLog() (*AuditLog, error) {
+	if err := os.MkdirAll(DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(DataDir, "audit.jsonl")
+	l := &AuditLog{
+		entries: make([]AuditEntry, 0, auditKeep),
+	}
+
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var entry AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				continue
+			}
+			l.keep(entry)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	l.file = file
+	return l, nil
+}
+
+func (l *AuditLog) keep(entry AuditEntry) {
+	if len(l.entries) >= auditKeep {
+		l.entries = append(l.entries[:0], l.entries[1:]...)
+	}
+	l.entries = append(l.entries, entry)
+}
+
+// Append 记录一次操作，写盘失败只打印日志
+func (l *AuditLog) Append(entry AuditEntry) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.keep(entry)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logAdmin.Error("审计记录序列化失败", "err", err)
+		return
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		logAdmin.Error("审计记录写入失败", "err", err)
+	}
+}
+
+func (l *AuditLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.file.Close()
+}
+
+// Recent 最近的 n 条记录，最新的在前，action 不为空时只返回该操作
+func (l *AuditLog) Recent(n int, action string) []AuditEntry {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	list := make([]AuditEntry, 0, n)
+	for i := len(l.entries) - 1; i >= 0 && len(list) < n; i-- {
+		if action != "" && l.entries[i].Action != action {
+			continue
+		}
+		list = append(list, l.entries[i])
+	}
+	return list
+}
+
+// audit 记录运营后台的一次操作，操作人为鉴权通过的令牌对应的操作人
+func audit(c *gin.Context, action string, target string, params interface{}, err error) {
+	entry := AuditEntry{
+		Time:   time.Now().UnixMilli(),
+		Actor:  adminActor(c),
+		Remote: c.ClientIP(),
+		Action: action,
+		Target: target,
+		Params: params,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	auditLog.Append(entry)
+}
+
+// adminActor 操作人，取自 adminAuth 鉴权通过的令牌
+func adminActor(c *gin.Context) string {
+	return c.GetString(adminOperatorKey)
+}
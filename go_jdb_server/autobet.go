@@ -0,0 +1,198 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 自动下注可选局数，与下发给客户端的 autoBetOptions.numberOfRounds 一致
+var AutoBetRoundOptions = []int{10, 20, 50, 100}
+
+// 自动下注停止原因
+const (
+	AutoBetStopCompleted    = "completed"
+	AutoBetStopCancelled    = "cancelled"
+	AutoBetStopDecrease     = "balanceDecreased"
+	AutoBetStopSingleWin    = "singleWinExceeded"
+	AutoBetStopNoBalance    = "insufficientBalance"
+	AutoBetStopBetRejected  = "betRejected"
+	AutoBetStopDisconnected = "disconnected"
+)
+
+const (
+	autoBetMaxSlots          = 2
+	autoBetStopPointRequired = true             // 对应 autoBetOptions.decreaseOrExceedStopPointReq
+	autoBetOfflineGrace      = 30 * time.Second // 断线超过该时间后停止自动下注
+)
+
+// AutoBetPlan 服务端自动下注计划，每个下注阶段由游戏循环代为下注
+type AutoBetPlan struct {
+	AccountId        string
+	Bets             []AutoBetSlot
+	NumberOfRounds   int
+	RoundsPlayed     int
+	DecreaseBy       Money
+	SingleWinExceeds Money
+	StartBalance     Money // 计划开始时的钱包余额；钱包由所有房间共用，停止条件和余额变化都以钱包为准
+	betRoundId       int   // 最近一次代为下注的局号
+}
+
+func (g *AviatorGameContext) C2sAutoBet(conn *websocket.Conn, req *AutoBetRequest) {
+	playerInfo := g.players[conn.RemoteAddr().String()]
+	if playerInfo == nil {
+		return
+	}
+
+	if !slices.Contains(AutoBetRoundOptions, req.NumberOfRounds) {
+		return
+	}
+	if autoBetStopPointRequired && req.DecreaseBy <= 0 && req.SingleWinExceeds <= 0 {
+		return
+	}
+	if len(req.Bets) == 0 || len(req.Bets) > autoBetMaxSlots {
+		return
+	}
+	for idx, slot := range req.Bets {
+		if slot.BetID <= 0 || slot.BetID > autoBetMaxSlots || slot.Bet <= 0 {
+			return
+		}
+		for _, other := range req.Bets[:idx] {
+			if other.BetID == slot.BetID {
+				return
+			}
+		}
+	}
+
+	plan := &AutoBetPlan{
+		AccountId:        playerInfo.AccountId,
+		Bets:             append([]AutoBetSlot{}, req.Bets...),
+		NumberOfRounds:   req.NumberOfRounds,
+		DecreaseBy:       req.DecreaseBy,
+		SingleWinExceeds: req.SingleWinExceeds,
+		StartBalance:     wallets.Balance(playerInfo.AccountId),
+	}
+	g.autoBets[playerInfo.AccountId] = plan
+	playerInfo.AutoBet = true
+
+	// 下注阶段注册的计划本局立即生效
+	if g.CurStage == EAviatorStageBet {
+		g.placeAutoBet(playerInfo, plan)
+	}
+	g.S2cAutoBetProgress(playerInfo, plan, "")
+}
+
+func (g *AviatorGameContext) C2sCancelAutoBet(conn *websocket.Conn) {
+	playerInfo := g.players[conn.RemoteAddr().String()]
+	if playerInfo == nil {
+		return
+	}
+
+	plan := g.autoBets[playerInfo.AccountId]
+	if plan == nil {
+		return
+	}
+	g.StopAutoBet(playerInfo, plan, AutoBetStopCancelled)
+}
+
+// PlaceAutoBets 进入下注阶段时为所有自动下注计划下注；
+// 断线的玩家在宽限期内继续下注，超过宽限期后停止计划
+func (g *AviatorGameContext) PlaceAutoBets() {
+	now := time.Now()
+	for _, player := range g.players {
+		plan := g.autoBets[player.AccountId]
+		if plan == nil {
+			continue
+		}
+		if player.IsOffline && now.Sub(player.offlineAt) > autoBetOfflineGrace {
+			g.StopAutoBet(player, plan, AutoBetStopDisconnected)
+			continue
+		}
+		g.placeAutoBet(player, plan)
+	}
+}
+
+func (g *AviatorGameContext) placeAutoBet(playerInfo *AviatorPlayerInfo, plan *AutoBetPlan) {
+	if plan.betRoundId == g.RecordId {
+		return
+	}
+
+	total := Money(0)
+	for _, slot := range plan.Bets {
+		total += slot.Bet
+	}
+	// 下注时仍会再次占用校验
+	if total > wallets.Balance(playerInfo.AccountId) {
+		g.StopAutoBet(playerInfo, plan, AutoBetStopNoBalance)
+		return
+	}
+
+	for _, slot := range plan.Bets {
+		// 玩家已手动下注的位置本局跳过
+		if g.Id2Bet(int32(slot.BetID), playerInfo) != nil {
+			continue
+		}
+		ok := g.PlaceBet(playerInfo, &BetRequest{
+			Bet:         slot.Bet,
+			BetID:       slot.BetID,
+			AutoCashOut: slot.AutoCashOut,
+		})
+		if !ok {
+			g.StopAutoBet(playerInfo, plan, AutoBetStopBetRejected)
+			return
+		}
+	}
+	plan.betRoundId = g.RecordId
+}
+
+// SettleAutoBets 结算时累计局数并检查停止条件，需在清空下注之前调用
+func (g *AviatorGameContext) SettleAutoBets() {
+	for _, player := range g.players {
+		plan := g.autoBets[player.AccountId]
+		if plan == nil || plan.betRoundId != g.RecordId {
+			continue
+		}
+		plan.RoundsPlayed++
+
+		maxWin := Money(0)
+		for _, bet := range player.BetList {
+			if bet.hasCashOut && bet.CashOut > maxWin {
+				maxWin = bet.CashOut
+			}
+		}
+
+		switch {
+		case plan.SingleWinExceeds > 0 && maxWin > plan.SingleWinExceeds:
+			g.StopAutoBet(player, plan, AutoBetStopSingleWin)
+		case plan.DecreaseBy > 0 && plan.StartBalance-wallets.Balance(player.AccountId) >= plan.DecreaseBy:
+			g.StopAutoBet(player, plan, AutoBetStopDecrease)
+		case plan.RoundsPlayed >= plan.NumberOfRounds:
+			g.StopAutoBet(player, plan, AutoBetStopCompleted)
+		default:
+			g.S2cAutoBetProgress(player, plan, "")
+		}
+	}
+}
+
+func (g *AviatorGameContext) StopAutoBet(playerInfo *AviatorPlayerInfo, plan *AutoBetPlan, reason string) {
+	delete(g.autoBets, plan.AccountId)
+	playerInfo.AutoBet = false
+	g.S2cAutoBetProgress(playerInfo, plan, reason)
+}
+
+func (g *AviatorGameContext) S2cAutoBetProgress(playerInfo *AviatorPlayerInfo, plan *AutoBetPlan, stopReason string) {
+	ntf := &AutoBetProgress{
+		Code:           200,
+		IsActive:       stopReason == "",
+		Bets:           plan.Bets,
+		NumberOfRounds: plan.NumberOfRounds,
+		RoundsPlayed:   plan.RoundsPlayed,
+		RoundsLeft:     plan.NumberOfRounds - plan.RoundsPlayed,
+		BalanceChange:  wallets.Balance(playerInfo.AccountId) - plan.StartBalance,
+		StopReason:     stopReason,
+	}
+
+	result, _ := StructToMap(ntf)
+	g.SendToClient(playerInfo, "autoBetProgress", result)
+}
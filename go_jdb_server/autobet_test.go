@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+// newAutoBetTestPlayer 在线玩家及其每局在位置1下注 bet 的自动下注计划
+func newAutoBetTestPlayer(g *AviatorGameContext, bet int64, decreaseBy int64) (*AviatorPlayerInfo, *AutoBetPlan) {
+	const account = "1&&demo"
+	player := &AviatorPlayerInfo{AccountId: account, Currency: MainCurrency(), BetList: make([]*PlayerBetSt, 0)}
+	player.Balance = wallets.Balance(account)
+	g.players["p1"] = player
+	plan := &AutoBetPlan{
+		AccountId:      account,
+		Bets:           []AutoBetSlot{{BetID: 1, Bet: MoneyFromInt(bet)}},
+		NumberOfRounds: 10,
+		DecreaseBy:     MoneyFromInt(decreaseBy),
+		StartBalance:   player.Balance,
+	}
+	g.autoBets[account] = plan
+	player.AutoBet = true
+	return player, plan
+}
+
+// playAutoBetRound 新的一局：下注阶段代为下注，未兑现即爆炸，结算后清空下注
+func playAutoBetRound(g *AviatorGameContext, player *AviatorPlayerInfo) {
+	g.RecordId++
+	g.CurStage = EAviatorStageBet
+	g.PlaceAutoBets()
+	g.CurStage = EAviatorStageCashOut
+	g.SettleAutoBets()
+	player.BetList = player.BetList[:0]
+}
+
+func TestAutoBetStopsWithoutBalance(t *testing.T) {
+	g := newVoidTestRoom(t)
+	player, _ := newAutoBetTestPlayer(g, 10, 100)
+	// 钱包由所有房间共用，另一个房间已把余额用到只剩5
+	wallets.Apply("", 0, player.AccountId, MoneyFromInt(5)-DemoStartBalance)
+
+	playAutoBetRound(g, player)
+	if g.autoBets[player.AccountId] != nil || player.AutoBet {
+		t.Error("auto bet still active without enough balance")
+	}
+	if len(g.CurrentBets) != 0 {
+		t.Errorf("bets placed = %d, want 0", len(g.CurrentBets))
+	}
+	if got := wallets.Balance(player.AccountId); got != MoneyFromInt(5) {
+		t.Errorf("balance = %s, want 5", got)
+	}
+}
+
+func TestAutoBetStopsAtStopLoss(t *testing.T) {
+	g := newVoidTestRoom(t)
+	player, plan := newAutoBetTestPlayer(g, 10, 20)
+
+	playAutoBetRound(g, player)
+	if g.autoBets[player.AccountId] == nil {
+		t.Fatal("auto bet stopped after losing 10 of a 20 stop loss")
+	}
+	playAutoBetRound(g, player)
+	if g.autoBets[player.AccountId] != nil || player.AutoBet {
+		t.Fatal("auto bet still active after reaching the stop loss")
+	}
+	if plan.RoundsPlayed != 2 {
+		t.Errorf("rounds played = %d, want 2", plan.RoundsPlayed)
+	}
+
+	// 计划停止后不再代为下注
+	playAutoBetRound(g, player)
+	if got, want := wallets.Balance(player.AccountId), DemoStartBalance-MoneyFromInt(20); got != want {
+		t.Errorf("balance = %s, want %s", got, want)
+	}
+}
+
+func TestAutoBetStopLossCountsOtherRooms(t *testing.T) {
+	g := newVoidTestRoom(t)
+	player, _ := newAutoBetTestPlayer(g, 10, 30)
+
+	// 同一账号在另一个房间输掉25，本房间的玩家余额没有变化
+	playAutoBetRound(g, player)
+	wallets.Apply("2", 1, player.AccountId, -MoneyFromInt(25))
+	if g.autoBets[player.AccountId] == nil {
+		t.Fatal("auto bet stopped before the stop loss")
+	}
+
+	// 本房间再输10，钱包合计减少45，超过止损
+	playAutoBetRound(g, player)
+	if g.autoBets[player.AccountId] != nil || player.AutoBet {
+		t.Errorf("auto bet still active after the wallet dropped %s", DemoStartBalance-wallets.Balance(player.AccountId))
+	}
+}
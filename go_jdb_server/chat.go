@@ -0,0 +1,493 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+// 聊天被拒绝的原因
+const (
+	ChatRejectDisabled     = "chatDisabled"
+	ChatRejectMuted        = "muted"
+	ChatRejectBanned       = "banned"
+	ChatRejectTooFast      = "tooFast"
+	ChatRejectEmpty        = "empty"
+	ChatRejectTooLong      = "tooLong"
+	ChatRejectGifsDisabled = "gifsDisabled"
+)
+
+// 禁言/封禁
+const (
+	ChatRestrictionMute = "mute" // 可以看聊天，不能发言
+	ChatRestrictionBan  = "ban"  // 不能发言，历史消息被删除，不再下发聊天历史
+)
+
+const chatMaxGifLength = 512
+
+// ChatSettings 聊天配置，chat.json 中的 chat 字段原样下发给客户端
+type ChatSettings struct {
+	Chat
+	Profanity []string `json:"profanity"` // 屏蔽词，不区分大小写；空格分词的文字整词匹配，中文、日文、泰文等按子串匹配
+}
+
+func DefaultChatSettings() ChatSettings {
+	return ChatSettings{
+		Chat: Chat{
+			Promo: ChatPromo{IsEnabled: true},
+			Rain: ChatRain{
+				IsEnabled:         true,
+				RainMinBet:        MoneyFromInt(1),
+				DefaultNumOfUsers: 5,
+				MinNumOfUsers:     3,
+				MaxNumOfUsers:     10,
+				RainMaxBet:        MoneyFromInt(100),
+			},
+			IsGifsEnabled:    true,
+			SendMessageDelay: 5000,
+			IsEnabled:        true,
+			MaxMessages:      70,
+			MaxMessageLength: 160,
+		},
+	}
+}
+
+var chatSettings = DefaultChatSettings()
+var chatFilter = NewProfanityFilter(nil)
+
+// LoadChatSettings 读取聊天配置，文件不存在时使用默认配置
+func LoadChatSettings(path string) (ChatSettings, error) {
+	settings := DefaultChatSettings()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if settings.MaxMessages <= 0 || settings.MaxMessageLength <= 0 || settings.SendMessageDelay < 0 {
+		return settings, fmt.Errorf("%s: invalid chat limits", path)
+	}
+	return settings, nil
+}
+
+// ProfanityFilter 屏蔽词过滤，命中的词替换为等长的 *
+type ProfanityFilter struct {
+	re *regexp.Regexp
+}
+
+func NewProfanityFilter(words []string) *ProfanityFilter {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		word = strings.TrimSpace(word)
+		if word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return &ProfanityFilter{}
+	}
+	// 长词优先，避免被其前缀截断。\b 只识别 ASCII，词边界在 Clean 中按 Unicode 判断
+	sort.Slice(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return &ProfanityFilter{re: regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`)}
+}
+
+func (f *ProfanityFilter) Clean(message string) string {
+	if f.re == nil {
+		return message
+	}
+	var out strings.Builder
+	last, pos := 0, 0
+	for pos < len(message) {
+		loc := f.re.FindStringIndex(message[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if !atWordBoundary(message, start, end) {
+			// 是其他词的一部分，从下一个字符继续查找
+			_, size := utf8.DecodeRuneInString(message[start:])
+			pos = start + size
+			continue
+		}
+		out.WriteString(message[last:start])
+		out.WriteString(strings.Repeat("*", utf8.RuneCountInString(message[start:end])))
+		last, pos = end, end
+	}
+	out.WriteString(message[last:])
+	return out.String()
+}
+
+// atWordBoundary 命中的 message[start:end] 前后不与其他字母或数字相连；
+// 不用空格分词的文字不检查该侧的边界
+func atWordBoundary(message string, start int, end int) bool {
+	first, _ := utf8.DecodeRuneInString(message[start:end])
+	if !isUnspacedScript(first) && start > 0 {
+		before, _ := utf8.DecodeLastRuneInString(message[:start])
+		if isWordRune(before) {
+			return false
+		}
+	}
+	lastRune, _ := utf8.DecodeLastRuneInString(message[start:end])
+	if !isUnspacedScript(lastRune) && end < len(message) {
+		after, _ := utf8.DecodeRuneInString(message[end:])
+		if isWordRune(after) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || r == '_'
+}
+
+// isUnspacedScript 词与词之间不用空格分隔的文字
+func isUnspacedScript(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar)
+}
+
+// ChatRestriction 运营方对账号的禁言或封禁
+type ChatRestriction struct {
+	AccountId string `json:"accountId"`
+	Kind      string `json:"kind"`
+	Reason    string `json:"reason"`
+	Until     int64  `json:"until"` // 毫秒时间戳，0 表示永久
+	CreatedAt int64  `json:"createdAt"`
+}
+
+func (r *ChatRestriction) IsActive(now int64) bool {
+	return r.Until == 0 || r.Until > now
+}
+
+// ChatModeration 禁言/封禁名单，所有房间共用；每次变动立即写盘，重启后仍然生效
+type ChatModeration struct {
+	mutex        sync.Mutex
+	path         string
+	restrictions map[string]*ChatRestriction
+}
+
+var chatModeration = NewChatModeration("")
+
+// NewChatModeration path 为空时只保存在内存中
+func NewChatModeration(path string) *ChatModeration {
+	return &ChatModeration{
+		path:         path,
+		restrictions: make(map[string]*ChatRestriction),
+	}
+}
+
+func OpenChatModeration() (*ChatModeration, error) {
+	if err := os.MkdirAll(DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	m := NewChatModeration(filepath.Join(DataDir, "chat_restrictions.json"))
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.restrictions); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", m.path, err)
+	}
+	return m, nil
+}
+
+// save 写临时文件并落盘后改名，断电后已返回成功的禁言和封禁不会丢失；写盘失败打印日志并返回错误
+func (m *ChatModeration) save() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(m.restrictions)
+	if err != nil {
+		logStore.Error("禁言名单序列化失败", "err", err)
+		return err
+	}
+	if err := writeFileSync(m.path, data); err != nil {
+		logStore.Error("禁言名单写入失败", "path", m.path, "err", err)
+		return err
+	}
+	return nil
+}
+
+// Restrict 禁言或封禁账号，durationMs 为0表示永久；同一账号只保留最新的一条
+func (m *ChatModeration) Restrict(accountId string, kind string, durationMs int64, reason string) (*ChatRestriction, error) {
+	if accountId == "" {
+		return nil, fmt.Errorf("accountId is required")
+	}
+	if kind != ChatRestrictionMute && kind != ChatRestrictionBan {
+		return nil, fmt.Errorf("kind must be %q or %q", ChatRestrictionMute, ChatRestrictionBan)
+	}
+	if durationMs < 0 {
+		return nil, fmt.Errorf("durationMs must not be negative")
+	}
+
+	now := time.Now().UnixMilli()
+	restriction := &ChatRestriction{
+		AccountId: accountId,
+		Kind:      kind,
+		Reason:    reason,
+		CreatedAt: now,
+	}
+	if durationMs > 0 {
+		restriction.Until = now + durationMs
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.restrictions[accountId] = restriction
+	// 写盘失败时限制仍然生效，但重启后会丢失，返回错误让运营后台重试
+	if err := m.save(); err != nil {
+		return restriction, fmt.Errorf("restriction is active but not saved: %v", err)
+	}
+	return restriction, nil
+}
+
+func (m *ChatModeration) Lift(accountId string) (*ChatRestriction, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	restriction, ok := m.restrictions[accountId]
+	if ok {
+		delete(m.restrictions, accountId)
+		m.save()
+	}
+	return restriction, ok
+}
+
+// Check 账号当前生效的限制，没有时返回nil
+func (m *ChatModeration) Check(accountId string) *ChatRestriction {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	restriction := m.restrictions[accountId]
+	if restriction == nil {
+		return nil
+	}
+	if !restriction.IsActive(time.Now().UnixMilli()) {
+		delete(m.restrictions, accountId)
+		m.save()
+		return nil
+	}
+	return restriction
+}
+
+func (m *ChatModeration) List() []ChatRestriction {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	now := time.Now().UnixMilli()
+	list := make([]ChatRestriction, 0, len(m.restrictions))
+	expired := false
+	for accountId, restriction := range m.restrictions {
+		if !restriction.IsActive(now) {
+			delete(m.restrictions, accountId)
+			expired = true
+			continue
+		}
+		list = append(list, *restriction)
+	}
+	if expired {
+		m.save()
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt < list[j].CreatedAt })
+	return list
+}
+
+// ChatRoom 房间的聊天记录，由游戏上下文的锁保护
+type ChatRoom struct {
+	nextId     int64
+	messages   []*ChatMessage
+	lastSent   map[string]int64 // 玩家上次发言时间，用于发言间隔限制
+	lastActive map[string]int64 // 玩家上次下注或发言时间，用于红包雨选人
+	rains      []*ChatMessage   // 未过期的红包雨
+}
+
+func NewChatRoom() *ChatRoom {
+	return &ChatRoom{
+		lastSent:   make(map[string]int64),
+		lastActive: make(map[string]int64),
+	}
+}
+
+// AddChatMessage 记录并广播一条聊天消息，超过 MaxMessages 的旧消息被丢弃
+func (g *AviatorGameContext) AddChatMessage(msg *ChatMessage) {
+	// 红包雨写流水前已分配 ID
+	if msg.ID == 0 {
+		g.chat.nextId++
+		msg.ID = g.chat.nextId
+	}
+	msg.CreatedAt = time.Now().UnixMilli()
+	g.chat.messages = append(g.chat.messages, msg)
+	if over := len(g.chat.messages) - chatSettings.MaxMessages; over > 0 {
+		g.chat.messages = g.chat.messages[over:]
+	}
+
+	result, _ := StructToMap(msg)
+	g.SendToAllClients("chatMessage", result)
+}
+
+func (g *AviatorGameContext) FindChatMessage(id int64) *ChatMessage {
+	for _, msg := range g.chat.messages {
+		if msg.ID == id {
+			return msg
+		}
+	}
+	return nil
+}
+
+func (g *AviatorGameContext) C2sSendChatMessage(conn *websocket.Conn, req *ChatSendRequest) {
+	playerInfo := g.players[conn.RemoteAddr().String()]
+	if playerInfo == nil {
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	reject := func(reason string, retryAfter int64) {
+		result, _ := StructToMap(&ChatSendResponse{Code: 400, Reason: reason, RetryAfter: retryAfter})
+		g.SendToClient(playerInfo, "sendChatMessage", result)
+	}
+
+	if !chatSettings.IsEnabled {
+		reject(ChatRejectDisabled, 0)
+		return
+	}
+	if restriction := chatModeration.Check(playerInfo.AccountId); restriction != nil {
+		if restriction.Kind == ChatRestrictionBan {
+			reject(ChatRejectBanned, 0)
+		} else {
+			reject(ChatRejectMuted, 0)
+		}
+		return
+	}
+	if last, ok := g.chat.lastSent[playerInfo.AccountId]; ok {
+		if wait := last + int64(chatSettings.SendMessageDelay) - now; wait > 0 {
+			reject(ChatRejectTooFast, wait)
+			return
+		}
+	}
+
+	message := strings.TrimSpace(req.Message)
+	gif := strings.TrimSpace(req.Gif)
+	if gif != "" {
+		if !chatSettings.IsGifsEnabled {
+			reject(ChatRejectGifsDisabled, 0)
+			return
+		}
+		if !strings.HasPrefix(gif, "https://") || len(gif) > chatMaxGifLength {
+			reject(ChatRejectEmpty, 0)
+			return
+		}
+	}
+	if message == "" && gif == "" {
+		reject(ChatRejectEmpty, 0)
+		return
+	}
+	if utf8.RuneCountInString(message) > chatSettings.MaxMessageLength {
+		reject(ChatRejectTooLong, 0)
+		return
+	}
+
+	g.chat.lastSent[playerInfo.AccountId] = now
+	g.TouchActivity(playerInfo.AccountId)
+	result, _ := StructToMap(&ChatSendResponse{Code: 200})
+	g.SendToClient(playerInfo, "sendChatMessage", result)
+
+	g.AddChatMessage(&ChatMessage{
+		Type:         "message",
+		PlayerID:     playerInfo.AccountId,
+		Username:     playerInfo.Nickname,
+		ProfileImage: playerInfo.ProfileImage,
+		Message:      chatFilter.Clean(message),
+		Gif:          gif,
+	})
+}
+
+// C2sLikeChatMessage 点赞，每个账号对同一条消息只计一次，再次点赞取消
+func (g *AviatorGameContext) C2sLikeChatMessage(conn *websocket.Conn, req *ChatLikeRequest) {
+	playerInfo := g.players[conn.RemoteAddr().String()]
+	if playerInfo == nil || !chatSettings.IsEnabled {
+		return
+	}
+	if restriction := chatModeration.Check(playerInfo.AccountId); restriction != nil && restriction.Kind == ChatRestrictionBan {
+		return
+	}
+
+	msg := g.FindChatMessage(req.ID)
+	if msg == nil {
+		return
+	}
+	if idx := slices.Index(msg.LikedBy, playerInfo.AccountId); idx >= 0 {
+		msg.LikedBy = append(msg.LikedBy[:idx], msg.LikedBy[idx+1:]...)
+	} else {
+		msg.LikedBy = append(msg.LikedBy, playerInfo.AccountId)
+	}
+	msg.Likes = len(msg.LikedBy)
+
+	result, _ := StructToMap(&ChatLikes{Code: 200, ID: msg.ID, Likes: msg.Likes})
+	g.SendToAllClients("chatMessageLikes", result)
+}
+
+func (g *AviatorGameContext) C2sChatHistory(conn *websocket.Conn) {
+	playerInfo := g.players[conn.RemoteAddr().String()]
+	if playerInfo == nil {
+		return
+	}
+	g.S2cChatHistory(playerInfo)
+}
+
+// S2cChatHistory 下发房间聊天历史，进入房间时调用
+func (g *AviatorGameContext) S2cChatHistory(player *AviatorPlayerInfo) {
+	if !chatSettings.IsEnabled {
+		return
+	}
+	if restriction := chatModeration.Check(player.AccountId); restriction != nil && restriction.Kind == ChatRestrictionBan {
+		return
+	}
+
+	history := &ChatHistory{
+		Code:     200,
+		Messages: make([]ChatMessage, 0, len(g.chat.messages)),
+	}
+	for _, msg := range g.chat.messages {
+		history.Messages = append(history.Messages, *msg)
+	}
+	result, _ := StructToMap(history)
+	g.SendToClient(player, "chatHistory", result)
+}
+
+// RemoveChatMessages 删除账号的所有聊天消息并通知房间
+func (g *AviatorGameContext) RemoveChatMessages(accountId string) {
+	ids := make([]int64, 0)
+	kept := g.chat.messages[:0]
+	for _, msg := range g.chat.messages {
+		if msg.PlayerID == accountId {
+			ids = append(ids, msg.ID)
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	g.chat.messages = kept
+	if len(ids) == 0 {
+		return
+	}
+
+	result, _ := StructToMap(&ChatMessagesRemoved{Code: 200, IDs: ids})
+	g.SendToAllClients("chatMessagesRemoved", result)
+}
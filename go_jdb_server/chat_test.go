@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestProfanityFilter(t *testing.T) {
+	filter := NewProfanityFilter([]string{"idiot", "ass", "傻逼", "كلب", "ばか", "a.b"})
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"whole word", "you idiot!", "you *****!"},
+		{"case insensitive", "IDIOT", "*****"},
+		{"inside a word", "classic assets", "classic assets"},
+		{"digits are part of the word", "idiot1", "idiot1"},
+		{"chinese alone", "傻逼", "**"},
+		{"chinese inside a sentence", "你傻逼", "你**"},
+		{"chinese next to latin", "ok傻逼ok", "ok**ok"},
+		{"japanese", "おまえはばかだ", "おまえは**だ"},
+		{"arabic word", "يا كلب!", "يا ***!"},
+		{"arabic inside a word", "كلبة", "كلبة"},
+		{"metacharacters are literal", "a.b axb", "*** axb"},
+		{"several matches", "idiot ass idiot", "***** *** *****"},
+		{"later match after a rejected one", "assassin ass", "assassin ***"},
+		{"no match", "hello", "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Clean(tt.in); got != tt.want {
+				t.Errorf("Clean(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfanityFilterEmpty(t *testing.T) {
+	filter := NewProfanityFilter([]string{" ", ""})
+	if got := filter.Clean("anything 傻逼"); got != "anything 傻逼" {
+		t.Errorf("Clean() = %q, want unchanged", got)
+	}
+}
+
+func TestChatModerationPersists(t *testing.T) {
+	defer func(dir string) { DataDir = dir }(DataDir)
+	DataDir = t.TempDir()
+
+	m, err := OpenChatModeration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Restrict("1&&demo", ChatRestrictionBan, 0, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Restrict("2&&demo", ChatRestrictionMute, 60000, ""); err != nil {
+		t.Fatal(err)
+	}
+	m.Lift("2&&demo")
+
+	reopened, err := OpenChatModeration()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := reopened.Check("1&&demo"); r == nil || r.Kind != ChatRestrictionBan {
+		t.Errorf("ban not restored after reopen: %+v", r)
+	}
+	if r := reopened.Check("2&&demo"); r != nil {
+		t.Errorf("lifted mute restored after reopen: %+v", r)
+	}
+}
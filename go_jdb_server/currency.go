@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrNoFxRate 币种没有汇率，不能折算为主币种
+var ErrNoFxRate = errors.New("no fx rate")
+
+// CurrencyInfo 币种的精度、下注限额和下注选项
+type CurrencyInfo struct {
+	Code            string  `json:"code"`
+	Precision       int     `json:"precision"` // 金额小数位数，对应 betPrecision
+	MinBet          Money   `json:"minBet"`
+	MaxBet          Money   `json:"maxBet"`
+	DefaultBetValue Money   `json:"defaultBetValue"`
+	BetOptions      []Money `json:"betOptions"`
+	MaxUserWin      Money   `json:"maxUserWin"` // 单注最高赢额，达到时强制兑现；0 表示不限
+}
+
+var DefaultCurrencyInfos = []CurrencyInfo{
+	{
+		Code: "MAD", Precision: 2,
+		MinBet: MoneyFromInt(1), MaxBet: MoneyFromInt(1000), DefaultBetValue: MoneyFromInt(1),
+		BetOptions: []Money{MoneyFromInt(10), MoneyFromInt(20), MoneyFromInt(50), MoneyFromInt(100)},
+		MaxUserWin: MoneyFromInt(100000),
+	},
+}
+
+// CurrencyRegistry 所有支持的币种，所有房间共用
+type CurrencyRegistry struct {
+	mutex sync.RWMutex
+	infos map[string]CurrencyInfo
+}
+
+var currencies = NewCurrencyRegistry(DefaultCurrencyInfos)
+
+func NewCurrencyRegistry(infos []CurrencyInfo) *CurrencyRegistry {
+	r := &CurrencyRegistry{
+		infos: make(map[string]CurrencyInfo),
+	}
+	for _, info := range infos {
+		r.infos[info.Code] = info
+	}
+	return r
+}
+
+// LoadCurrencies 读取币种配置，文件不存在时使用默认配置
+func LoadCurrencies(path string) (*CurrencyRegistry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewCurrencyRegistry(DefaultCurrencyInfos), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var infos []CurrencyInfo
+	if err := json.Unmarshal(data, &infos); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	for _, info := range infos {
+		if info.Code == "" || info.Precision < 0 || info.Precision > 8 {
+			return nil, fmt.Errorf("%s: invalid currency %+v", path, info)
+		}
+		if info.MinBet <= 0 || info.MaxBet < info.MinBet {
+			return nil, fmt.Errorf("%s: invalid bet limits for %s", path, info.Code)
+		}
+	}
+	return NewCurrencyRegistry(infos), nil
+}
+
+func (r *CurrencyRegistry) Supported(code string) bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	_, ok := r.infos[code]
+	return ok
+}
+
+// Get 币种配置，未配置的币种使用主币种（或内置默认币种）的限额
+func (r *CurrencyRegistry) Get(code string) CurrencyInfo {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	if info, ok := r.infos[code]; ok {
+		return info
+	}
+	info, ok := r.infos[MainCurrency()]
+	if !ok {
+		info = DefaultCurrencyInfos[0]
+	}
+	info.Code = code
+	return info
+}
+
+// SetLimits 修改币种的下注限额，maxUserWin 为0时不修改；未配置的币种以主币种配置为基础新增
+func (r *CurrencyRegistry) SetLimits(code string, minBet Money, maxBet Money, maxUserWin Money) (CurrencyInfo, error) {
+	if code == "" || minBet <= 0 || maxBet < minBet || maxUserWin < 0 {
+		return CurrencyInfo{}, fmt.Errorf("invalid bet limits")
+	}
+	if !r.Supported(code) {
+		if _, err := ToMainCurrency(0, code); err != nil {
+			return CurrencyInfo{}, err
+		}
+	}
+	info := r.Get(code)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	info.MinBet = minBet
+	info.MaxBet = maxBet
+	if maxUserWin > 0 {
+		info.MaxUserWin = maxUserWin
+	}
+	r.infos[code] = info
+	return info, nil
+}
+
+func (r *CurrencyRegistry) Precision(code string) int {
+	return r.Get(code).Precision
+}
+
+// RoundAmount 按币种精度四舍五入，用于下注金额
+func RoundAmount(amount Money, currency string) Money {
+	return amount.Round(currencies.Precision(currency))
+}
+
+// FloorAmount 按币种精度向下取整，用于赔付金额
+func FloorAmount(amount Money, currency string) Money {
+	return amount.Floor(currencies.Precision(currency))
+}
+
+// PayoutAmount 下注金额乘以倍数，按币种精度向下取整
+func PayoutAmount(bet Money, multiplier float64, currency string) Money {
+	return bet.MulMultiplier(multiplier, currencies.Precision(currency))
+}
+
+// CheckFxRates 每个支持的币种都需要汇率，启动时检查
+func (r *CurrencyRegistry) CheckFxRates() error {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	for code := range r.infos {
+		if _, err := ToMainCurrency(0, code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ToMainCurrency 金额折算为主币种，汇率缺失时返回 ErrNoFxRate
+func ToMainCurrency(amount Money, currency string) (Money, error) {
+	main := MainCurrency()
+	if currency == "" || currency == main {
+		return amount, nil
+	}
+	rate, ok := FxRates().Rate(currency)
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrNoFxRate, currency)
+	}
+	return amount.MulRate(rate, currencies.Precision(main)), nil
+}
+
+// mainCurrencyAmount 报表和风控汇总用的主币种金额；汇率缺失时记录错误并不计入
+func mainCurrencyAmount(amount Money, currency string) Money {
+	main, err := ToMainCurrency(amount, currency)
+	if err != nil {
+		logMain.Error("金额无法折算为主币种", "amount", amount, "currency", currency, "err", err)
+		return 0
+	}
+	return main
+}
@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestMaxUserWin(t *testing.T) {
+	g := newVoidTestRoom(t)
+	defer func(r *CurrencyRegistry) { currencies = r }(currencies)
+	info := currencies.Get(MainCurrency())
+	info.MaxUserWin = MoneyFromInt(50)
+	currencies = NewCurrencyRegistry([]CurrencyInfo{info})
+
+	const account = "1&&demo"
+	player := &AviatorPlayerInfo{AccountId: account, Currency: MainCurrency(), BetList: make([]*PlayerBetSt, 0)}
+	player.Balance = wallets.Balance(account)
+	g.players["p1"] = player
+	g.CurStage = EAviatorStageBet
+	for _, betId := range []int{1, 2} {
+		if !g.PlaceBet(player, &BetRequest{Bet: MoneyFromInt(10), BetID: betId}) {
+			t.Fatalf("bet %d rejected", betId)
+		}
+	}
+
+	// 手动兑现按最高赢额封顶
+	g.CurStage = EAviatorStageCashOut
+	g.CurMultiplier = 7
+	if !g.CashOut(player, &CashOutRequest{BetID: 2}) {
+		t.Fatal("cash out rejected")
+	}
+	if got := g.Id2Bet(2, player).CashOut; got != MoneyFromInt(50) {
+		t.Errorf("manual cash out = %s, want 50", got)
+	}
+
+	// 没有设置自动兑现的下注在达到最高赢额的倍数时被强制兑现
+	g.AutoCashOut()
+	bet := g.Id2Bet(1, player)
+	if !bet.hasCashOut || bet.CashOut != MoneyFromInt(50) || bet.cashOutMultiplier != 5 {
+		t.Errorf("forced cash out: hasCashOut = %v CashOut = %s multiplier = %v, want true, 50, 5", bet.hasCashOut, bet.CashOut, bet.cashOutMultiplier)
+	}
+	if got, want := wallets.Balance(account), DemoStartBalance+MoneyFromInt(80); got != want {
+		t.Errorf("balance = %s, want %s", got, want)
+	}
+}
+
+func TestMaxWinMultiplier(t *testing.T) {
+	defer func(r *CurrencyRegistry) { currencies = r }(currencies)
+	info := currencies.Get(MainCurrency())
+	info.MaxUserWin = MoneyFromInt(100)
+	currencies = NewCurrencyRegistry([]CurrencyInfo{info})
+
+	tests := []struct {
+		name string
+		bet  PlayerBetSt
+		want float64
+	}{
+		{"exact", PlayerBetSt{BetValue: MoneyFromInt(10)}, 10},
+		{"rounded up", PlayerBetSt{BetValue: MoneyFromInt(3)}, 33.34},
+		{"free bet pays profit only", PlayerBetSt{BetValue: MoneyFromInt(10), isFreeBet: true}, 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.bet.MaxWinMultiplier(MainCurrency()); got != tt.want {
+				t.Errorf("MaxWinMultiplier() = %v, want %v", got, tt.want)
+			}
+			if got := tt.bet.WinAmount(tt.want, MainCurrency()); got != MoneyFromInt(100) {
+				t.Errorf("WinAmount(%v) = %s, want 100", tt.want, got)
+			}
+		})
+	}
+}
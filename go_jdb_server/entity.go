@@ -3,7 +3,7 @@ package main
 type CashOut struct {
 	Code       int     `json:"code"`
 	PlayerID   string  `json:"player_id"`
-	WinAmount  float64 `json:"winAmount"`
+	WinAmount  Money   `json:"winAmount"`
 	Multiplier float64 `json:"multiplier"`
 	BetID      int     `json:"betId"`
 	Currency   string  `json:"currency"`
@@ -15,7 +15,7 @@ type UpdateCurrentCashOuts struct {
 	Code                   int       `json:"code"`
 	CashOuts               []CashOut `json:"cashouts"`
 	ActivePlayersCount     int       `json:"activePlayersCount"`
-	TotalCashOut           float64   `json:"totalCashOut"`
+	TotalCashOut           Money     `json:"totalCashOut"`
 	TopPlayerProfileImages []string  `json:"topPlayerProfileImages"`
 }
 
@@ -25,19 +25,60 @@ type OnlinePlayers struct {
 	OnlinePlayers int `json:"onlinePlayers"`
 }
 
-// ChangeState represents the state change response
+// ChangeState represents the state change response.
+// All times are server epoch milliseconds; TimeLeft is omitted for stages
+// with no fixed length, such as the flight.
 type ChangeState struct {
 	NewStateID      int   `json:"newStateId"`
 	Code            int   `json:"code"`
 	RoundID         int64 `json:"roundId,omitempty"`
 	BetStateEndTime int64 `json:"betStateEndTime,omitempty"`
-	ServerTime      int64 `json:"serverTime,omitempty"`
+	StateStartTime  int64 `json:"stateStartTime"`
+	ServerTime      int64 `json:"serverTime"`
 	TimeLeft        int64 `json:"timeLeft,omitempty"`
 }
 
+// RoundSnapshot represents the full state of the current round. Clients can
+// apply it at any time (login, reconnect, after missed messages) instead of
+// replaying the incremental updates. Times are server epoch milliseconds.
+type RoundSnapshot struct {
+	Code               int       `json:"code"`
+	RoundID            int       `json:"roundId"`
+	StageID            int       `json:"stageId"`
+	StateStartTime     int64     `json:"stateStartTime"`
+	ServerTime         int64     `json:"serverTime"`
+	Elapsed            int64     `json:"elapsed"`            // time spent in the current stage, excluding pauses
+	TimeLeft           int64     `json:"timeLeft,omitempty"` // omitted for the flight and while paused
+	Paused             bool      `json:"paused"`
+	Multiplier         float64   `json:"currentMultiplier"`
+	BetsCount          int       `json:"betsCount"`
+	OpenBetsCount      int       `json:"openBetsCount"`
+	TotalCashOut       Money     `json:"totalCashOut"`
+	ActivePlayersCount int       `json:"activePlayersCount"`
+	Bets               []Bet     `json:"bets"`
+	CashOuts           []CashOut `json:"cashouts"`
+	ActiveBets         []Bet     `json:"activeBets"` // the receiving player's bets in this round
+}
+
+// ClockSyncRequest represents one clock sync sample sent by the client
+type ClockSyncRequest struct {
+	Seq        int   `json:"seq"`
+	ClientTime int64 `json:"t0"` // client send time
+}
+
+// ClockSyncResponse represents the server side of a clock sync sample.
+// With t3 the client receive time: offset = ((t1-t0)+(t2-t3))/2, rtt = (t3-t0)-(t2-t1)
+type ClockSyncResponse struct {
+	Code        int   `json:"code"`
+	Seq         int   `json:"seq"`
+	ClientTime  int64 `json:"t0"`
+	ReceiveTime int64 `json:"t1"` // server receive time
+	SendTime    int64 `json:"t2"` // server send time
+}
+
 // BetRequest represents the bet request
 type BetRequest struct {
-	Bet         float64 `json:"bet"`
+	Bet         Money   `json:"bet"`
 	ClientSeed  string  `json:"clientSeed"`
 	BetID       int     `json:"betId"`
 	FreeBet     bool    `json:"freeBet"`
@@ -56,19 +97,19 @@ type CancelBetResponse struct {
 
 // BetResponse represents the bet response
 type BetResponse struct {
-	Bet          float64 `json:"bet"`
-	Code         int     `json:"code"`
-	PlayerID     string  `json:"player_id"`
-	FreeBet      bool    `json:"freeBet"`
-	BetID        int     `json:"betId"`
-	ProfileImage string  `json:"profileImage"`
-	Username     string  `json:"username"`
+	Bet          Money  `json:"bet"`
+	Code         int    `json:"code"`
+	PlayerID     string `json:"player_id"`
+	FreeBet      bool   `json:"freeBet"`
+	BetID        int    `json:"betId"`
+	ProfileImage string `json:"profileImage"`
+	Username     string `json:"username"`
 }
 
 // NewBalance represents the new balance response
 type NewBalance struct {
-	Code       int     `json:"code"`
-	NewBalance float64 `json:"newBalance"`
+	Code       int   `json:"code"`
+	NewBalance Money `json:"newBalance"`
 }
 
 // CashOutRequest represents the cashout request
@@ -78,11 +119,11 @@ type CashOutRequest struct {
 }
 
 type CashOutItem struct {
-	BetAmount           float64 `json:"betAmount"`
-	WinAmount           float64 `json:"winAmount"`
-	PlayerID            string  `json:"player_id"`
-	BetID               int     `json:"betId"`
-	IsMaxWinAutoCashOut bool    `json:"isMaxWinAutoCashOut"`
+	BetAmount           Money  `json:"betAmount"`
+	WinAmount           Money  `json:"winAmount"`
+	PlayerID            string `json:"player_id"`
+	BetID               int    `json:"betId"`
+	IsMaxWinAutoCashOut bool   `json:"isMaxWinAutoCashOut"`
 }
 
 type CashOutResponse struct {
@@ -157,7 +198,7 @@ type Settings struct {
 
 type User struct {
 	Settings     Settings `json:"settings"`
-	Balance      float64  `json:"balance"`
+	Balance      Money    `json:"balance"`
 	ProfileImage string   `json:"profileImage"`
 	UserID       string   `json:"userId"`
 	Username     string   `json:"username"`
@@ -179,12 +220,12 @@ type ChatPromo struct {
 }
 
 type ChatRain struct {
-	IsEnabled         bool `json:"isEnabled"`
-	RainMinBet        int  `json:"rainMinBet"`
-	DefaultNumOfUsers int  `json:"defaultNumOfUsers"`
-	MinNumOfUsers     int  `json:"minNumOfUsers"`
-	MaxNumOfUsers     int  `json:"maxNumOfUsers"`
-	RainMaxBet        int  `json:"rainMaxBet"`
+	IsEnabled         bool  `json:"isEnabled"`
+	RainMinBet        Money `json:"rainMinBet"` // 主币种金额
+	DefaultNumOfUsers int   `json:"defaultNumOfUsers"`
+	MinNumOfUsers     int   `json:"minNumOfUsers"`
+	MaxNumOfUsers     int   `json:"maxNumOfUsers"`
+	RainMaxBet        Money `json:"rainMaxBet"`
 }
 
 type Chat struct {
@@ -204,7 +245,7 @@ type EngagementTools struct {
 type Config struct {
 	IsAutoBetFeatureEnabled          bool            `json:"isAutoBetFeatureEnabled"`
 	BetPrecision                     int             `json:"betPrecision"`
-	MaxBet                           float64         `json:"maxBet"`
+	MaxBet                           Money           `json:"maxBet"`
 	IsAlderneyModalShownOnInit       bool            `json:"isAlderneyModalShownOnInit"`
 	IsCurrencyNameHidden             bool            `json:"isCurrencyNameHidden"`
 	IsLoginTimer                     bool            `json:"isLoginTimer"`
@@ -221,7 +262,7 @@ type Config struct {
 	IsActiveGameFocused              bool            `json:"isActiveGameFocused"`
 	IsNetSessionEnabled              bool            `json:"isNetSessionEnabled"`
 	FullBetTime                      int             `json:"fullBetTime"`
-	MinBet                           float64         `json:"minBet"`
+	MinBet                           Money           `json:"minBet"`
 	IsGameRulesHaveMinimumBankValue  bool            `json:"isGameRulesHaveMinimumBankValue"`
 	IsShowTotalWinWidget             bool            `json:"isShowTotalWinWidget"`
 	IsShowBetControlNumber           bool            `json:"isShowBetControlNumber"`
@@ -231,8 +272,8 @@ type Config struct {
 	OnLockUIActions                  string          `json:"onLockUIActions"`
 	IsEmbeddedVideoHidden            bool            `json:"isEmbeddedVideoHidden"`
 	IsBetTimerBranded                bool            `json:"isBetTimerBranded"`
-	DefaultBetValue                  float64         `json:"defaultBetValue"`
-	MaxUserWin                       float64         `json:"maxUserWin"`
+	DefaultBetValue                  Money           `json:"defaultBetValue"`
+	MaxUserWin                       Money           `json:"maxUserWin"`
 	IsUseMaskedUsername              bool            `json:"isUseMaskedUsername"`
 	IsShowWinAmountUntilNextRound    bool            `json:"isShowWinAmountUntilNextRound"`
 	MultiplierPrecision              int             `json:"multiplierPrecision"`
@@ -261,7 +302,7 @@ type LoginInit struct {
 	Code               int           `json:"code"`
 	ActiveBets         []interface{} `json:"activeBets"`
 	OnlinePlayers      int           `json:"onlinePlayers"`
-	ActiveFreeBetsInfo []interface{} `json:"activeFreeBetsInfo"`
+	ActiveFreeBetsInfo []FreeBetInfo `json:"activeFreeBetsInfo"`
 	User               User          `json:"user"`
 	Config             Config        `json:"config"`
 	RoundID            int           `json:"roundId"`
@@ -277,11 +318,11 @@ type CurrentBetsInfo struct {
 	ActivePlayersCount     int       `json:"activePlayersCount"`
 	Bets                   []Bet     `json:"bets"`
 	TopPlayerProfileImages []string  `json:"topPlayerProfileImages"`
-	TotalCashOut           float64   `json:"totalCashOut"`
+	TotalCashOut           Money     `json:"totalCashOut"`
 }
 
 type Bet struct {
-	Bet          float64 `json:"bet"`
+	Bet          Money   `json:"bet"`
 	PlayerID     string  `json:"player_id"`
 	BetID        int     `json:"betId"`
 	IsFreeBet    bool    `json:"isFreeBet"`
@@ -290,7 +331,7 @@ type Bet struct {
 	Username     string  `json:"username"`
 	Win          bool    `json:"win"`
 	RoundBetId   int     `json:"roundBetId"`
-	WinAmount    float64 `json:"winAmount"`
+	WinAmount    Money   `json:"winAmount"`
 	Payout       float64 `json:"payout"`
 }
 
@@ -326,14 +367,14 @@ type TopWinsResponse struct {
 
 type TopWin struct {
 	MaxMultiplier           float64 `json:"maxMultiplier"`
-	WinAmount               float64 `json:"winAmount"`
+	WinAmount               Money   `json:"winAmount"`
 	EndDate                 int64   `json:"endDate"` // 毫秒时间戳
 	Payout                  float64 `json:"payout"`
 	IsFreeBet               bool    `json:"isFreeBet"`
 	ProfileImage            string  `json:"profileImage"`
-	Bet                     float64 `json:"bet"`
+	Bet                     Money   `json:"bet"`
 	RoundBetId              int64   `json:"roundBetId"`
-	WinAmountInMainCurrency float64 `json:"winAmountInMainCurrency"`
+	WinAmountInMainCurrency Money   `json:"winAmountInMainCurrency"`
 	Zone                    string  `json:"zone"`
 	Currency                string  `json:"currency"`
 	RoundId                 int     `json:"roundId"`
@@ -366,3 +407,156 @@ type TopRoundRequest struct {
 type HugeWinRequest struct {
 	Period string `json:"period"`
 }
+
+// AutoBetSlot represents one bet slot of an auto-bet plan
+type AutoBetSlot struct {
+	BetID       int     `json:"betId"`
+	Bet         Money   `json:"bet"`
+	AutoCashOut float64 `json:"autoCashOut"`
+}
+
+// AutoBetRequest represents the request registering a server-side auto-bet plan
+type AutoBetRequest struct {
+	Bets             []AutoBetSlot `json:"bets"`
+	NumberOfRounds   int           `json:"numberOfRounds"`
+	DecreaseBy       Money         `json:"decreaseBy"`       // 余额减少超过该值停止
+	SingleWinExceeds Money         `json:"singleWinExceeds"` // 单次赢额超过该值停止
+}
+
+// AutoBetProgress represents the auto-bet progress notification
+type AutoBetProgress struct {
+	Code           int           `json:"code"`
+	IsActive       bool          `json:"isActive"`
+	Bets           []AutoBetSlot `json:"bets"`
+	NumberOfRounds int           `json:"numberOfRounds"`
+	RoundsPlayed   int           `json:"roundsPlayed"`
+	RoundsLeft     int           `json:"roundsLeft"`
+	BalanceChange  Money         `json:"balanceChange"`
+	StopReason     string        `json:"stopReason,omitempty"`
+}
+
+// FreeBetInfo represents an active free bet voucher shown to the player
+type FreeBetInfo struct {
+	ID            string  `json:"id"`
+	BetAmount     Money   `json:"betAmount"`
+	Count         int     `json:"count"`
+	ExpiryDate    int64   `json:"expiryDate"` // 毫秒时间戳
+	MinMultiplier float64 `json:"minMultiplier"`
+}
+
+// ActiveFreeBetsInfo represents the active free bets update
+type ActiveFreeBetsInfo struct {
+	Code               int           `json:"code"`
+	ActiveFreeBetsInfo []FreeBetInfo `json:"activeFreeBetsInfo"`
+}
+
+// RoundsInfoItem represents one entry of the multiplier history bar
+type RoundsInfoItem struct {
+	MaxMultiplier float64 `json:"maxMultiplier"`
+	RoundId       int     `json:"roundId"`
+}
+
+// RoundsInfo represents the multiplier history update
+type RoundsInfo struct {
+	Code       int              `json:"code"`
+	RoundsInfo []RoundsInfoItem `json:"roundsInfo"`
+}
+
+// ChatMessage represents one message of the room chat
+type ChatMessage struct {
+	ID           int64         `json:"id"`
+	Type         string        `json:"type"` // message 或 rain
+	PlayerID     string        `json:"playerId"`
+	Username     string        `json:"username"`
+	ProfileImage string        `json:"profileImage"`
+	Message      string        `json:"message"`
+	Gif          string        `json:"gif,omitempty"`
+	Likes        int           `json:"likes"`
+	LikedBy      []string      `json:"-"`
+	CreatedAt    int64         `json:"createdAt"` // 毫秒时间戳
+	Rain         *ChatRainInfo `json:"rain,omitempty"`
+}
+
+// ChatSendRequest represents the request sending a chat message
+type ChatSendRequest struct {
+	Message string `json:"message"`
+	Gif     string `json:"gif"`
+}
+
+// ChatSendResponse represents the result of sending a chat message
+type ChatSendResponse struct {
+	Code       int    `json:"code"`
+	Reason     string `json:"reason,omitempty"`
+	RetryAfter int64  `json:"retryAfter,omitempty"` // 毫秒
+}
+
+// ChatLikeRequest represents the request liking a chat message
+type ChatLikeRequest struct {
+	ID int64 `json:"id"`
+}
+
+// ChatLikes represents the likes update of a chat message
+type ChatLikes struct {
+	Code  int   `json:"code"`
+	ID    int64 `json:"id"`
+	Likes int   `json:"likes"`
+}
+
+// ChatHistory represents the chat history sent to joiners
+type ChatHistory struct {
+	Code     int           `json:"code"`
+	Messages []ChatMessage `json:"messages"`
+}
+
+// ChatMessagesRemoved represents the removal of moderated chat messages
+type ChatMessagesRemoved struct {
+	Code int     `json:"code"`
+	IDs  []int64 `json:"ids"`
+}
+
+// ChatRainInfo represents a rain announced in chat, recipients claim their share before it expires
+type ChatRainInfo struct {
+	Amount     Money    `json:"amount"`
+	Share      Money    `json:"share"`
+	Currency   string   `json:"currency"`
+	IsPromo    bool     `json:"isPromo"`
+	Recipients []string `json:"recipients"`
+	Claimed    []string `json:"claimed"`
+	ExpiresAt  int64    `json:"expiresAt"` // 毫秒时间戳
+}
+
+// RainRequest represents the request starting a rain
+type RainRequest struct {
+	Amount     Money `json:"amount"`
+	NumOfUsers int   `json:"numOfUsers"`
+}
+
+// RainClaimRequest represents the request claiming a rain share
+type RainClaimRequest struct {
+	ID int64 `json:"id"`
+}
+
+// RainResponse represents the result of starting or claiming a rain
+type RainResponse struct {
+	Code   int    `json:"code"`
+	ID     int64  `json:"id,omitempty"`
+	Share  Money  `json:"share,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// RainUpdate represents the claim state of a rain
+type RainUpdate struct {
+	Code    int      `json:"code"`
+	ID      int64    `json:"id"`
+	Claimed []string `json:"claimed"`
+	Expired bool     `json:"expired"`
+}
+
+// RoundVoided represents the notification that the current round was voided
+type RoundVoided struct {
+	Code     int    `json:"code"`
+	RoundId  int    `json:"roundId"`
+	Reason   string `json:"reason"`
+	Refund   Money  `json:"refund"`   // 退还给该玩家的下注
+	Reversed Money  `json:"reversed"` // 按作废策略收回的兑现金额
+}
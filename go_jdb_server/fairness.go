@@ -0,0 +1,44 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+)
+
+// 每局记录的客户端种子个数
+const maxClientSeeds = 3
+
+// NewServerSeed 每局随机生成的服务端种子
+func NewServerSeed() string {
+	buf := make([]byte, 20)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// SeedHash 开局前可公开的种子哈希
+func SeedHash(seed string) string {
+	sum := sha256.Sum256([]byte(seed))
+	return hex.EncodeToString(sum[:])
+}
+
+// CrashPoint 由服务端种子和客户端种子算出本局爆点：
+// r 为 HMAC 前52位得到的 [0,1) 均匀分布，爆点 = rtp% / (1 - r)，不低于1.00，不超过上限
+func CrashPoint(serverSeed string, clientSeeds []string, rtp float64, maxMultiplier float64) float64 {
+	mac := hmac.New(sha256.New, []byte(serverSeed))
+	mac.Write([]byte(strings.Join(clientSeeds, "-")))
+	sum := mac.Sum(nil)
+	r := float64(binary.BigEndian.Uint64(sum[:8])>>12) / float64(uint64(1)<<52)
+
+	crash := FloorMultiplier(rtp / 100 / (1 - r))
+	if crash < 1 {
+		crash = 1
+	}
+	if maxMultiplier > 0 && crash > maxMultiplier {
+		crash = maxMultiplier
+	}
+	return crash
+}
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestCrashPoint(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverSeed    string
+		clientSeeds   []string
+		rtp           float64
+		maxMultiplier float64
+		want          float64
+	}{
+		{"no client seeds", "a1b2c3", nil, 97, 0, 1.55},
+		{"client seeds", "a1b2c3", []string{"x", "y", "z"}, 97, 0, 9.94},
+		{"rtp 97", "deadbeef", []string{"seed"}, 97, 0, 3.53},
+		{"rtp 99", "deadbeef", []string{"seed"}, 99, 0, 3.6},
+		{"capped", "ffff", []string{"p1"}, 97, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CrashPoint(tt.serverSeed, tt.clientSeeds, tt.rtp, tt.maxMultiplier)
+			if got != tt.want {
+				t.Fatalf("CrashPoint() = %v, want %v", got, tt.want)
+			}
+			// 公开种子后任何人都能复算出同样的爆点
+			if again := CrashPoint(tt.serverSeed, tt.clientSeeds, tt.rtp, tt.maxMultiplier); again != got {
+				t.Fatalf("CrashPoint() not deterministic: %v then %v", got, again)
+			}
+		})
+	}
+}
+
+func TestCrashPointBounds(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		seed := NewServerSeed()
+		got := CrashPoint(seed, []string{"c"}, 97, 100)
+		if got < 1 || got > 100 {
+			t.Fatalf("CrashPoint(%q) = %v, want within [1, 100]", seed, got)
+		}
+	}
+}
+
+func TestSeedHash(t *testing.T) {
+	tests := []struct {
+		seed string
+		want string
+	}{
+		{"abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+	}
+	for _, tt := range tests {
+		if got := SeedHash(tt.seed); got != tt.want {
+			t.Errorf("SeedHash(%q) = %s, want %s", tt.seed, got, tt.want)
+		}
+	}
+}
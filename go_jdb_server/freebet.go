@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrFreeBetNotFound = errors.New("voucher not found")
+	ErrFreeBetReserved = errors.New("voucher is used by an open bet")
+)
+
+// FreeBetVoucher 运营方发放的免费下注券，Count 张同额度的免费下注
+type FreeBetVoucher struct {
+	Id            string  `json:"id"`
+	AccountId     string  `json:"accountId"`
+	Amount        Money   `json:"amount"`
+	Count         int     `json:"count"`
+	Remaining     int     `json:"remaining"`
+	ExpiresAt     int64   `json:"expiresAt"` // 毫秒时间戳
+	MinMultiplier float64 `json:"minMultiplier"`
+	CreatedAt     int64   `json:"createdAt"`
+	// Reserved 已下注还未结算的占用，每一项为 freeBetReservation 生成的键；
+	// 下注时占用并减少 Remaining，取消或作废时归还，结算后消耗
+	Reserved []string `json:"reserved,omitempty"`
+}
+
+// freeBetReservation 一注免费下注占用的键，同一张券在同一房间同一局的同一下注位置只能占用一次
+func freeBetReservation(roomId int, roundId int, betId int32) string {
+	return fmt.Sprintf("%d:%d:%d", roomId, roundId, betId)
+}
+
+func (v *FreeBetVoucher) IsActive(now int64) bool {
+	return v.Remaining > 0 && (v.ExpiresAt == 0 || v.ExpiresAt > now)
+}
+
+// FreeBetLedger 免费下注台账，所有房间共用；每次变动立即写盘，重启后券和占用不丢失
+type FreeBetLedger struct {
+	mutex    sync.Mutex
+	path     string
+	nextId   int64
+	vouchers map[string]*FreeBetVoucher
+}
+
+// freeBetFile data/freebets.json 的内容
+type freeBetFile struct {
+	NextId   int64                      `json:"nextId"`
+	Vouchers map[string]*FreeBetVoucher `json:"vouchers"`
+}
+
+var freeBets = NewFreeBetLedger("")
+
+// NewFreeBetLedger path 为空时只保存在内存中
+func NewFreeBetLedger(path string) *FreeBetLedger {
+	return &FreeBetLedger{
+		path:     path,
+		vouchers: make(map[string]*FreeBetVoucher),
+	}
+}
+
+func OpenFreeBetLedger() (*FreeBetLedger, error) {
+	if err := os.MkdirAll(DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	l := NewFreeBetLedger(filepath.Join(DataDir, "freebets.json"))
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file freeBetFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", l.path, err)
+	}
+	l.nextId = file.NextId
+	if file.Vouchers != nil {
+		l.vouchers = file.Vouchers
+	}
+	return l, nil
+}
+
+// save 写临时文件后改名，写盘失败只打印日志
+func (l *FreeBetLedger) save() {
+	if l.path == "" {
+		return
+	}
+	data, err := json.Marshal(freeBetFile{NextId: l.nextId, Vouchers: l.vouchers})
+	if err != nil {
+		logStore.Error("免费下注序列化失败", "err", err)
+		return
+	}
+	if err := writeFileSync(l.path, data); err != nil {
+		logStore.Error("免费下注写入失败", "path", l.path, "err", err)
+	}
+}
+
+// Grant 发放免费下注券
+func (l *FreeBetLedger) Grant(accountId string, amount Money, count int, expiresAt int64, minMultiplier float64) (*FreeBetVoucher, error) {
+	if accountId == "" {
+		return nil, fmt.Errorf("accountId is required")
+	}
+	if amount <= 0 || count <= 0 {
+		return nil, fmt.Errorf("amount and count must be positive")
+	}
+	now := time.Now().UnixMilli()
+	if expiresAt != 0 && expiresAt <= now {
+		return nil, fmt.Errorf("expiresAt is in the past")
+	}
+	if minMultiplier < 1 {
+		minMultiplier = 1
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.nextId++
+	voucher := &FreeBetVoucher{
+		Id:            fmt.Sprintf("fb-%d-%d", now, l.nextId),
+		AccountId:     accountId,
+		Amount:        amount,
+		Count:         count,
+		Remaining:     count,
+		ExpiresAt:     expiresAt,
+		MinMultiplier: minMultiplier,
+		CreatedAt:     now,
+	}
+	l.vouchers[voucher.Id] = voucher
+	l.save()
+	return voucher, nil
+}
+
+// Revoke 作废免费下注券；有未结算的下注占用时拒绝，避免兑现时查不到最低倍数
+func (l *FreeBetLedger) Revoke(id string) (*FreeBetVoucher, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	voucher, ok := l.vouchers[id]
+	if !ok {
+		return nil, ErrFreeBetNotFound
+	}
+	if len(voucher.Reserved) > 0 {
+		return nil, ErrFreeBetReserved
+	}
+	delete(l.vouchers, id)
+	l.save()
+	return voucher, nil
+}
+
+// Reserve 下注时占用一张额度相同的券，优先使用最早过期的；key 由 freeBetReservation 生成
+func (l *FreeBetLedger) Reserve(accountId string, amount Money, autoCashOut float64, key string) *FreeBetVoucher {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now().UnixMilli()
+	var found *FreeBetVoucher
+	for _, voucher := range l.vouchers {
+		if voucher.AccountId != accountId || voucher.Amount != amount || !voucher.IsActive(now) {
+			continue
+		}
+		// 自动兑现倍数低于最低倍数时不能使用
+		if autoCashOut > 1 && autoCashOut < voucher.MinMultiplier {
+			continue
+		}
+		if found == nil || expiresBefore(voucher, found) {
+			found = voucher
+		}
+	}
+	if found == nil {
+		return nil
+	}
+	found.Remaining--
+	found.Reserved = append(found.Reserved, key)
+	l.save()
+	return found
+}
+
+// Release 取消或作废下注时归还占用的券；占用已归还或已消耗时不做任何事
+func (l *FreeBetLedger) Release(id string, key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if voucher, ok := l.vouchers[id]; ok && voucher.unreserve(key) {
+		voucher.Remaining++
+		l.save()
+	}
+}
+
+// Consume 下注结算后消耗占用的券；重复调用不做任何事
+func (l *FreeBetLedger) Consume(id string, key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if voucher, ok := l.vouchers[id]; ok && voucher.unreserve(key) {
+		l.save()
+	}
+}
+
+// ReleaseRoom 归还房间内所有未结算的占用，返回归还的张数。
+// 启动恢复流水后调用：此时房间没有进行中的牌局，剩下的占用都是下注流水没来得及写入的
+func (l *FreeBetLedger) ReleaseRoom(roomId int) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	prefix := fmt.Sprintf("%d:", roomId)
+	released := 0
+	for _, voucher := range l.vouchers {
+		for _, key := range slices.Clone(voucher.Reserved) {
+			if strings.HasPrefix(key, prefix) && voucher.unreserve(key) {
+				voucher.Remaining++
+				released++
+			}
+		}
+	}
+	if released > 0 {
+		l.save()
+	}
+	return released
+}
+
+func (v *FreeBetVoucher) unreserve(key string) bool {
+	idx := slices.Index(v.Reserved, key)
+	if idx < 0 {
+		return false
+	}
+	v.Reserved = slices.Delete(v.Reserved, idx, idx+1)
+	return true
+}
+
+func (l *FreeBetLedger) MinMultiplier(id string) float64 {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if voucher, ok := l.vouchers[id]; ok {
+		return voucher.MinMultiplier
+	}
+	return 1
+}
+
+// List 查询玩家的券，accountId 为空时返回全部
+func (l *FreeBetLedger) List(accountId string) []FreeBetVoucher {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	list := make([]FreeBetVoucher, 0)
+	for _, voucher := range l.vouchers {
+		if accountId != "" && voucher.AccountId != accountId {
+			continue
+		}
+		list = append(list, *voucher)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt < list[j].CreatedAt
+	})
+	return list
+}
+
+// ActiveInfo 玩家可用的免费下注，对应 activeFreeBetsInfo
+func (l *FreeBetLedger) ActiveInfo(accountId string) []FreeBetInfo {
+	now := time.Now().UnixMilli()
+	infos := make([]FreeBetInfo, 0)
+	for _, voucher := range l.List(accountId) {
+		if !voucher.IsActive(now) {
+			continue
+		}
+		infos = append(infos, FreeBetInfo{
+			ID:            voucher.Id,
+			BetAmount:     voucher.Amount,
+			Count:         voucher.Remaining,
+			ExpiryDate:    voucher.ExpiresAt,
+			MinMultiplier: voucher.MinMultiplier,
+		})
+	}
+	return infos
+}
+
+func expiresBefore(a, b *FreeBetVoucher) bool {
+	if a.ExpiresAt == 0 {
+		return false
+	}
+	return b.ExpiresAt == 0 || a.ExpiresAt < b.ExpiresAt
+}
+
+// freeBetKey 本局一注免费下注占用券的键
+func (g *AviatorGameContext) freeBetKey(bet *PlayerBetSt) string {
+	return freeBetReservation(g.RoomId, g.RecordId, bet.BetArea)
+}
+
+// ConsumeFreeBets 结算时消耗本局免费下注占用的券，先写流水再修改台账
+func (g *AviatorGameContext) ConsumeFreeBets() {
+	for _, player := range g.players {
+		for _, bet := range player.BetList {
+			if !bet.isFreeBet {
+				continue
+			}
+			g.Journal(JournalEntry{
+				Type:      JournalFreeBet,
+				AccountId: player.AccountId,
+				Currency:  player.Currency,
+				BetId:     bet.BetArea,
+				FreeBetId: bet.freeBetId,
+			}, nil)
+			freeBets.Consume(bet.freeBetId, g.freeBetKey(bet))
+		}
+	}
+}
+
+func (g *AviatorGameContext) S2cActiveFreeBetsInfo(playerInfo *AviatorPlayerInfo) {
+	ntf := &ActiveFreeBetsInfo{
+		Code:               200,
+		ActiveFreeBetsInfo: freeBets.ActiveInfo(playerInfo.AccountId),
+	}
+
+	result, _ := StructToMap(ntf)
+	g.SendToClient(playerInfo, "activeFreeBetsInfo", result)
+}
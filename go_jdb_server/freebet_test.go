@@ -0,0 +1,40 @@
+package main
+
+import "testing"
+
+func TestFreeBetZeroWinCashOutOnce(t *testing.T) {
+	g := newVoidTestRoom(t)
+	const account = "1&&demo"
+	player := &AviatorPlayerInfo{AccountId: account, Currency: MainCurrency(), BetList: make([]*PlayerBetSt, 0)}
+	g.players["p1"] = player
+	player.Balance = wallets.Balance(account)
+	if _, err := freeBets.Grant(account, MoneyFromInt(1), 1, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	g.CurStage = EAviatorStageBet
+	if !g.PlaceBet(player, &BetRequest{Bet: MoneyFromInt(1), BetID: 1, FreeBet: true}) {
+		t.Fatal("free bet rejected")
+	}
+
+	// 1.001 倍的赔付取整后等于本金，免费下注赢额为0
+	g.CurStage = EAviatorStageCashOut
+	g.CurMultiplier = 1.001
+	if !g.CashOut(player, &CashOutRequest{BetID: 1}) {
+		t.Fatal("first cash out rejected")
+	}
+	if bet := g.Id2Bet(1, player); bet.CashOut != 0 || !bet.hasCashOut {
+		t.Fatalf("bet after cash out: CashOut = %s hasCashOut = %v, want 0 and true", bet.CashOut, bet.hasCashOut)
+	}
+
+	g.CurMultiplier = 5
+	if g.CashOut(player, &CashOutRequest{BetID: 1}) {
+		t.Error("second cash out of the same free bet accepted")
+	}
+	if len(g.CashOuts) != 1 {
+		t.Errorf("cash outs = %d, want 1", len(g.CashOuts))
+	}
+	if got := wallets.Balance(account); got != DemoStartBalance {
+		t.Errorf("balance = %s, want %s", got, DemoStartBalance)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// FxRateProvider 汇率来源，Rate 返回 1 单位币种折合主币种的数额
+type FxRateProvider interface {
+	MainCurrency() string
+	Rate(currency string) (float64, bool)
+}
+
+// StaticFxRates 从文件读取的固定汇率，默认的汇率来源
+type StaticFxRates struct {
+	Main  string             `json:"mainCurrency"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+func (s *StaticFxRates) MainCurrency() string {
+	return s.Main
+}
+
+func (s *StaticFxRates) Rate(currency string) (float64, bool) {
+	if currency == s.Main {
+		return 1, true
+	}
+	rate, ok := s.Rates[currency]
+	return rate, ok && rate > 0
+}
+
+// LoadStaticFxRates 读取汇率文件，文件不存在时只有主币种 MAD
+func LoadStaticFxRates(path string) (*StaticFxRates, error) {
+	rates := &StaticFxRates{Main: "MAD", Rates: map[string]float64{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return rates, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, rates); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if rates.Main == "" {
+		return nil, fmt.Errorf("%s: mainCurrency is required", path)
+	}
+	return rates, nil
+}
+
+var (
+	fxMutex    sync.RWMutex
+	fxProvider FxRateProvider = &StaticFxRates{Main: "MAD", Rates: map[string]float64{}}
+)
+
+// SetFxRateProvider 替换汇率来源，如接入实时汇率服务
+func SetFxRateProvider(provider FxRateProvider) {
+	fxMutex.Lock()
+	defer fxMutex.Unlock()
+
+	fxProvider = provider
+}
+
+func FxRates() FxRateProvider {
+	fxMutex.RLock()
+	defer fxMutex.RUnlock()
+
+	return fxProvider
+}
+
+// MainCurrency 排行榜、报表使用的主币种
+func MainCurrency() string {
+	return FxRates().MainCurrency()
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"math"
 	"math/rand"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
@@ -26,10 +29,45 @@ const (
 
 type PlayerBetSt struct {
 	BetArea     int32
-	BetValue    float64
-	CashOut     float64
+	BetValue    Money
+	CashOut     Money
 	autoCashOut float64
 	hasCashOut  bool
+	isFreeBet   bool   // 免费下注不扣余额，只赔付盈利部分
+	freeBetId   string // 使用的免费下注券
+	voided      bool   // 作废的退款已入账
+
+	cashOutMultiplier float64 // 兑现时的倍数
+}
+
+// WinAmount 按倍数计算兑现金额，按币种精度向下取整，不超过币种的单人最高赢额
+func (b *PlayerBetSt) WinAmount(multiplier float64, currency string) Money {
+	win := PayoutAmount(b.BetValue, multiplier, currency)
+	if b.isFreeBet {
+		win -= b.BetValue
+	}
+	if maxWin := currencies.Get(currency).MaxUserWin; maxWin > 0 && win > maxWin {
+		win = maxWin
+	}
+	return win
+}
+
+// MaxWinMultiplier 兑现金额达到币种单人最高赢额时的倍数，按倍数精度向上取整；币种没有上限时为0
+func (b *PlayerBetSt) MaxWinMultiplier(currency string) float64 {
+	maxWin := currencies.Get(currency).MaxUserWin
+	if maxWin <= 0 || b.BetValue <= 0 {
+		return 0
+	}
+	payout := maxWin
+	if b.isFreeBet {
+		payout += b.BetValue
+	}
+	scale := int64(math.Pow10(MultiplierPrecision))
+	units := mulDiv(int64(payout), scale, int64(b.BetValue))
+	if Money(mulDiv(int64(b.BetValue), units, scale)) < payout {
+		units++
+	}
+	return float64(units) / float64(scale)
 }
 
 type AviatorPlayerInfo struct {
@@ -41,14 +79,15 @@ type AviatorPlayerInfo struct {
 	PlayerType   int64  // 玩家类型 1.正常账号  2.试玩账号
 	ProfileImage string
 
-	Balance    float64 // 余额
-	Rtp        int64   // 当前RTP
-	RtpLevel   int64   // Rtp等级
-	ChannelRtp int64   // 渠道RTP
-	IsOffline  bool    // 是否离线
-	Token      string  // 用户token
-	AutoBet    bool    // 是否自动下注
-	isRobot    bool    // 是否机器人
+	Balance    Money     // 余额
+	Rtp        int64     // 当前RTP
+	RtpLevel   int64     // Rtp等级
+	ChannelRtp int64     // 渠道RTP
+	IsOffline  bool      // 是否离线
+	offlineAt  time.Time // 断线时间
+	Token      string    // 用户token
+	AutoBet    bool      // 是否自动下注
+	isRobot    bool      // 是否机器人
 
 	BetList []*PlayerBetSt
 
@@ -57,25 +96,50 @@ type AviatorPlayerInfo struct {
 }
 
 type AviatorGameContext struct {
-	players map[string]*AviatorPlayerInfo
-	robots  map[string]*AviatorPlayerInfo
+	RoomId       int    // 所属房间
+	Currency     string // 房间限定币种，为空时接受所有币种
+	MinBet       Money  // 房间下注限额，为0时使用币种限额
+	MaxBet       Money
+	tickInterval time.Duration
+	speed        float64   // 倍数增长速度，按飞行时间的倍数计算
+	lastTickAt   time.Time // 上一次 tick 的时间，用于统计间隔抖动
+
+	players  map[string]*AviatorPlayerInfo
+	robots   map[string]*AviatorPlayerInfo
+	autoBets map[string]*AutoBetPlan // 自动下注计划，按AccountId索引，断线重连后继续
+	chat     *ChatRoom
 
 	RecordId          int  // 牌局号(每次下一局累加1)
 	isRunning         bool // 是否已启动
 	Timer             *time.Timer
+	timerStop         chan struct{}
+	paused            bool   // 运营后台暂停
+	voidPolicy        string // 作废未完成时使用的策略，此时不接受下注、取消和兑现
+	pausedAt          int64  // 暂停时间
+	draining          bool   // 停机中：不再接受下注，本局结算后停止
+	drained           chan struct{}
 	curStateStartTime int64 //当前阶段开始时间
+	stageDeadline     int64 // 当前阶段的截止时间（毫秒），进入阶段时按配置时长确定，没有固定时长的阶段为0
 	CurStage          int32 //当前阶段
 	CurMultiplier     float64
+	crashPoint        float64        // 本局爆点，进入飞行阶段时确定
+	riskStop          string         // 风控提前爆炸的原因，未提前爆炸时为空
+	settings          ResultSettings // 本局使用的开奖设置，下注阶段开始时读取
 
 	CashOuts     []CashOut
-	CurrentBets  []Bet
-	LastBets     []Bet
-	TotalCashOut float64
-	TotalBet     float64
-
-	startTime     int64
-	endTime       int64
-	LastRoundInfo RoundInfo
+	CurrentBets  []Bet // 下发给客户端的下注列表，含机器人，最多50条
+	TotalCashOut Money // 下发给客户端的兑现总额，含机器人；历史和报表使用 PlayerTotals
+	TotalBet     Money
+
+	startTime   int64
+	endTime     int64
+	serverSeed  string   // 本局服务端种子
+	clientSeeds []string // 本局前几位玩家的客户端种子
+	history     *RoundHistory
+	journal     *Journal
+	rainJournal *Journal // 红包雨流水，跨越多局，没有未结束的红包雨时清空
+
+	mutex sync.Mutex // 定时器协程和websocket协程都会访问上下文
 }
 
 func StructToMap(obj interface{}) (map[string]interface{}, error) {
@@ -112,41 +176,202 @@ func NewGameContext() *AviatorGameContext {
 	return &AviatorGameContext{
 		players:           make(map[string]*AviatorPlayerInfo, 0),
 		robots:            make(map[string]*AviatorPlayerInfo, 0),
+		autoBets:          make(map[string]*AutoBetPlan, 0),
+		chat:              NewChatRoom(),
+		tickInterval:      500 * time.Millisecond,
+		speed:             1,
 		curStateStartTime: 0,
-		CurStage:          int32(EAviatorStageZero),
+		CurStage:          int32(EAviatorStageNone),
 		CurMultiplier:     1.0,
 		startTime:         0,
 		endTime:           0,
 	}
 }
 func (g *AviatorGameContext) Init() {
-	g.StartTimer(500*time.Millisecond, g.OnTick)
+	g.StartTimer(g.tickInterval, g.OnTick)
 }
 
+// NewGameInit 开始新的一局，进入开局阶段
 func (g *AviatorGameContext) NewGameInit() {
-	g.CurStage = EAviatorStageZero
-	g.curStateStartTime = time.Now().UnixMilli()
 	g.TotalBet = 0
 	g.TotalCashOut = 0
 	g.CurMultiplier = 1.0
 	g.CashOuts = make([]CashOut, 0)
 	g.CurrentBets = make([]Bet, 0)
 	g.RecordId = g.RecordId + 1
+	g.startTime = time.Now().UnixMilli()
+	g.serverSeed = NewServerSeed()
+	g.clientSeeds = make([]string, 0, maxClientSeeds)
+
+	// 上一局已结算或作废，流水只保留新的一局
+	if g.journal != nil {
+		g.journal.Reset()
+	}
+	g.Journal(JournalEntry{Type: JournalRound, StartDate: g.startTime, ServerSeed: g.serverSeed}, nil)
+	g.UpdateStatus(EAviatorStageZero)
 }
 
 func (g *AviatorGameContext) OnLogin(conn *websocket.Conn, obj map[string]interface{}) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	accountId := LoginAccountId(obj)
+
+	// 断线重连：沿用离线玩家的下注和自动下注计划，余额以钱包为准
+	for key, player := range g.players {
+		if player.AccountId != accountId || !player.IsOffline {
+			continue
+		}
+		delete(g.players, key)
+		player.mutex.Lock()
+		player.conn = conn
+		player.IsOffline = false
+		player.mutex.Unlock()
+		player.Balance = wallets.Balance(accountId)
+		g.players[conn.RemoteAddr().String()] = player
+		g.S2cChatHistory(player)
+		g.S2cSnapshot(player)
+		return
+	}
+
 	playerInfo := &AviatorPlayerInfo{
 		conn:      conn,
-		Balance:   10000,
+		Balance:   wallets.Balance(accountId),
 		BetList:   make([]*PlayerBetSt, 0),
 		IsOffline: false,
-		AccountId: "33687&&demo",
-		Nickname:  "demo_71815",
-		Currency:  "MAD",
+		AccountId: accountId,
+		Nickname:  LoginNickname(obj),
+		Currency:  g.PlayerCurrency(obj),
 	}
 	g.players[conn.RemoteAddr().String()] = playerInfo
+	g.S2cChatHistory(playerInfo)
+	g.S2cSnapshot(playerInfo)
+}
+
+// log 带房间号和牌局号的游戏日志
+func (g *AviatorGameContext) log() *slog.Logger {
+	return logGame.With("room", g.RoomId, "round", g.RecordId)
 }
+
+// LoginNickname 玩家显示的用户名：登录的 un 为账号 id 时取账号的用户名，否则直接使用 un
+func LoginNickname(obj map[string]interface{}) string {
+	un, _ := obj["un"].(string)
+	if userId, err := strconv.Atoi(un); err == nil {
+		if user, ok := accounts.Get(userId); ok {
+			return user.UserName
+		}
+	}
+	if un != "" {
+		return un
+	}
+	return "demo_71815"
+}
+
+// LoginCurrency 登录请求中的币种，取自启动链接，未填写时为主币种
+func LoginCurrency(obj map[string]interface{}) string {
+	params, _ := obj["p"].(map[string]interface{})
+	if currency, _ := params["currency"].(string); currency != "" {
+		return currency
+	}
+	return MainCurrency()
+}
+
+// PlayerCurrency 玩家在本房间使用的币种，即钱包的币种；登录时已校验币种受支持，
+// 限定币种的房间只允许该币种的玩家加入。obj 为nil时是机器人
+func (g *AviatorGameContext) PlayerCurrency(obj map[string]interface{}) string {
+	if obj != nil {
+		if currency := wallets.Currency(LoginAccountId(obj)); currency != "" {
+			return currency
+		}
+	}
+	if g.Currency != "" {
+		return g.Currency
+	}
+	return MainCurrency()
+}
+
+// LimitsFor 币种在本房间的下注限额，房间配置的限额优先
+func (g *AviatorGameContext) LimitsFor(currency string) CurrencyInfo {
+	info := currencies.Get(currency)
+	if g.Currency != "" && g.Currency == currency {
+		if g.MinBet > 0 {
+			info.MinBet = g.MinBet
+		}
+		if g.MaxBet > 0 {
+			info.MaxBet = g.MaxBet
+		}
+	}
+	return info
+}
+
+// LoginAccountId 从登录请求中取玩家账号，运营商取自启动链接
+func LoginAccountId(obj map[string]interface{}) string {
+	params, _ := obj["p"].(map[string]interface{})
+	operator, _ := params["operator"].(string)
+	if operator == "" {
+		operator = "demo"
+	}
+	if un, _ := obj["un"].(string); un != "" {
+		return un + "&&" + operator
+	}
+	return "33687&&" + operator
+}
+
+// FindPlayer 按账号查找玩家
+func (g *AviatorGameContext) FindPlayer(accountId string) *AviatorPlayerInfo {
+	for _, player := range g.players {
+		if player.AccountId == accountId {
+			return player
+		}
+	}
+	return nil
+}
+
+// HasOfflinePlayer 账号是否有等待重连的离线玩家
+func (g *AviatorGameContext) HasOfflinePlayer(accountId string) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	player := g.FindPlayer(accountId)
+	return player != nil && player.IsOffline
+}
+
+// HumanPlayers 在线真实玩家数
+func (g *AviatorGameContext) HumanPlayers() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	count := 0
+	for _, player := range g.players {
+		if !player.IsOffline {
+			count++
+		}
+	}
+	return count
+}
+
+func (g *AviatorGameContext) OnLogout(conn *websocket.Conn) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	playerInfo := g.players[conn.RemoteAddr().String()]
+	if playerInfo == nil {
+		return
+	}
+
+	// 有未结算的下注或自动下注计划时保留玩家，等待重连
+	if len(playerInfo.BetList) > 0 || playerInfo.AutoBet {
+		playerInfo.IsOffline = true
+		playerInfo.offlineAt = time.Now()
+		return
+	}
+	delete(g.players, conn.RemoteAddr().String())
+}
+
 func (g *AviatorGameContext) OnRecv(conn *websocket.Conn, obj map[string]interface{}) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
 	switch obj["c"] {
 	case "cancelBetHandler":
 		var result CancelBetRequest
@@ -171,6 +396,8 @@ func (g *AviatorGameContext) OnRecv(conn *websocket.Conn, obj map[string]interfa
 		g.C2sCashOut(conn, &result)
 	case "currentBetsInfoHandler":
 		g.C2sCurrentBetsInfo(conn)
+	case "snapshotHandler":
+		g.C2sSnapshot(conn)
 	case "previousRoundInfoHandler":
 		g.C2sPreviousRoundInfo(conn)
 	case "getHugeWinsInfoHandler":
@@ -194,8 +421,47 @@ func (g *AviatorGameContext) OnRecv(conn *websocket.Conn, obj map[string]interfa
 			return
 		}
 		g.C2sGetTopWinsInfo(conn, &result)
+	case "autoBetHandler":
+		var result AutoBetRequest
+		params, _ := obj["p"].(map[string]interface{})
+		if err := MapToStruct(params, &result); err != nil {
+			return
+		}
+		g.C2sAutoBet(conn, &result)
+	case "cancelAutoBetHandler":
+		g.C2sCancelAutoBet(conn)
+	case "sendChatMessageHandler":
+		var result ChatSendRequest
+		params, _ := obj["p"].(map[string]interface{})
+		if err := MapToStruct(params, &result); err != nil {
+			return
+		}
+		g.C2sSendChatMessage(conn, &result)
+	case "likeChatMessageHandler":
+		var result ChatLikeRequest
+		params, _ := obj["p"].(map[string]interface{})
+		if err := MapToStruct(params, &result); err != nil {
+			return
+		}
+		g.C2sLikeChatMessage(conn, &result)
+	case "chatHistoryHandler":
+		g.C2sChatHistory(conn)
+	case "rainHandler":
+		var result RainRequest
+		params, _ := obj["p"].(map[string]interface{})
+		if err := MapToStruct(params, &result); err != nil {
+			return
+		}
+		g.C2sRain(conn, &result)
+	case "claimRainHandler":
+		var result RainClaimRequest
+		params, _ := obj["p"].(map[string]interface{})
+		if err := MapToStruct(params, &result); err != nil {
+			return
+		}
+		g.C2sClaimRain(conn, &result)
 	default:
-		fmt.Printf("⚠️ 未知扩展命令: %s\n", obj["c"])
+		logWs.Warn("未知扩展命令", "room", g.RoomId, "conn", conn.RemoteAddr().String(), "cmd", obj["c"])
 	}
 }
 
@@ -216,7 +482,7 @@ func (g *AviatorGameContext) C2sCancelBet(conn *websocket.Conn, req *CancelBetRe
 		return
 	}
 
-	if g.CurStage != EAviatorStageBet {
+	if g.CurStage != EAviatorStageBet || g.voidPolicy != "" {
 		return
 	}
 
@@ -229,10 +495,18 @@ func (g *AviatorGameContext) C2sCancelBet(conn *websocket.Conn, req *CancelBetRe
 		return
 	}
 
-	//扣钱
-	playerInfo.Balance -= betSt.BetValue
-	g.S2cNewBalance(playerInfo, playerInfo.Balance)
-	if g.TotalBet-betSt.BetValue > 0 {
+	//退钱
+	entry := JournalEntry{Type: JournalCancel, AccountId: playerInfo.AccountId, Currency: playerInfo.Currency, BetId: int32(req.BetID), FreeBetId: betSt.freeBetId}
+	if !betSt.isFreeBet {
+		entry.Delta = betSt.BetValue
+	}
+	if !g.Journal(entry, playerInfo) {
+		return
+	}
+	if betSt.isFreeBet {
+		freeBets.Release(betSt.freeBetId, g.freeBetKey(betSt))
+		g.S2cActiveFreeBetsInfo(playerInfo)
+	} else if g.TotalBet-betSt.BetValue > 0 {
 		g.TotalBet -= betSt.BetValue
 	}
 
@@ -253,31 +527,72 @@ func (g *AviatorGameContext) C2sBet(conn *websocket.Conn, req *BetRequest) {
 		return
 	}
 
-	if g.CurStage != EAviatorStageBet {
-		return
-	}
+	g.PlaceBet(playerInfo, req)
+}
 
-	if req.Bet <= 0 || req.Bet > playerInfo.Balance || req.BetID <= 0 || req.BetID > 2 {
-		return
+// PlaceBet 玩家下注，手动下注和自动下注共用
+func (g *AviatorGameContext) PlaceBet(playerInfo *AviatorPlayerInfo, req *BetRequest) bool {
+	if g.CurStage != EAviatorStageBet || g.draining || g.voidPolicy != "" {
+		return false
 	}
 
+	if req.Bet <= 0 || req.BetID <= 0 || req.BetID > 2 {
+		return false
+	}
+	limits := g.LimitsFor(playerInfo.Currency)
+	req.Bet = RoundAmount(req.Bet, playerInfo.Currency)
+	if req.Bet < limits.MinBet || req.Bet > limits.MaxBet {
+		return false
+	}
 	betSt := g.Id2Bet(int32(req.BetID), playerInfo)
 	if betSt != nil {
-		return
+		return false
 	}
 
-	//扣钱
-	playerInfo.Balance -= req.Bet
-	g.S2cNewBalance(playerInfo, playerInfo.Balance)
-
-	g.TotalBet += req.Bet
-	playerInfo.BetList = append(playerInfo.BetList, &PlayerBetSt{
+	newBet := &PlayerBetSt{
 		BetArea:     int32(req.BetID),
 		BetValue:    req.Bet,
 		CashOut:     0,
 		autoCashOut: req.AutoCashOut,
 		hasCashOut:  false,
-	})
+	}
+	entry := JournalEntry{
+		Type:      JournalBet,
+		AccountId: playerInfo.AccountId,
+		Currency:  playerInfo.Currency,
+		BetId:     int32(req.BetID),
+		Bet:       req.Bet,
+		IsFreeBet: req.FreeBet,
+	}
+	if req.FreeBet {
+		//使用免费下注券，不扣钱
+		voucher := freeBets.Reserve(playerInfo.AccountId, req.Bet, req.AutoCashOut, g.freeBetKey(newBet))
+		if voucher == nil {
+			return false
+		}
+		newBet.isFreeBet = true
+		newBet.freeBetId = voucher.Id
+		entry.FreeBetId = voucher.Id
+	} else {
+		//扣钱
+		entry.Delta = -req.Bet
+	}
+	if !g.Journal(entry, playerInfo) {
+		if newBet.isFreeBet {
+			freeBets.Release(newBet.freeBetId, g.freeBetKey(newBet))
+		}
+		return false
+	}
+	if newBet.isFreeBet {
+		g.S2cActiveFreeBetsInfo(playerInfo)
+	} else {
+		g.TotalBet += req.Bet
+	}
+	playerInfo.BetList = append(playerInfo.BetList, newBet)
+	g.TouchActivity(playerInfo.AccountId)
+	if req.ClientSeed != "" && len(g.clientSeeds) < maxClientSeeds {
+		g.clientSeeds = append(g.clientSeeds, req.ClientSeed)
+	}
 
 	betResponse := &BetResponse{
 		Code:         200,
@@ -308,6 +623,7 @@ func (g *AviatorGameContext) C2sBet(conn *websocket.Conn, req *BetRequest) {
 
 	result, _ := StructToMap(betResponse)
 	g.SendToClient(playerInfo, "bet", result)
+	return true
 }
 
 func (g *AviatorGameContext) Id2Bet(betId int32, playerInfo *AviatorPlayerInfo) *PlayerBetSt {
@@ -334,18 +650,19 @@ func (g *AviatorGameContext) CancelBet(betId int32, playerInfo *AviatorPlayerInf
 	}
 }
 
-func (g *AviatorGameContext) SetCashOut(betId int32, betValue float64, curMultiplier float64, playerInfo *AviatorPlayerInfo) {
+func (g *AviatorGameContext) SetCashOut(betId int32, winAmount Money, curMultiplier float64, playerInfo *AviatorPlayerInfo) {
 	for idx, bet := range playerInfo.BetList {
 		if bet.BetArea == betId {
 			playerInfo.BetList[idx].hasCashOut = true
-			playerInfo.BetList[idx].CashOut = betValue * curMultiplier
+			playerInfo.BetList[idx].CashOut = winAmount
+			playerInfo.BetList[idx].cashOutMultiplier = curMultiplier
 		}
 	}
 
 	for idx, bet := range g.CurrentBets {
 		if int32(bet.BetID) == betId && playerInfo.AccountId == bet.PlayerID {
-			g.CurrentBets[idx].Payout = g.CurMultiplier
-			g.CurrentBets[idx].WinAmount = betValue * curMultiplier
+			g.CurrentBets[idx].Payout = curMultiplier
+			g.CurrentBets[idx].WinAmount = winAmount
 			g.CurrentBets[idx].Win = true
 			break
 		}
@@ -359,31 +676,45 @@ func (g *AviatorGameContext) C2sCashOut(conn *websocket.Conn, req *CashOutReques
 		return
 	}
 
-	if g.CurStage != EAviatorStageCashOut {
-		return
+	g.CashOut(playerInfo, req)
+}
+
+// CashOut 玩家按当前倍数兑现一注，每注只能兑现一次
+func (g *AviatorGameContext) CashOut(playerInfo *AviatorPlayerInfo, req *CashOutRequest) bool {
+	if g.CurStage != EAviatorStageCashOut || g.voidPolicy != "" {
+		return false
 	}
 
 	betSt := g.Id2Bet(int32(req.BetID), playerInfo)
 	if betSt == nil {
-		return
+		return false
 	}
 
-	if betSt.CashOut > 0 {
-		return
+	// 免费下注的赢额可能为0，不能用兑现金额判断是否已兑现
+	if betSt.hasCashOut {
+		return false
 	}
 	CurMultiplier := g.CurMultiplier
 
+	// 免费下注未达到最低兑现倍数
+	if betSt.isFreeBet && CurMultiplier < freeBets.MinMultiplier(betSt.freeBetId) {
+		return false
+	}
+	winAmount := betSt.WinAmount(CurMultiplier, playerInfo.Currency)
+
 	//加钱
-	playerInfo.Balance += betSt.BetValue * CurMultiplier
-	g.S2cNewBalance(playerInfo, playerInfo.Balance)
+	if !g.JournalCashOut(playerInfo, betSt, CurMultiplier, winAmount) {
+		return false
+	}
 
-	g.SetCashOut(int32(req.BetID), betSt.BetValue, CurMultiplier, playerInfo)
-	g.TotalCashOut += betSt.BetValue * CurMultiplier
+	g.SetCashOut(int32(req.BetID), winAmount, CurMultiplier, playerInfo)
+	g.TotalCashOut += winAmount
 	g.CashOuts = append(g.CashOuts, CashOut{
 		BetID:      req.BetID,
 		Multiplier: CurMultiplier,
 		PlayerID:   playerInfo.AccountId,
-		WinAmount:  betSt.BetValue * CurMultiplier,
+		WinAmount:  winAmount,
+		Currency:   playerInfo.Currency,
 	})
 
 	cashOutResponse := CashOutResponse{
@@ -397,13 +728,13 @@ func (g *AviatorGameContext) C2sCashOut(conn *websocket.Conn, req *CashOutReques
 		BetAmount:           betSt.BetValue,
 		BetID:               req.BetID,
 		PlayerID:            playerInfo.AccountId,
-		WinAmount:           betSt.BetValue * CurMultiplier,
+		WinAmount:           winAmount,
 		IsMaxWinAutoCashOut: false,
 	})
 
 	result, _ := StructToMap(cashOutResponse)
 	g.SendToClient(playerInfo, "cashOut", result)
-
+	return true
 }
 
 func (g *AviatorGameContext) C2sGetHugeWinsInfo(conn *websocket.Conn, req *HugeWinRequest) {
@@ -413,25 +744,8 @@ func (g *AviatorGameContext) C2sGetHugeWinsInfo(conn *websocket.Conn, req *HugeW
 	}
 	topWinsResponse := TopWinsResponse{
 		Code:    200,
-		TopWins: []TopWin{},
-	}
-
-	topWinsResponse.TopWins = append(topWinsResponse.TopWins, TopWin{
-		MaxMultiplier:           755.02,
-		WinAmount:               7229509.53,
-		EndDate:                 1752791583350,
-		Payout:                  100,
-		IsFreeBet:               false,
-		ProfileImage:            "av-5.png",
-		Bet:                     72295.09,
-		RoundBetId:              2969720161,
-		WinAmountInMainCurrency: 799938,
-		Zone:                    "aviator_core_inst2_demo1",
-		Currency:                "MAD",
-		RoundId:                 8280205,
-		PlayerId:                2053967,
-		Username:                "demo_24529",
-	})
+		TopWins: leaderboards.HugeWins(req.Period),
+	}
 
 	result, _ := StructToMap(topWinsResponse)
 	g.SendToClient(playerInfo, "getHugeWinsInfo", result)
@@ -444,25 +758,8 @@ func (g *AviatorGameContext) C2sGetTopWinsInfo(conn *websocket.Conn, req *TopWin
 	}
 	topWinsResponse := TopWinsResponse{
 		Code:    200,
-		TopWins: []TopWin{},
-	}
-
-	topWinsResponse.TopWins = append(topWinsResponse.TopWins, TopWin{
-		MaxMultiplier:           755.02,
-		WinAmount:               7229509.53,
-		EndDate:                 1752791583350,
-		Payout:                  100,
-		IsFreeBet:               false,
-		ProfileImage:            "av-5.png",
-		Bet:                     72295.09,
-		RoundBetId:              2969720161,
-		WinAmountInMainCurrency: 799938,
-		Zone:                    "aviator_core_inst2_demo1",
-		Currency:                "MAD",
-		RoundId:                 8280205,
-		PlayerId:                2053967,
-		Username:                "demo_24529",
-	})
+		TopWins: leaderboards.TopWins(req.Period),
+	}
 
 	result, _ := StructToMap(topWinsResponse)
 	g.SendToClient(playerInfo, "getTopWinsInfo", result)
@@ -475,18 +772,9 @@ func (g *AviatorGameContext) C2sGtTopRoundsInfo(conn *websocket.Conn, req *TopRo
 	}
 	topRoundResponse := TopRoundsResponse{
 		Code:      200,
-		TopRounds: []TopRound{},
+		TopRounds: leaderboards.TopRounds(req.Period),
 	}
 
-	topRoundResponse.TopRounds = append(topRoundResponse.TopRounds, TopRound{
-		RoundId:        1,
-		RoundStartDate: 1638300000,
-		EndDate:        1638300000 + 1000,
-		MaxMultiplier:  1.5,
-		ServerSeed:     "serverSeed",
-		Zone:           "zone",
-	})
-
 	result, _ := StructToMap(topRoundResponse)
 	g.SendToClient(playerInfo, "getTopRoundsInfo", result)
 }
@@ -500,15 +788,12 @@ func (g *AviatorGameContext) C2sPreviousRoundInfo(conn *websocket.Conn) {
 	previousRoundInfo := &PreviousRoundInfo{
 		Bets: []Bet{},
 		Code: 200,
-		RoundInfo: RoundInfo{
-			RoundId:        g.RecordId,
-			Multiplier:     g.CurMultiplier,
-			RoundStartDate: g.startTime,
-			RoundEndDate:   g.endTime,
-		},
 	}
 
-	previousRoundInfo.Bets = append(previousRoundInfo.Bets, g.LastBets...)
+	if last, ok := g.history.Last(); ok {
+		previousRoundInfo.RoundInfo = last.RoundInfo()
+		previousRoundInfo.Bets = append(previousRoundInfo.Bets, last.Bets...)
+	}
 	result, _ := StructToMap(previousRoundInfo)
 	g.SendToClient(playerInfo, "previousRoundInfoResponse", result)
 }
@@ -542,7 +827,7 @@ func (g *AviatorGameContext) S2cUpdateCurrentCashOuts() {
 	ntf := &UpdateCurrentCashOuts{
 		Code:                   200,
 		TotalCashOut:           g.TotalCashOut,
-		OpenBetsCount:          int(g.TotalBet),
+		OpenBetsCount:          g.OpenBetsCount(),
 		ActivePlayersCount:     g.OnlinePlayers(),
 		TopPlayerProfileImages: []string{},
 		CashOuts:               []CashOut{},
@@ -639,23 +924,42 @@ func (g *AviatorGameContext) S2cOnlinePlayers() {
 	g.SendToAllClients("onlinePlayers", result)
 }
 
-func (g *AviatorGameContext) S2cChangeState(newStatus int32) {
-	ntf := &ChangeState{
-		Code:       200,
-		NewStateID: int(newStatus),
-		RoundID:    int64(g.RecordId),
-		TimeLeft:   5000,
+// StageDuration 阶段的配置时长，飞行阶段到爆点为止，没有固定时长
+func StageDuration(stage int32) time.Duration {
+	switch stage {
+	case EAviatorStageBet:
+		return BET_TIME
+	case EAviatorStageCashOutAward:
+		return CASH_OUT_TIME
 	}
+	return 0
+}
 
-	if newStatus == EAviatorStageBet {
-		ntf.ServerTime = time.Now().UnixMilli()
-		ntf.BetStateEndTime = ntf.ServerTime + BET_TIME.Milliseconds()
+// StageEndTime 当前阶段的截止时间（毫秒），到达后的第一个 tick 切换阶段
+func (g *AviatorGameContext) StageEndTime() (int64, bool) {
+	return g.stageDeadline, g.stageDeadline > 0
+}
+
+func (g *AviatorGameContext) S2cChangeState(newStatus int32) {
+	now := time.Now().UnixMilli()
+	ntf := &ChangeState{
+		Code:           200,
+		NewStateID:     int(newStatus),
+		RoundID:        int64(g.RecordId),
+		StateStartTime: g.curStateStartTime,
+		ServerTime:     now,
+	}
+	if end, ok := g.StageEndTime(); ok {
+		ntf.TimeLeft = max(end-now, 0)
+		if newStatus == EAviatorStageBet {
+			ntf.BetStateEndTime = end
+		}
 	}
 	result, _ := StructToMap(ntf)
 	g.SendToAllClients("changeState", result)
 }
 
-func (g *AviatorGameContext) S2cNewBalance(player *AviatorPlayerInfo, balance float64) {
+func (g *AviatorGameContext) S2cNewBalance(player *AviatorPlayerInfo, balance Money) {
 	ntf := &NewBalance{
 		Code:       200,
 		NewBalance: balance,
@@ -673,13 +977,13 @@ func (g *AviatorGameContext) SendToAllClients(cmd string, data map[string]interf
 
 	packet := BuildSFSMessage(13, 1, p)
 	for _, player := range g.players {
-		if player.IsOffline || player.isRobot {
+		if player.IsOffline || player.isRobot || player.conn == nil {
 			continue
 		}
 
 		player.mutex.Lock()
-		defer player.mutex.Unlock()
-		player.conn.WriteMessage(websocket.BinaryMessage, packet)
+		WritePacket(player.conn, packet)
+		player.mutex.Unlock()
 	}
 }
 
@@ -693,30 +997,19 @@ func (g *AviatorGameContext) SendToClient(player *AviatorPlayerInfo, cmd string,
 
 	player.mutex.Lock()
 	defer player.mutex.Unlock()
-	player.conn.WriteMessage(websocket.BinaryMessage, packet)
-
-	println("SendToClient=", cmd, data)
-}
-
-func (g *AviatorGameContext) UpdateStatus(newStatus int32) {
-	println("UpdateStatus status=", newStatus)
-
-	g.CurStage = newStatus
-	g.curStateStartTime = time.Now().UnixMilli()
-
-	// 服务端虚拟状态不用通知
-	if newStatus == EAviatorStageCashOutAward {
+	if player.IsOffline || player.conn == nil {
 		return
-	} else {
-		g.S2cChangeState(g.CurStage)
 	}
+	WritePacket(player.conn, packet)
+
+	logWs.Debug("发送消息", "room", g.RoomId, "round", g.RecordId, "player", player.AccountId, "cmd", cmd)
 }
 
 func (g *AviatorGameContext) GenOdds(interval int64) float64 {
 	// 游戏阶段：更新倍数等
 
-	// 将tick转换为实际秒数 (tick * 0.1)
-	seconds := float64(interval/200) * 0.2
+	// 将tick转换为实际秒数 (tick * 0.1)，按房间速度缩放
+	seconds := float64(interval/200) * 0.2 * g.speed
 	// 使用新公式: y = 0.9084 * exp(0.0752 * x)
 	odds := 0.99 * math.Exp(0.0752*seconds)
 	return odds
@@ -724,16 +1017,32 @@ func (g *AviatorGameContext) GenOdds(interval int64) float64 {
 }
 
 func (g *AviatorGameContext) OnTick() {
-	now := time.Now().UnixMilli()
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	// 暂停前已触发的定时器
+	if g.paused {
+		return
+	}
+
+	start := time.Now()
+	defer observeTick(start, g.lastTickAt, g.tickInterval)
+	g.lastTickAt = start
+
+	now := start.UnixMilli()
 	interval := now - g.curStateStartTime
 
-	println("onTick ", now, interval, "stage=", g.CurStage)
+	logGame.Debug("tick", "room", g.RoomId, "round", g.RecordId, "stage", g.CurStage, "elapsedMs", interval)
 	switch g.CurStage {
 	case EAviatorStageZero:
+		if g.draining {
+			g.finishDrain()
+			return
+		}
 		g.UpdateStatus(EAviatorStageBet)
 	case EAviatorStageBet:
 		{
-			if interval > BET_TIME.Milliseconds() {
+			if now >= g.stageDeadline {
 				g.UpdateStatus(EAviatorStageCashOut)
 			} else {
 				g.AutoRobotBet()
@@ -742,18 +1051,21 @@ func (g *AviatorGameContext) OnTick() {
 		}
 	case EAviatorStageCashOut:
 		{
-			if interval > CASH_OUT_TIME.Milliseconds() {
+			oldCurMultiplier := g.CurMultiplier
+			g.CurMultiplier = FloorMultiplier(g.GenOdds(interval))
+			if g.CurMultiplier < 1.01 {
+				g.CurMultiplier = 1.01
+			}
+
+			if g.CurMultiplier >= g.crashPoint {
+				// 到达爆点，自动兑现倍数低于爆点的下注按设置的倍数兑现
+				g.CurMultiplier = g.crashPoint
+				g.AutoCashOutBelow(g.crashPoint)
 				g.DoSettle()
 			} else {
-				oldCurMultiplier := g.CurMultiplier
-				g.CurMultiplier = g.GenOdds(interval)
-				if g.CurMultiplier < 1.01 {
-					g.CurMultiplier = 1.01
-				}
-
-				//判断系统会不会输
-				sysWin := g.CacSysWin()
-				if sysWin < 0 {
+				//按风控设置判断是否提前爆炸，爆点和原因写入牌局历史
+				if reason := g.RiskStop(g.CurMultiplier); reason != "" {
+					g.riskStop = reason
 					g.CurMultiplier = oldCurMultiplier
 					g.DoSettle()
 				} else {
@@ -766,42 +1078,117 @@ func (g *AviatorGameContext) OnTick() {
 		}
 	case EAviatorStageCashOutAward:
 		{
-			if interval > CASH_OUT_TIME.Milliseconds() {
+			if g.draining {
+				g.finishDrain()
+				return
+			}
+			if now >= g.stageDeadline {
 				g.DoStart()
 				g.UpdateStatus(EAviatorStageBet)
 			}
 		}
 	}
+	g.ExpireRains(now)
 	g.S2cOnlinePlayers()
 }
 
 func (g *AviatorGameContext) DoSettle() {
 
-	println("DoSettle")
+	g.Journal(JournalEntry{Type: JournalCrash, Multiplier: g.CurMultiplier, Reason: g.riskStop}, nil)
+	g.ConsumeFreeBets()
 	g.S2cUpdateCrashX()
 	g.S2cRoundChartInfo()
+	g.SettleAutoBets()
+
+	g.endTime = time.Now().UnixMilli()
+	record := g.RoundRecord()
+	g.RecordLeaderboards(&record)
+
+	g.ClearBets()
+	g.UpdateStatus(EAviatorStageCashOutAward)
+
+	g.history.Append(record)
+	g.Journal(JournalEntry{Type: JournalSettled}, nil)
+	g.log().Info("牌局结算", "multiplier", record.Multiplier, "crashPoint", record.CrashPoint, "riskStop", record.RiskStop,
+		"bets", record.BetsCount, "totalBet", record.TotalBet, "totalCashOut", record.TotalCashOut, "settingsVersion", record.SettingsVersion)
+	metricRounds.Inc(strconv.Itoa(g.RoomId))
+	metricCrashMultiplier.Observe(record.Multiplier)
+	g.S2cRoundsInfo()
+}
 
-	//清空下注
+// RoundRecord 本局的历史记录，只包含真实玩家的下注，需在清空下注之前调用
+func (g *AviatorGameContext) RoundRecord() RoundRecord {
+	record := RoundRecord{
+		RoomId:          g.RoomId,
+		RoundId:         g.RecordId,
+		StartDate:       g.startTime,
+		EndDate:         g.endTime,
+		Multiplier:      g.CurMultiplier,
+		ServerSeed:      g.serverSeed,
+		ServerSeedHash:  SeedHash(g.serverSeed),
+		ClientSeeds:     g.clientSeeds,
+		Bets:            make([]Bet, 0),
+		SettingsVersion: g.settings.Version,
+		CrashPoint:      g.crashPoint,
+		RiskStop:        g.riskStop,
+	}
 	for _, player := range g.players {
-		player.BetList = []*PlayerBetSt{}
+		for _, bet := range player.BetList {
+			record.Bets = append(record.Bets, Bet{
+				Bet:          bet.BetValue,
+				BetID:        int(bet.BetArea),
+				IsFreeBet:    bet.isFreeBet,
+				PlayerID:     player.AccountId,
+				ProfileImage: player.ProfileImage,
+				Username:     player.Nickname,
+				Currency:     player.Currency,
+				Payout:       bet.cashOutMultiplier,
+				WinAmount:    bet.CashOut,
+				Win:          bet.hasCashOut,
+				RoundBetId:   int(bet.BetArea),
+			})
+		}
 	}
-	g.robots = map[string]*AviatorPlayerInfo{}
-	g.UpdateStatus(EAviatorStageCashOutAward)
-	g.endTime = time.Now().UnixMilli()
+	sort.Slice(record.Bets, func(i, j int) bool {
+		a, b := record.Bets[i], record.Bets[j]
+		if a.PlayerID != b.PlayerID {
+			return a.PlayerID < b.PlayerID
+		}
+		return a.BetID < b.BetID
+	})
+	record.BetsCount = len(record.Bets)
+	record.TotalBet, record.TotalCashOut = g.PlayerTotals()
+	return record
+}
+
+// PlayerTotals 真实玩家本局的下注和兑现总额，折算为主币种；机器人和免费下注的本金不计入下注
+func (g *AviatorGameContext) PlayerTotals() (totalBet Money, totalCashOut Money) {
+	for _, player := range g.players {
+		for _, bet := range player.BetList {
+			if !bet.isFreeBet {
+				totalBet += mainCurrencyAmount(bet.BetValue, player.Currency)
+			}
+			if bet.hasCashOut {
+				totalCashOut += mainCurrencyAmount(bet.CashOut, player.Currency)
+			}
+		}
+	}
+	return totalBet, totalCashOut
+}
 
-	g.LastRoundInfo = RoundInfo{
-		RoundId:        g.RecordId,
-		RoundStartDate: g.startTime,
-		RoundEndDate:   g.endTime,
-		Multiplier:     g.CurMultiplier,
+// ClearBets 清空下注，离线且没有自动下注的玩家不再保留
+func (g *AviatorGameContext) ClearBets() {
+	for key, player := range g.players {
+		player.BetList = []*PlayerBetSt{}
+		if player.IsOffline && !player.AutoBet {
+			delete(g.players, key)
+		}
 	}
+	g.robots = map[string]*AviatorPlayerInfo{}
 }
 
 func (g *AviatorGameContext) DoStart() {
-	g.LastBets = make([]Bet, len(g.CurrentBets))
-	copy(g.LastBets, g.CurrentBets)
 	g.NewGameInit()
-	g.startTime = time.Now().UnixMilli()
 }
 
 func (g *AviatorGameContext) AutoRobotBet() {
@@ -809,7 +1196,7 @@ func (g *AviatorGameContext) AutoRobotBet() {
 
 	for i := 0; i < robotCount; i++ {
 		robot := g.CreateRobot()
-		betValue := rand.Float64() * 100
+		betValue := RoundAmount(MoneyFromFloat(rand.Float64()*100), robot.Currency)
 		betId := rand.Intn(2) + 1
 
 		g.TotalBet += betValue
@@ -828,6 +1215,7 @@ func (g *AviatorGameContext) AutoRobotBet() {
 			PlayerID:     robot.AccountId,
 			ProfileImage: robot.ProfileImage,
 			Username:     robot.Nickname,
+			Currency:     robot.Currency,
 			Payout:       0,
 			WinAmount:    0,
 			Win:          false,
@@ -854,6 +1242,7 @@ func (g *AviatorGameContext) CreateRobot() *AviatorPlayerInfo {
 		IsOffline: false,
 		AccountId: fmt.Sprint(randomNum1) + "&&demo",
 		Nickname:  "demo" + fmt.Sprint(randomNum2),
+		Currency:  g.PlayerCurrency(nil),
 	}
 	return playerInfo
 }
@@ -868,51 +1257,85 @@ func (g *AviatorGameContext) AutoRobotCashOut() {
 			if bet.autoCashOut >= g.CurMultiplier {
 				continue
 			}
-			g.SetCashOut(int32(bet.BetArea), bet.BetValue, g.CurMultiplier, player)
+			winAmount := bet.WinAmount(g.CurMultiplier, player.Currency)
+			g.SetCashOut(int32(bet.BetArea), winAmount, g.CurMultiplier, player)
 
-			g.TotalCashOut += bet.BetValue * g.CurMultiplier
+			g.TotalCashOut += winAmount
 			g.CashOuts = append(g.CashOuts, CashOut{
 				BetID:      int(bet.BetArea),
 				Multiplier: g.CurMultiplier,
 				PlayerID:   player.AccountId,
-				WinAmount:  bet.BetValue * g.CurMultiplier,
+				WinAmount:  winAmount,
+				Currency:   player.Currency,
 			})
 		}
 	}
 }
 
 func (g *AviatorGameContext) AutoCashOut() {
+	g.autoCashOutUpTo(g.CurMultiplier, true)
+}
+
+// AutoCashOutBelow 到达爆点时，自动兑现倍数低于爆点的下注仍然兑现
+func (g *AviatorGameContext) AutoCashOutBelow(crashPoint float64) {
+	g.autoCashOutUpTo(crashPoint, false)
+}
+
+func (g *AviatorGameContext) autoCashOutUpTo(limit float64, inclusive bool) {
 	for _, player := range g.players {
 		for idx := range player.BetList {
 			bet := player.BetList[idx]
 			if bet.hasCashOut {
 				continue
 			}
+			// 按设置的自动兑现倍数结算；达到单人最高赢额时强制兑现
+			multiplier := 0.0
 			if bet.autoCashOut > 1 {
-				player.Balance += bet.BetValue * g.CurMultiplier
-				g.SetCashOut(int32(bet.BetArea), bet.BetValue, g.CurMultiplier, player)
-				g.TotalCashOut += bet.BetValue * g.CurMultiplier
+				multiplier = bet.autoCashOut
+			}
+			if maxWin := bet.MaxWinMultiplier(player.Currency); maxWin > 1 && (multiplier == 0 || maxWin < multiplier) {
+				multiplier = maxWin
+			}
+			if multiplier > 1 && (multiplier < limit || inclusive && multiplier == limit) {
+				winAmount := bet.WinAmount(multiplier, player.Currency)
+				if !g.JournalCashOut(player, bet, multiplier, winAmount) {
+					continue
+				}
+				g.SetCashOut(int32(bet.BetArea), winAmount, multiplier, player)
+				g.TotalCashOut += winAmount
 				g.CashOuts = append(g.CashOuts, CashOut{
 					BetID:      int(bet.BetArea),
-					Multiplier: g.CurMultiplier,
+					Multiplier: multiplier,
 					PlayerID:   player.AccountId,
-					WinAmount:  bet.BetValue * g.CurMultiplier,
+					WinAmount:  winAmount,
+					Currency:   player.Currency,
 				})
-				if player.IsOffline {
-					continue
-				}
-				g.S2cNewBalance(player, player.Balance)
 			}
 		}
 	}
 }
 
-func (g *AviatorGameContext) CacSysWin() float64 {
-	totalBet := 0.0
-	totalCashOut := 0.0
+// JournalCashOut 兑现先写流水再加钱
+func (g *AviatorGameContext) JournalCashOut(player *AviatorPlayerInfo, bet *PlayerBetSt, multiplier float64, winAmount Money) bool {
+	return g.Journal(JournalEntry{
+		Type:       JournalCashOut,
+		AccountId:  player.AccountId,
+		Currency:   player.Currency,
+		BetId:      bet.BetArea,
+		Multiplier: multiplier,
+		WinAmount:  winAmount,
+		Delta:      winAmount,
+	}, player)
+}
+
+func (g *AviatorGameContext) CacSysWin() Money {
+	totalBet := Money(0)
+	totalCashOut := Money(0)
 	for _, player := range g.players {
 		for _, bet := range player.BetList {
-			totalBet += bet.BetValue
+			if !bet.isFreeBet {
+				totalBet += bet.BetValue
+			}
 			if bet.hasCashOut {
 				totalCashOut += bet.CashOut
 			}
@@ -927,19 +1350,36 @@ func (g *AviatorGameContext) StartTimer(interval time.Duration, callback func())
 		return // 已经启动，直接返回
 	}
 	g.isRunning = true
-	g.Timer = time.NewTimer(interval)
+	timer := time.NewTimer(interval)
+	stop := make(chan struct{})
+	g.Timer = timer
+	g.timerStop = stop
 	go func() {
-		for range g.Timer.C {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-timer.C:
+			}
+			start := time.Now()
 			callback()
-			g.Timer.Reset(interval)
+			// 回调中可能已停止定时器，停止后不再续期
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// 扣除回调耗时，tick 间隔不随回调累积漂移
+			timer.Reset(max(interval-time.Since(start), 0))
 		}
 	}()
 }
 
 // StopTimer 停止定时器
 func (g *AviatorGameContext) StopTimer() {
-	if g.Timer != nil {
+	if g.Timer != nil && g.isRunning {
 		g.Timer.Stop()
+		close(g.timerStop)
 		g.isRunning = false
 	}
 }
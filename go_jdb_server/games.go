@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+// GameInfo 目录中的一款游戏，按 machineType 区分
+type GameInfo struct {
+	MachineType int    `json:"machineType"`
+	GameType    int    `json:"gameType"`
+	Name        string `json:"name"`
+	GName       string `json:"gName"` // 前端资源名，如 TreasureBowl_d65c592
+	GameGroup   []int  `json:"gameGroup"`
+	GamePass    string `json:"gamePass"`
+	Zone        string `json:"zone"`
+	GsInfo      string `json:"gsInfo"`
+	// LaunchURL 启动链接模板，可用占位符：{currency} {operator} {jurisdiction} {lang}
+	// {returnUrl} {user} {token} {gameType} {machineType} {gName}
+	LaunchURL string `json:"launchUrl"`
+}
+
+// DefaultGames 没有 games.json 时只提供当前的 Aviator 前端
+func DefaultGames() []GameInfo {
+	return []GameInfo{
+		{
+			MachineType: 14054,
+			GameType:    14,
+			Name:        "Aviator",
+			GameGroup: []int{
+				131, 7, 0, 9, 140, 12, 141, 142, 0, 0, 18, 150, 22, 30, 31, 160, 32, 161, 162, 18, 50, 55, 56, 57, 58, 59, 60, 190, 66, 67, 70, 75, 80, 81, 90, 92, 93, 120,
+			},
+			GamePass:  "2313ee4",
+			Zone:      "JDB_ZONE_GAME",
+			GsInfo:    "jdb247.net_443_0",
+			LaunchURL: "http://aviator.local.com/aviator/?currency={currency}&operator={operator}&jurisdiction={jurisdiction}&lang={lang}&return_url={returnUrl}&user={user}&token={token}",
+		},
+	}
+}
+
+// GameCatalog 游戏目录，多个前端可以同时连接同一个服务
+type GameCatalog struct {
+	games map[int]GameInfo
+}
+
+var games = NewGameCatalog(DefaultGames())
+
+func NewGameCatalog(list []GameInfo) *GameCatalog {
+	catalog := &GameCatalog{games: make(map[int]GameInfo, len(list))}
+	for _, game := range list {
+		catalog.games[game.MachineType] = game
+	}
+	return catalog
+}
+
+func LoadGameCatalog(path string) (*GameCatalog, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewGameCatalog(DefaultGames()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	list := make([]GameInfo, 0)
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("%s: no games configured", path)
+	}
+	seen := make(map[int]bool, len(list))
+	for idx := range list {
+		game := &list[idx]
+		if game.MachineType <= 0 || game.GameType <= 0 || game.LaunchURL == "" {
+			return nil, fmt.Errorf("%s: machineType, gameType and launchUrl are required", path)
+		}
+		if seen[game.MachineType] {
+			return nil, fmt.Errorf("%s: duplicate machineType %d", path, game.MachineType)
+		}
+		seen[game.MachineType] = true
+		if game.Zone == "" {
+			game.Zone = "JDB_ZONE_GAME"
+		}
+	}
+	return NewGameCatalog(list), nil
+}
+
+func (c *GameCatalog) Get(machineType int) (GameInfo, bool) {
+	game, ok := c.games[machineType]
+	return game, ok
+}
+
+// List 按 machineType 排序
+func (c *GameCatalog) List() []GameInfo {
+	list := make([]GameInfo, 0, len(c.games))
+	for _, game := range c.games {
+		list = append(list, game)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].MachineType < list[j].MachineType })
+	return list
+}
+
+// BuildLaunchURL 替换启动链接模板中的占位符，参数值按查询串转义
+func (g *GameInfo) BuildLaunchURL(params map[string]string) string {
+	pairs := make([]string, 0, 2*len(params))
+	for key, value := range params {
+		pairs = append(pairs, "{"+key+"}", url.QueryEscape(value))
+	}
+	return strings.NewReplacer(pairs...).Replace(g.LaunchURL)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// 持久化数据目录
+var DataDir = "data"
+
+const (
+	roundHistoryKeep   = 500 // 内存中保留的局数
+	roundsInfoCount    = 25  // 下发给客户端的历史倍数条数
+	roundHistoryRotate = 10 * roundHistoryKeep
+)
+
+// RoundRecord 已结束的一局
+type RoundRecord struct {
+	RoomId          int      `json:"roomId"`
+	RoundId         int      `json:"roundId"`
+	StartDate       int64    `json:"startDate"` // 毫秒时间戳
+	EndDate         int64    `json:"endDate"`   // 毫秒时间戳
+	Multiplier      float64  `json:"multiplier"`
+	ServerSeed      string   `json:"serverSeed"`
+	ServerSeedHash  string   `json:"serverSeedHash"`
+	ClientSeeds     []string `json:"clientSeeds"`
+	TotalBet        Money    `json:"totalBet"`     // 真实玩家的下注，折算为主币种，不含免费下注
+	TotalCashOut    Money    `json:"totalCashOut"` // 真实玩家的兑现，折算为主币种
+	BetsCount       int      `json:"betsCount"`
+	Bets            []Bet    `json:"bets"`           // 真实玩家的全部下注，金额为玩家币种
+	Void            bool     `json:"void,omitempty"` // 作废的局，下注已退还
+	VoidReason      string   `json:"voidReason,omitempty"`
+	SettingsVersion int      `json:"settingsVersion,omitempty"` // 本局使用的开奖设置版本
+	CrashPoint      float64  `json:"crashPoint,omitempty"`      // 由种子算出的爆点，作废的局可能为0
+	RiskStop        string   `json:"riskStop,omitempty"`        // 风控在到达爆点前提前爆炸的原因，此时 Multiplier 低于 CrashPoint
+}
+
+func (r *RoundRecord) RoundInfo() RoundInfo {
+	return RoundInfo{
+		RoundId:        r.RoundId,
+		Multiplier:     r.Multiplier,
+		RoundStartDate: r.StartDate,
+		RoundEndDate:   r.EndDate,
+	}
+}
+
+// RoundHistory 房间的牌局历史，追加写入 JSON Lines 文件
+type RoundHistory struct {
+	mutex   sync.Mutex
+	path    string
+	file    *os.File
+	lines   int
+	records []RoundRecord
+}
+
+func OpenRoundHistory(roomId int) (*RoundHistory, error) {
+	if err := os.MkdirAll(DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	h := &RoundHistory{
+		path:    filepath.Join(DataDir, fmt.Sprintf("rounds_%d.jsonl", roomId)),
+		records: make([]RoundRecord, 0, roundHistoryKeep),
+	}
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+	if h.lines > roundHistoryRotate {
+		if err := h.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	h.file = file
+	return h, nil
+}
+
+func (h *RoundHistory) load() error {
+	file, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record RoundRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// 进程崩溃时最后一行可能不完整
+			logStore.Warn("跳过损坏的牌局记录", "path", h.path, "line", h.lines+1, "err", err)
+			continue
+		}
+		h.lines++
+		h.keep(record)
+	}
+	return scanner.Err()
+}
+
+// rewrite 只保留内存中的记录，防止文件无限增长
+func (h *RoundHistory) rewrite() error {
+	tmp := h.path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for _, record := range h.records {
+		data, _ := json.Marshal(record)
+		writer.Write(data)
+		writer.WriteByte('\n')
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	h.lines = len(h.records)
+	return os.Rename(tmp, h.path)
+}
+
+func (h *RoundHistory) keep(record RoundRecord) {
+	if len(h.records) >= roundHistoryKeep {
+		h.records = append(h.records[:0], h.records[1:]...)
+	}
+	h.records = append(h.records, record)
+}
+
+// Append 记录一局，写盘失败只打印日志不影响游戏
+func (h *RoundHistory) Append(record RoundRecord) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.keep(record)
+	data, err := json.Marshal(record)
+	if err != nil {
+		logStore.Error("牌局记录序列化失败", "err", err)
+		return
+	}
+	if _, err := h.file.Write(append(data, '\n')); err != nil {
+		logStore.Error("牌局记录写入失败", "path", h.path, "err", err)
+		return
+	}
+	// 重启恢复流水时以历史判断一局是否已结束
+	if err := h.file.Sync(); err != nil {
+		logStore.Error("牌局记录写入失败", "path", h.path, "err", err)
+	}
+	h.lines++
+}
+
+// Last 最近一局
+func (h *RoundHistory) Last() (RoundRecord, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if len(h.records) == 0 {
+		return RoundRecord{}, false
+	}
+	return h.records[len(h.records)-1], true
+}
+
+// Recent 最近 n 局，最新的在前
+func (h *RoundHistory) Recent(n int) []RoundRecord {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if n > len(h.records) {
+		n = len(h.records)
+	}
+	list := make([]RoundRecord, 0, n)
+	for i := len(h.records) - 1; i >= len(h.records)-n; i-- {
+		list = append(list, h.records[i])
+	}
+	return list
+}
+
+// LastRoundId 重启后牌局号从历史继续
+func (h *RoundHistory) LastRoundId() int {
+	if last, ok := h.Last(); ok {
+		return last.RoundId
+	}
+	return 0
+}
+
+func (h *RoundHistory) Close() error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.file.Close()
+}
+
+// RoundsInfo 客户端倍数历史条，不包含作废的局
+func (h *RoundHistory) RoundsInfo(n int) []RoundsInfoItem {
+	items := make([]RoundsInfoItem, 0, n)
+	for _, record := range h.Recent(n) {
+		if record.Void {
+			continue
+		}
+		items = append(items, RoundsInfoItem{
+			MaxMultiplier: record.Multiplier,
+			RoundId:       record.RoundId,
+		})
+	}
+	return items
+}
+
+func (g *AviatorGameContext) S2cRoundsInfo() {
+	ntf := &RoundsInfo{
+		Code:       200,
+		RoundsInfo: g.history.RoundsInfo(roundsInfoCount),
+	}
+	result, _ := StructToMap(ntf)
+	g.SendToAllClients("roundsInfo", result)
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestRoundRecordExcludesRobots(t *testing.T) {
+	g := NewGameContext()
+	g.RecordId = 7
+	g.players["p1"] = &AviatorPlayerInfo{
+		AccountId: "1&&demo",
+		Currency:  MainCurrency(),
+		BetList: []*PlayerBetSt{
+			{BetArea: 1, BetValue: MoneyFromInt(10), CashOut: MoneyFromInt(25), hasCashOut: true, cashOutMultiplier: 2.5},
+			{BetArea: 2, BetValue: MoneyFromInt(5)},
+		},
+	}
+	g.players["p2"] = &AviatorPlayerInfo{
+		AccountId: "2&&demo",
+		Currency:  MainCurrency(),
+		BetList: []*PlayerBetSt{
+			{BetArea: 1, BetValue: MoneyFromInt(3), CashOut: MoneyFromInt(3), hasCashOut: true, isFreeBet: true},
+		},
+	}
+	// 机器人下注只出现在下发给客户端的列表和总额中
+	g.AutoRobotBet()
+	g.TotalCashOut += MoneyFromInt(1000)
+
+	record := g.RoundRecord()
+	if record.BetsCount != 3 || len(record.Bets) != 3 {
+		t.Fatalf("BetsCount = %d, len(Bets) = %d, want 3", record.BetsCount, len(record.Bets))
+	}
+	if want := MoneyFromInt(15); record.TotalBet != want {
+		t.Errorf("TotalBet = %v, want %v", record.TotalBet, want)
+	}
+	if want := MoneyFromInt(28); record.TotalCashOut != want {
+		t.Errorf("TotalCashOut = %v, want %v", record.TotalCashOut, want)
+	}
+	for _, bet := range record.Bets {
+		if bet.PlayerID != "1&&demo" && bet.PlayerID != "2&&demo" {
+			t.Errorf("unexpected bet from %s", bet.PlayerID)
+		}
+	}
+}
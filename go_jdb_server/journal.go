@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// 流水类型
+const (
+	JournalRound   = "round"   // 新一局开始
+	JournalStage   = "stage"   // 阶段切换
+	JournalBet     = "bet"     // 下注，扣除下注金额
+	JournalCancel  = "cancel"  // 取消下注，退还下注金额
+	JournalCashOut = "cashOut" // 兑现，增加兑现金额
+	JournalCrash   = "crash"   // 本局倍数确定，未兑现的下注输掉
+	JournalAdjust  = "adjust"  // 作废时的退款或收回
+	JournalFreeBet = "freeBet" // 结算时消耗免费下注券
+	JournalSettled = "settled" // 已写入牌局历史
+	JournalVoid    = "void"    // 已作废并写入牌局历史
+)
+
+// 红包雨流水类型，红包雨跨越多局，单独写入 data/rain_<roomId>.jsonl
+const (
+	JournalRain       = "rain"       // 发起红包雨，扣除发起人的金额；运营方红包雨不扣钱
+	JournalRainClaim  = "rainClaim"  // 领取一份
+	JournalRainRefund = "rainRefund" // 过期未领取的份额退还发起人
+	JournalRainEnd    = "rainEnd"    // 领完或过期
+)
+
+// JournalEntry 一条牌局流水，Delta 不为0时表示玩家余额变动
+type JournalEntry struct {
+	Seq        int64   `json:"seq"`
+	Time       int64   `json:"time"` // 毫秒时间戳
+	Type       string  `json:"type"`
+	RoundId    int     `json:"roundId"`
+	Stage      int32   `json:"stage,omitempty"`
+	StartDate  int64   `json:"startDate,omitempty"`
+	ServerSeed string  `json:"serverSeed,omitempty"`
+	AccountId  string  `json:"accountId,omitempty"`
+	Currency   string  `json:"currency,omitempty"`
+	BetId      int32   `json:"betId,omitempty"`
+	Bet        Money   `json:"bet,omitempty"`
+	IsFreeBet  bool    `json:"isFreeBet,omitempty"`
+	FreeBetId  string  `json:"freeBetId,omitempty"`
+	Multiplier float64 `json:"multiplier,omitempty"`
+	WinAmount  Money   `json:"winAmount,omitempty"`
+	Delta      Money   `json:"delta,omitempty"`
+	Reason     string  `json:"reason,omitempty"`
+	RainId     int64   `json:"rainId,omitempty"`
+	Policy     string  `json:"policy,omitempty"` // 作废时已兑现下注的处理策略
+}
+
+// Journal 房间的预写流水 data/journal_<roomId>.jsonl：先写流水并落盘，再修改余额和内存状态。
+// 只保存当前一局，新一局开始时清空；由游戏上下文的锁保护
+type Journal struct {
+	roomId  int
+	key     string // 钱包中记录已入账序号的键，每份流水一个
+	file    *os.File
+	nextSeq int64
+	closed  bool // 停机时已关闭，之后的写入返回 ErrJournalClosed
+}
+
+var ErrJournalClosed = errors.New("journal closed")
+
+func journalPath(roomId int) string {
+	return filepath.Join(DataDir, fmt.Sprintf("journal_%d.jsonl", roomId))
+}
+
+// OpenJournal 打开房间的牌局流水并返回其中的记录
+func OpenJournal(roomId int) (*Journal, []JournalEntry, error) {
+	return openJournal(roomId, strconv.Itoa(roomId), journalPath(roomId))
+}
+
+func openJournal(roomId int, key string, path string) (*Journal, []JournalEntry, error) {
+	if err := os.MkdirAll(DataDir, 0o755); err != nil {
+		return nil, nil, err
+	}
+	entries, err := readJournal(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, nil, err
+	}
+	j := &Journal{roomId: roomId, key: key, file: file, nextSeq: wallets.LastSeq(key) + 1}
+	if len(entries) > 0 {
+		j.nextSeq = max(j.nextSeq, entries[len(entries)-1].Seq+1)
+	}
+	return j, entries, nil
+}
+
+func readJournal(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]JournalEntry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// 写到一半崩溃的最后一行，对应的操作没有生效
+			logStore.Warn("跳过损坏的流水", "path", path, "err", err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// Append 写入一条流水并落盘，返回序号；写盘失败时返回错误，调用方不能继续修改余额
+func (j *Journal) Append(entry *JournalEntry) (int64, error) {
+	if j.closed {
+		return 0, ErrJournalClosed
+	}
+	entry.Seq = j.nextSeq
+	entry.Time = time.Now().UnixMilli()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return 0, err
+	}
+	if err := j.file.Sync(); err != nil {
+		return 0, err
+	}
+	j.nextSeq++
+	return entry.Seq, nil
+}
+
+// Record 写入流水并入账，返回序号和入账后的余额（没有余额变动时为0）。
+// 下注和发起红包雨先占用钱包余额再写流水，可用余额不足时返回 ErrInsufficientFunds，不写流水。
+// j 为nil时不写流水，直接入账
+func (j *Journal) Record(entry *JournalEntry) (int64, Money, error) {
+	stake := entry.Delta < 0 && (entry.Type == JournalBet || entry.Type == JournalRain)
+	if stake {
+		if err := wallets.Reserve(entry.AccountId, -entry.Delta); err != nil {
+			return 0, 0, err
+		}
+	}
+	seq := int64(0)
+	if j != nil {
+		var err error
+		if seq, err = j.Append(entry); err != nil {
+			if stake {
+				wallets.Unreserve(entry.AccountId, -entry.Delta)
+			}
+			return 0, 0, err
+		}
+	}
+	switch {
+	case stake:
+		return seq, wallets.Debit(j.Key(), seq, entry.AccountId, -entry.Delta), nil
+	case entry.Delta != 0:
+		return seq, wallets.Apply(j.Key(), seq, entry.AccountId, entry.Delta), nil
+	}
+	return seq, 0, nil
+}
+
+// Reset 上一局已结算或作废，清空流水；序号继续递增。
+// 余额没能落盘时保留流水，重启后按序号重放
+func (j *Journal) Reset() {
+	if err := wallets.Sync(); err != nil {
+		logStore.Error("余额未落盘，保留流水", "room", j.roomId, "journal", j.key, "err", err)
+		return
+	}
+	if err := j.file.Truncate(0); err != nil {
+		logStore.Error("流水清空失败", "room", j.roomId, "err", err)
+	}
+}
+
+// Key 钱包中记录已入账序号的键；没有流水时为空，此时 seq 为0，直接入账
+func (j *Journal) Key() string {
+	if j == nil {
+		return ""
+	}
+	return j.key
+}
+
+func (j *Journal) Close() error {
+	j.closed = true
+	return j.file.Close()
+}
+
+// Journal 写入一条本局流水；带余额变动的流水落盘后再入账并通知玩家。
+// 下注时钱包可用余额不足或流水写入失败时不入账，返回 false
+func (g *AviatorGameContext) Journal(entry JournalEntry, player *AviatorPlayerInfo) bool {
+	entry.RoundId = g.RecordId
+	seq, balance, err := g.journal.Record(&entry)
+	if errors.Is(err, ErrInsufficientFunds) {
+		g.log().Info("余额不足", "type", entry.Type, "player", entry.AccountId, "bet", entry.BetId, "err", err)
+		return false
+	}
+	if err != nil {
+		g.log().Error("流水写入失败", "type", entry.Type, "player", entry.AccountId, "err", err)
+		return false
+	}
+	logGame.Debug("流水", "room", g.RoomId, "round", g.RecordId, "seq", seq, "type", entry.Type,
+		"player", entry.AccountId, "bet", entry.BetId, "delta", entry.Delta)
+	observeJournal(&entry)
+	if entry.Delta != 0 && player != nil {
+		player.Balance = balance
+		g.S2cNewBalance(player, player.Balance)
+	}
+	return true
+}
+
+// recoveredBet 从流水中恢复的一注下注
+type recoveredBet struct {
+	JournalEntry
+	cancelled  bool
+	cashedOut  bool
+	adjusted   bool // 作废的退款已写入流水
+	multiplier float64
+	winAmount  Money
+}
+
+// RecoverJournal 启动时重放上次进程的流水：补记没有入账的余额变动；
+// 最后一局倍数已确定的补写结算，否则作废并退还未兑现的下注。
+// 作废到一半崩溃的，按原来的原因和策略继续作废，已写入退款流水的下注不再退款。
+// 结算的免费下注券标记为已使用，其余占用归还；余额落盘后才清空流水
+func RecoverJournal(roomId int, history *RoundHistory) (*Journal, error) {
+	j, entries, err := OpenJournal(roomId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.Delta != 0 {
+			wallets.Apply(j.key, entry.Seq, entry.AccountId, entry.Delta)
+		}
+	}
+
+	var round *JournalEntry
+	bets := make([]*recoveredBet, 0)
+	crashed, closed, voiding := false, false, false
+	riskStop := ""
+	multiplier := 1.0
+	reason, policy := "server restart", DefaultVoidPolicy
+	for idx := range entries {
+		entry := entries[idx]
+		switch entry.Type {
+		case JournalRound:
+			round = &entries[idx]
+			bets = bets[:0]
+			crashed, closed, voiding, multiplier = false, false, false, 1.0
+		case JournalBet:
+			bets = append(bets, &recoveredBet{JournalEntry: entry})
+		case JournalCancel, JournalCashOut, JournalAdjust:
+			for _, bet := range bets {
+				if bet.AccountId != entry.AccountId || bet.BetId != entry.BetId || bet.cancelled {
+					continue
+				}
+				switch entry.Type {
+				case JournalCancel:
+					bet.cancelled = true
+				case JournalCashOut:
+					bet.cashedOut = true
+					bet.multiplier = entry.Multiplier
+					bet.winAmount = entry.WinAmount
+				case JournalAdjust:
+					bet.adjusted = true
+				}
+			}
+			if entry.Type == JournalAdjust && !voiding {
+				voiding = true
+				reason = entry.Reason
+				if entry.Policy != "" {
+					policy = entry.Policy
+				}
+			}
+		case JournalCrash:
+			crashed = true
+			multiplier = entry.Multiplier
+			riskStop = entry.Reason
+		case JournalSettled, JournalVoid:
+			closed = true
+		}
+	}
+	if round == nil || closed {
+		return finishRecovery(j)
+	}
+
+	// 已写入历史，只是结束流水没来得及写
+	if round.RoundId <= history.LastRoundId() {
+		j.Append(&JournalEntry{Type: JournalSettled, RoundId: round.RoundId})
+		return finishRecovery(j)
+	}
+
+	record := RoundRecord{
+		RoomId:         roomId,
+		RoundId:        round.RoundId,
+		StartDate:      round.StartDate,
+		EndDate:        time.Now().UnixMilli(),
+		Multiplier:     multiplier,
+		ServerSeed:     round.ServerSeed,
+		ServerSeedHash: SeedHash(round.ServerSeed),
+		ClientSeeds:    []string{},
+		Bets:           make([]Bet, 0, len(bets)),
+		RiskStop:       riskStop,
+	}
+	for _, bet := range bets {
+		if bet.cancelled {
+			continue
+		}
+		if !bet.IsFreeBet {
+			record.TotalBet += mainCurrencyAmount(bet.Bet, bet.Currency)
+		}
+		record.TotalCashOut += mainCurrencyAmount(bet.winAmount, bet.Currency)
+		record.Bets = append(record.Bets, Bet{
+			Bet:        bet.Bet,
+			PlayerID:   bet.AccountId,
+			BetID:      int(bet.BetId),
+			IsFreeBet:  bet.IsFreeBet,
+			Currency:   bet.Currency,
+			Win:        bet.cashedOut,
+			RoundBetId: int(bet.BetId),
+			WinAmount:  bet.winAmount,
+			Payout:     bet.multiplier,
+		})
+	}
+	record.BetsCount = len(record.Bets)
+
+	if crashed && !voiding {
+		// 倍数已确定，未兑现的下注按输处理，补写结算
+		for _, bet := range bets {
+			if bet.IsFreeBet && !bet.cancelled {
+				freeBets.Consume(bet.FreeBetId, freeBetReservation(roomId, round.RoundId, bet.BetId))
+			}
+		}
+		history.Append(record)
+		if _, err := j.Append(&JournalEntry{Type: JournalSettled, RoundId: round.RoundId}); err != nil {
+			return nil, err
+		}
+		logGame.Warn("重启后补写结算", "room", roomId, "round", round.RoundId, "multiplier", multiplier)
+		return finishRecovery(j)
+	}
+
+	// 倍数未确定，作废并退还未兑现的下注
+	refunded := Money(0)
+	for _, bet := range bets {
+		if bet.cancelled {
+			continue
+		}
+		if bet.IsFreeBet {
+			key := freeBetReservation(roomId, round.RoundId, bet.BetId)
+			if !bet.cashedOut || policy == VoidReverseCashOuts {
+				freeBets.Release(bet.FreeBetId, key)
+			} else {
+				freeBets.Consume(bet.FreeBetId, key)
+			}
+		}
+		if bet.adjusted {
+			continue
+		}
+		refund, reversed := voidAdjustment(bet.Bet, bet.winAmount, bet.IsFreeBet, bet.cashedOut, policy)
+		if refund == 0 && reversed == 0 {
+			continue
+		}
+		entry := JournalEntry{
+			Type:      JournalAdjust,
+			RoundId:   round.RoundId,
+			AccountId: bet.AccountId,
+			Currency:  bet.Currency,
+			BetId:     bet.BetId,
+			Delta:     refund - reversed,
+			Reason:    reason,
+			Policy:    policy,
+		}
+		seq, err := j.Append(&entry)
+		if err != nil {
+			return nil, err
+		}
+		wallets.Apply(j.key, seq, bet.AccountId, entry.Delta)
+		refunded += mainCurrencyAmount(refund, bet.Currency)
+	}
+	record.Void = true
+	record.VoidReason = reason
+	history.Append(record)
+	if _, err := j.Append(&JournalEntry{Type: JournalVoid, RoundId: round.RoundId, Reason: reason}); err != nil {
+		return nil, err
+	}
+	logGame.Warn("未结算的牌局重启后作废", "room", roomId, "round", round.RoundId, "reason", reason, "policy", policy,
+		"refunded", refunded, "currency", MainCurrency())
+	return finishRecovery(j)
+}
+
+// finishRecovery 归还房间内剩下的免费下注占用，余额落盘后清空流水
+func finishRecovery(j *Journal) (*Journal, error) {
+	if released := freeBets.ReleaseRoom(j.roomId); released > 0 {
+		logGame.Warn("重启后归还免费下注券", "room", j.roomId, "count", released)
+	}
+	if err := wallets.Sync(); err != nil {
+		return nil, err
+	}
+	j.Reset()
+	return j, nil
+}
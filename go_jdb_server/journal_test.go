@@ -0,0 +1,336 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// journalStep 崩溃前的一条流水；applied 表示崩溃前已入账
+type journalStep struct {
+	entry   JournalEntry
+	applied bool
+}
+
+func TestRecoverJournal(t *testing.T) {
+	const (
+		p1 = "1&&demo"
+		p2 = "2&&demo"
+	)
+	bet := func(account string, betId int32, amount int64) journalStep {
+		return journalStep{JournalEntry{Type: JournalBet, AccountId: account, BetId: betId, Bet: MoneyFromInt(amount), Delta: -MoneyFromInt(amount)}, true}
+	}
+	cashOut := func(account string, betId int32, multiplier float64, win int64) journalStep {
+		return journalStep{JournalEntry{Type: JournalCashOut, AccountId: account, BetId: betId, Multiplier: multiplier, WinAmount: MoneyFromInt(win), Delta: MoneyFromInt(win)}, true}
+	}
+	adjust := func(account string, betId int32, delta int64, policy string, applied bool) journalStep {
+		return journalStep{JournalEntry{Type: JournalAdjust, AccountId: account, BetId: betId, Delta: MoneyFromInt(delta), Reason: "operator", Policy: policy}, applied}
+	}
+	round := journalStep{JournalEntry{Type: JournalRound, StartDate: 1, ServerSeed: "seed"}, false}
+
+	tests := []struct {
+		name       string
+		steps      []journalStep
+		wantDelta  map[string]int64 // 相对开户余额
+		wantRecord bool
+		wantVoid   bool
+		wantReason string
+	}{
+		{
+			name:       "crashed round is settled",
+			steps:      []journalStep{round, bet(p1, 1, 10), cashOut(p1, 1, 2, 20), bet(p2, 1, 10), {JournalEntry{Type: JournalCrash, Multiplier: 3}, false}},
+			wantDelta:  map[string]int64{p1: 10, p2: -10},
+			wantRecord: true,
+		},
+		{
+			name:       "unapplied balance change is replayed",
+			steps:      []journalStep{round, bet(p1, 1, 10), {cashOut(p1, 1, 2, 20).entry, false}, {JournalEntry{Type: JournalCrash, Multiplier: 3}, false}},
+			wantDelta:  map[string]int64{p1: 10},
+			wantRecord: true,
+		},
+		{
+			name:       "round in flight is voided",
+			steps:      []journalStep{round, bet(p1, 1, 10), bet(p2, 1, 10), cashOut(p2, 1, 1.5, 15)},
+			wantDelta:  map[string]int64{p1: 0, p2: 5},
+			wantRecord: true,
+			wantVoid:   true,
+			wantReason: "server restart",
+		},
+		{
+			name:       "crash mid-void does not refund twice",
+			steps:      []journalStep{round, bet(p1, 1, 10), bet(p2, 1, 10), adjust(p1, 1, 10, VoidKeepCashOuts, true)},
+			wantDelta:  map[string]int64{p1: 0, p2: 0},
+			wantRecord: true,
+			wantVoid:   true,
+			wantReason: "operator",
+		},
+		{
+			name:       "crash mid-void before the refund reached the wallet",
+			steps:      []journalStep{round, bet(p1, 1, 10), bet(p2, 1, 10), adjust(p1, 1, 10, VoidKeepCashOuts, false)},
+			wantDelta:  map[string]int64{p1: 0, p2: 0},
+			wantRecord: true,
+			wantVoid:   true,
+			wantReason: "operator",
+		},
+		{
+			name: "crash mid-void keeps the reverse policy",
+			steps: []journalStep{round, bet(p1, 1, 10), cashOut(p1, 1, 2.5, 25), bet(p2, 1, 10), cashOut(p2, 1, 3, 30),
+				adjust(p1, 1, -15, VoidReverseCashOuts, true)},
+			wantDelta:  map[string]int64{p1: 0, p2: 0},
+			wantRecord: true,
+			wantVoid:   true,
+			wantReason: "operator",
+		},
+		{
+			name:      "closed round is left alone",
+			steps:     []journalStep{round, bet(p1, 1, 10), {JournalEntry{Type: JournalCrash, Multiplier: 1.2}, false}, {JournalEntry{Type: JournalSettled}, false}},
+			wantDelta: map[string]int64{p1: -10},
+		},
+		{
+			name:       "cancelled bet is not refunded again",
+			steps:      []journalStep{round, bet(p1, 1, 10), {JournalEntry{Type: JournalCancel, AccountId: p1, BetId: 1, Delta: MoneyFromInt(10)}, true}},
+			wantDelta:  map[string]int64{p1: 0},
+			wantRecord: true,
+			wantVoid:   true,
+			wantReason: "server restart",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newRecoveryTestData(t)
+			history := writeTestJournal(t, tt.steps)
+
+			journal, err := RecoverJournal(1, history)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer journal.Close()
+
+			for account, delta := range tt.wantDelta {
+				if got, want := wallets.Balance(account), DemoStartBalance+MoneyFromInt(delta); got != want {
+					t.Errorf("%s balance = %v, want %v", account, got, want)
+				}
+			}
+			record, ok := history.Last()
+			if ok != tt.wantRecord {
+				t.Fatalf("history has record = %v, want %v", ok, tt.wantRecord)
+			}
+			if ok && (record.Void != tt.wantVoid || record.VoidReason != tt.wantReason) {
+				t.Errorf("record void = %v %q, want %v %q", record.Void, record.VoidReason, tt.wantVoid, tt.wantReason)
+			}
+
+			// 流水已清空，再次恢复不会重复入账
+			history2, err := OpenRoundHistory(1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer history2.Close()
+			journal.Close()
+			again, err := RecoverJournal(1, history2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer again.Close()
+			for account, delta := range tt.wantDelta {
+				if got, want := wallets.Balance(account), DemoStartBalance+MoneyFromInt(delta); got != want {
+					t.Errorf("after second recovery %s balance = %v, want %v", account, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRecoverJournalFreeBets(t *testing.T) {
+	const p1 = "1&&demo"
+	tests := []struct {
+		name          string
+		crashed       bool
+		cashedOut     bool
+		wantRemaining int
+	}{
+		{"void returns the voucher", false, false, 1},
+		{"settled round consumes the voucher", true, false, 0},
+		{"void keeps a cashed out voucher used", false, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newRecoveryTestData(t)
+			voucher, err := freeBets.Grant(p1, MoneyFromInt(5), 1, 0, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 另一局下注时的占用，流水中没有记录
+			if freeBets.Reserve(p1, MoneyFromInt(5), 0, freeBetReservation(1, 9, 2)) == nil {
+				t.Fatal("no voucher to reserve")
+			}
+			freeBets.Release(voucher.Id, freeBetReservation(1, 9, 2))
+			if freeBets.Reserve(p1, MoneyFromInt(5), 0, freeBetReservation(1, 1, 1)) == nil {
+				t.Fatal("no voucher to reserve")
+			}
+
+			steps := []journalStep{
+				{JournalEntry{Type: JournalRound, StartDate: 1, ServerSeed: "seed"}, false},
+				{JournalEntry{Type: JournalBet, AccountId: p1, BetId: 1, Bet: MoneyFromInt(5), IsFreeBet: true, FreeBetId: voucher.Id}, false},
+			}
+			if tt.cashedOut {
+				steps = append(steps, journalStep{JournalEntry{Type: JournalCashOut, AccountId: p1, BetId: 1, Multiplier: 2, WinAmount: MoneyFromInt(5), Delta: MoneyFromInt(5)}, true})
+			}
+			if tt.crashed {
+				steps = append(steps, journalStep{JournalEntry{Type: JournalCrash, Multiplier: 1.5}, false})
+			}
+			history := writeTestJournal(t, steps)
+
+			journal, err := RecoverJournal(1, history)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer journal.Close()
+			list := freeBets.List(p1)
+			if len(list) != 1 {
+				t.Fatalf("vouchers = %d, want 1", len(list))
+			}
+			if list[0].Remaining != tt.wantRemaining || len(list[0].Reserved) != 0 {
+				t.Errorf("remaining = %d reserved = %v, want %d and none", list[0].Remaining, list[0].Reserved, tt.wantRemaining)
+			}
+		})
+	}
+}
+
+func TestRecordStakeAcrossRooms(t *testing.T) {
+	newRecoveryTestData(t)
+	const account = "1&&demo"
+	wallets.Balance(account)
+
+	// 两个房间的流水共用一个钱包，各自押上全部余额
+	room1, _, err := OpenJournal(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room1.Close()
+	room2, _, err := OpenJournal(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer room2.Close()
+
+	stake := JournalEntry{Type: JournalBet, AccountId: account, BetId: 1, Bet: DemoStartBalance, Delta: -DemoStartBalance}
+	first := stake
+	if _, balance, err := room1.Record(&first); err != nil || balance != 0 {
+		t.Fatalf("first stake: balance = %s, err = %v; want 0, nil", balance, err)
+	}
+	second := stake
+	if _, _, err := room2.Record(&second); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("second stake err = %v, want ErrInsufficientFunds", err)
+	}
+	if got := wallets.Balance(account); got != 0 {
+		t.Errorf("balance = %s, want 0", got)
+	}
+
+	// 被拒绝的下注没有写入流水，重启后不会重放
+	entries, err := readJournal(journalPath(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("room 2 journal has %d entries, want 0", len(entries))
+	}
+
+	// 赢钱之后可以再次下注
+	win := JournalEntry{Type: JournalCashOut, AccountId: account, BetId: 1, Delta: MoneyFromInt(5)}
+	if _, _, err := room1.Record(&win); err != nil {
+		t.Fatal(err)
+	}
+	small := JournalEntry{Type: JournalBet, AccountId: account, BetId: 1, Bet: MoneyFromInt(5), Delta: -MoneyFromInt(5)}
+	if _, balance, err := room2.Record(&small); err != nil || balance != 0 {
+		t.Fatalf("stake after win: balance = %s, err = %v; want 0, nil", balance, err)
+	}
+}
+
+func TestWalletSyncBatchesWrites(t *testing.T) {
+	newRecoveryTestData(t)
+	const account = "1&&demo"
+	path := filepath.Join(DataDir, "wallets.json")
+	wallets.Balance(account)
+
+	// 余额变动只在内存中，Sync 之后才写盘
+	wallets.Apply("1", 1, account, MoneyFromInt(5))
+	stored, err := OpenWalletStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stored.Balance(account); got != DemoStartBalance {
+		t.Errorf("stored balance before Sync = %s, want %s", got, DemoStartBalance)
+	}
+	if err := wallets.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err = OpenWalletStore(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := stored.Balance(account), DemoStartBalance+MoneyFromInt(5); got != want {
+		t.Errorf("stored balance after Sync = %s, want %s", got, want)
+	}
+	if got := stored.LastSeq("1"); got != 1 {
+		t.Errorf("stored seq = %d, want 1", got)
+	}
+
+	// 没有变动时不重写文件
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := wallets.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Sync without changes rewrote %s", path)
+	}
+}
+
+// newRecoveryTestData 余额、免费下注券和流水都在临时目录中
+func newRecoveryTestData(t *testing.T) {
+	t.Helper()
+	dir, w, f := DataDir, wallets, freeBets
+	t.Cleanup(func() { DataDir, wallets, freeBets = dir, w, f })
+	DataDir = t.TempDir()
+	var err error
+	if wallets, err = OpenWalletStore(); err != nil {
+		t.Fatal(err)
+	}
+	if freeBets, err = OpenFreeBetLedger(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeTestJournal 按步骤写房间1的流水，模拟进程在最后一步之后崩溃，返回打开的牌局历史
+func writeTestJournal(t *testing.T, steps []journalStep) *RoundHistory {
+	t.Helper()
+	for _, step := range steps {
+		if step.entry.AccountId != "" {
+			wallets.Balance(step.entry.AccountId)
+		}
+	}
+	journal, _, err := OpenJournal(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, step := range steps {
+		entry := step.entry
+		entry.RoundId = 1
+		seq, err := journal.Append(&entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if step.applied && entry.Delta != 0 {
+			wallets.Apply(journal.Key(), seq, entry.AccountId, entry.Delta)
+		}
+	}
+	journal.Close()
+
+	history, err := OpenRoundHistory(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { history.Close() })
+	return history
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const keepAliveWriteWait = 5 * time.Second // 发送 ping 的超时
+
+// 断开原因，对应 aviator_ws_idle_disconnects_total 的 reason 标签
+const (
+	IdlePongTimeout = "pongTimeout" // 超过两个 ping 间隔没有收到任何数据
+	IdleInactive    = "inactive"    // 超过 inactivityTimeForDisconnect 没有操作
+)
+
+// connActivity 连接最后一次操作的时间（毫秒），心跳和 ping 不算操作
+type connActivity struct {
+	lastActive atomic.Int64
+}
+
+var connActivities sync.Map // *websocket.Conn -> *connActivity
+
+// markActive 玩家有操作，重新计算无操作断开的时间
+func markActive(conn *websocket.Conn) {
+	if v, ok := connActivities.Load(conn); ok {
+		v.(*connActivity).lastActive.Store(time.Now().UnixMilli())
+	}
+}
+
+// readTimeout 两个 ping 间隔内没有收到任何数据（包括 pong）即视为断线
+func readTimeout() time.Duration {
+	return 2 * serverConfig.PingInterval()
+}
+
+// extendReadDeadline 收到数据后顺延读超时
+func extendReadDeadline(conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(readTimeout()))
+}
+
+// startKeepAlive 定时发送 websocket ping 并检查无操作断开，返回的函数在连接关闭时调用
+func startKeepAlive(conn *websocket.Conn) func() {
+	activity := &connActivity{}
+	activity.lastActive.Store(time.Now().UnixMilli())
+	connActivities.Store(conn, activity)
+
+	extendReadDeadline(conn)
+	conn.SetPongHandler(func(string) error {
+		extendReadDeadline(conn)
+		return nil
+	})
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(serverConfig.PingInterval())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			if timeout := serverConfig.InactivityTimeout(); timeout > 0 {
+				idle := time.Since(time.UnixMilli(activity.lastActive.Load()))
+				if idle > timeout {
+					logWs.Info("无操作断开", "conn", connId(conn), "idleSec", int(idle.Seconds()))
+					metricWsIdleDisconnects.Inc(IdleInactive)
+					WritePacketAndClose(conn, BuildSFSMessage(SFSEventDisconnection, 0, map[string]interface{}{
+						"dr": byte(SFSDisconnectIdle),
+					}), nil)
+					return
+				}
+			}
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(keepAliveWriteWait)); err != nil {
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		connActivities.Delete(conn)
+	}
+}
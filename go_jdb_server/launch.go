@@ -0,0 +1,277 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LaunchConfig 启动链接和登录令牌的配置，签名密钥取自环境变量 LAUNCH_SECRET
+type LaunchConfig struct {
+	Operator           string `json:"operator"`
+	Jurisdiction       string `json:"jurisdiction"`
+	TimeZone           string `json:"timeZone"`
+	DefaultMachineType int    `json:"defaultMachineType"`
+	TokenTTL           int64  `json:"tokenTtl"`        // 登录令牌有效期，秒
+	OtsTTL             int64  `json:"otsTtl"`          // 一次性令牌有效期，秒
+	RequireToken       bool   `json:"requireToken"`    // 关闭时不带令牌的登录进入 GuestOperator，不能冒用真实账号
+	MaxDemoAccounts    int    `json:"maxDemoAccounts"` // 不带令牌的启动链接最多新开的试玩账号数，0 表示不限
+}
+
+// GuestOperator 未开启 requireToken 时不带令牌登录的账号都属于这个运营商，与签发令牌的账号互不相通
+const GuestOperator = "guest"
+
+func DefaultLaunchConfig() LaunchConfig {
+	return LaunchConfig{
+		Operator:           "demo",
+		Jurisdiction:       "CW",
+		TimeZone:           "Asia/Taipei",
+		DefaultMachineType: 14054,
+		TokenTTL:           24 * 3600,
+		OtsTTL:             60,
+		RequireToken:       true,
+		MaxDemoAccounts:    100000,
+	}
+}
+
+func LoadLaunchConfig(path string) (LaunchConfig, error) {
+	config := DefaultLaunchConfig()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if config.Operator == "" || config.TokenTTL <= 0 || config.OtsTTL <= 0 {
+		return config, fmt.Errorf("%s: operator, tokenTtl and otsTtl are required", path)
+	}
+	if config.Operator == GuestOperator {
+		return config, fmt.Errorf("%s: operator %q is reserved for logins without a token", path, GuestOperator)
+	}
+	if config.MaxDemoAccounts < 0 {
+		return config, fmt.Errorf("%s: maxDemoAccounts must not be negative", path)
+	}
+	return config, nil
+}
+
+var (
+	ErrTokenInvalid = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrUnknownUser  = errors.New("unknown user")
+)
+
+// LaunchClaims 登录令牌的内容
+type LaunchClaims struct {
+	UserId      int    `json:"uid"`
+	Operator    string `json:"op"`
+	Currency    string `json:"cur"`
+	MachineType int    `json:"mt"`
+	ExpiresAt   int64  `json:"exp"` // 毫秒时间戳
+}
+
+// oneTimeToken 一次性令牌，兑换一次后失效
+type oneTimeToken struct {
+	claims    LaunchClaims
+	expiresAt int64
+}
+
+// LaunchService 签发启动链接、登录令牌和一次性令牌，websocket 登录时校验
+type LaunchService struct {
+	config LaunchConfig
+	secret []byte
+	mutex  sync.Mutex
+	ots    map[string]oneTimeToken
+}
+
+var launch = NewLaunchService(DefaultLaunchConfig(), "")
+
+// NewLaunchService secret 为空时每次启动随机生成，重启后之前签发的令牌失效
+func NewLaunchService(config LaunchConfig, secret string) *LaunchService {
+	key := []byte(secret)
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	return &LaunchService{
+		config: config,
+		secret: key,
+		ots:    make(map[string]oneTimeToken),
+	}
+}
+
+func (s *LaunchService) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueToken 为玩家和游戏签发登录令牌：base64(内容).签名
+func (s *LaunchService) IssueToken(user Account, machineType int) string {
+	claims := LaunchClaims{
+		UserId:      user.UserId,
+		Operator:    user.Operator,
+		Currency:    user.Currency,
+		MachineType: machineType,
+		ExpiresAt:   time.Now().Add(time.Duration(s.config.TokenTTL) * time.Second).UnixMilli(),
+	}
+	data, _ := json.Marshal(claims)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + s.sign(payload)
+}
+
+// VerifyToken 校验签名和有效期
+func (s *LaunchService) VerifyToken(token string) (LaunchClaims, error) {
+	var claims LaunchClaims
+	payload, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(s.sign(payload))) {
+		return claims, ErrTokenInvalid
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return claims, ErrTokenInvalid
+	}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return claims, ErrTokenInvalid
+	}
+	if time.Now().UnixMilli() > claims.ExpiresAt {
+		return claims, ErrTokenExpired
+	}
+	return claims, nil
+}
+
+// Authenticate 校验令牌并取出对应的账号
+func (s *LaunchService) Authenticate(token string) (Account, LaunchClaims, error) {
+	claims, err := s.VerifyToken(token)
+	if err != nil {
+		return Account{}, claims, err
+	}
+	user, ok := accounts.Get(claims.UserId)
+	if !ok || user.Operator != claims.Operator {
+		return Account{}, claims, ErrUnknownUser
+	}
+	return user, claims, nil
+}
+
+// LaunchURL 玩家进入游戏的链接，按游戏目录中的模板生成，令牌放在 token 占位符中
+func (s *LaunchService) LaunchURL(user Account, game GameInfo, lang string, returnURL string) string {
+	return game.BuildLaunchURL(map[string]string{
+		"currency":     user.Currency,
+		"operator":     user.Operator,
+		"jurisdiction": s.config.Jurisdiction,
+		"lang":         lang,
+		"returnUrl":    returnURL,
+		"user":         fmt.Sprint(user.UserId),
+		"token":        s.IssueToken(user, game.MachineType),
+		"gameType":     fmt.Sprint(game.GameType),
+		"machineType":  fmt.Sprint(game.MachineType),
+		"gName":        game.GName,
+	})
+}
+
+// IssueOts 为已登录的令牌签发一次性令牌
+func (s *LaunchService) IssueOts(claims LaunchClaims) string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	ots := hex.EncodeToString(buf)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now().UnixMilli()
+	for key, t := range s.ots {
+		if now > t.expiresAt {
+			delete(s.ots, key)
+		}
+	}
+	s.ots[ots] = oneTimeToken{
+		claims:    claims,
+		expiresAt: now + s.config.OtsTTL*1000,
+	}
+	return ots
+}
+
+// RedeemOts 兑换一次性令牌，兑换后立即失效
+func (s *LaunchService) RedeemOts(ots string) (Account, LaunchClaims, error) {
+	s.mutex.Lock()
+	t, ok := s.ots[ots]
+	delete(s.ots, ots)
+	s.mutex.Unlock()
+
+	if !ok {
+		return Account{}, LaunchClaims{}, ErrTokenInvalid
+	}
+	if time.Now().UnixMilli() > t.expiresAt {
+		return Account{}, t.claims, ErrTokenExpired
+	}
+	user, found := accounts.Get(t.claims.UserId)
+	if !found {
+		return Account{}, t.claims, ErrUnknownUser
+	}
+	return user, t.claims, nil
+}
+
+// AuthenticateLogin websocket 登录：启动链接参数中的 token 或 ots，校验通过后用账号信息覆盖登录参数。
+// 没有带令牌时，未开启 requireToken 的环境按试玩登录处理，账号放入 GuestOperator
+func (s *LaunchService) AuthenticateLogin(obj map[string]interface{}) error {
+	params, _ := obj["p"].(map[string]interface{})
+	token, _ := params["token"].(string)
+	ots, _ := params["ots"].(string)
+
+	var user Account
+	var err error
+	switch {
+	case token != "":
+		user, _, err = s.Authenticate(token)
+	case ots != "":
+		user, _, err = s.RedeemOts(ots)
+	case s.config.RequireToken:
+		err = ErrTokenInvalid
+	default:
+		if params == nil {
+			params = make(map[string]interface{})
+			obj["p"] = params
+		}
+		params["operator"] = GuestOperator
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if params == nil {
+		params = make(map[string]interface{})
+		obj["p"] = params
+	}
+	obj["un"] = fmt.Sprint(user.UserId)
+	params["operator"] = user.Operator
+	params["currency"] = user.Currency
+	return nil
+}
+
+// TimeZoneOffset 时区的 "GMT+08:00" 写法
+func TimeZoneOffset(timeZone string) string {
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		loc = time.Local
+	}
+	_, offset := time.Now().In(loc).Zone()
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("GMT%c%02d:%02d", sign, offset/3600, offset%3600/60)
+}
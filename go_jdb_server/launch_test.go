@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAuthenticateLogin(t *testing.T) {
+	saved := accounts
+	defer func() { accounts = saved }()
+	accounts = NewAccountStore()
+	user, err := accounts.CreateDemo("demo", MainCurrency(), "UTC", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requireToken := DefaultLaunchConfig()
+	open := DefaultLaunchConfig()
+	open.RequireToken = false
+	token := NewLaunchService(requireToken, "secret").IssueToken(user, 14054)
+
+	tests := []struct {
+		name        string
+		config      LaunchConfig
+		params      map[string]interface{}
+		un          string
+		wantErr     error
+		wantAccount string
+	}{
+		{"token", requireToken, map[string]interface{}{"token": token}, "1", nil, user.AccountId()},
+		{"no token rejected by default", requireToken, map[string]interface{}{"operator": "demo"}, user.UserName, ErrTokenInvalid, ""},
+		{"bad token", open, map[string]interface{}{"token": "forged"}, "1", ErrTokenInvalid, ""},
+		{"no token is a guest", open, map[string]interface{}{"operator": "demo"}, "100000", nil, "100000&&" + GuestOperator},
+		{"no params is a guest", open, nil, "7", nil, "7&&" + GuestOperator},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj := map[string]interface{}{"un": tt.un}
+			if tt.params != nil {
+				obj["p"] = tt.params
+			}
+			err := NewLaunchService(tt.config, "secret").AuthenticateLogin(obj)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && LoginAccountId(obj) != tt.wantAccount {
+				t.Errorf("account = %s, want %s", LoginAccountId(obj), tt.wantAccount)
+			}
+		})
+	}
+}
+
+func TestCreateDemoLimitAndPersistence(t *testing.T) {
+	defer func(dir string) { DataDir = dir }(DataDir)
+	DataDir = t.TempDir()
+
+	store, err := OpenAccountStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := store.CreateDemo("demo", MainCurrency(), "UTC", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateDemo("demo", MainCurrency(), "UTC", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.CreateDemo("demo", MainCurrency(), "UTC", 2); !errors.Is(err, ErrDemoAccountLimit) {
+		t.Fatalf("third account err = %v, want ErrDemoAccountLimit", err)
+	}
+	store.Close()
+
+	reopened, err := OpenAccountStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got, ok := reopened.Get(first.UserId); !ok || got != first {
+		t.Errorf("Get(%d) = %+v %v, want %+v", first.UserId, got, ok, first)
+	}
+	if _, err := reopened.CreateDemo("demo", MainCurrency(), "UTC", 2); !errors.Is(err, ErrDemoAccountLimit) {
+		t.Errorf("limit not kept after reopen: err = %v", err)
+	}
+	next, err := reopened.CreateDemo("demo", MainCurrency(), "UTC", 0)
+	if err != nil || next.UserId != first.UserId+2 {
+		t.Errorf("next account = %d %v, want %d", next.UserId, err, first.UserId+2)
+	}
+}
+
+func TestAllowDemoAccount(t *testing.T) {
+	config := DefaultAbuseConfig()
+	config.DemoAccounts = RateLimit{Rate: 0.001, Burst: 2}
+	guard := NewAbuseGuard(config)
+	for i, want := range []bool{true, true, false} {
+		if _, ok := guard.AllowDemoAccount("10.0.0.1"); ok != want {
+			t.Errorf("attempt %d allowed = %v, want %v", i+1, ok, want)
+		}
+	}
+	if _, ok := guard.AllowDemoAccount("10.0.0.2"); !ok {
+		t.Error("another IP was limited")
+	}
+}
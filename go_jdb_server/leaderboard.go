@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 排行榜统计周期
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+	PeriodYear  = "year"
+)
+
+var leaderboardPeriods = []string{PeriodDay, PeriodMonth, PeriodYear}
+
+const leaderboardSize = 20
+
+const leaderboardFlushInterval = 10 * time.Second // 排行榜有变化时的写盘间隔
+
+// PeriodBoards 一个统计周期内的排行榜，Key 变化时清空重新统计
+type PeriodBoards struct {
+	Key       string     `json:"key"`
+	TopWins   []TopWin   `json:"topWins"`   // 按主币种赢额排序
+	HugeWins  []TopWin   `json:"hugeWins"`  // 按兑现倍数排序
+	TopRounds []TopRound `json:"topRounds"` // 按爆炸倍数排序
+}
+
+// Leaderboards 所有房间共用的排行榜，结算时增量更新，查询不扫描历史。
+// 结算时只更新内存，由后台定期写盘，停机时再写一次
+type Leaderboards struct {
+	mutex     sync.Mutex
+	saveMutex sync.Mutex // 保证写盘按顺序进行，旧数据不会覆盖新数据
+	path      string
+	dirty     bool                     // 有变化还没有写盘
+	Periods   map[string]*PeriodBoards `json:"periods"`
+}
+
+var leaderboards = NewLeaderboards()
+
+func NewLeaderboards() *Leaderboards {
+	return &Leaderboards{
+		Periods: make(map[string]*PeriodBoards),
+	}
+}
+
+// LoadLeaderboards 读取上次保存的排行榜
+func LoadLeaderboards() (*Leaderboards, error) {
+	if err := os.MkdirAll(DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	l := NewLeaderboards()
+	l.path = filepath.Join(DataDir, "leaderboards.json")
+
+	data, err := os.ReadFile(l.path)
+	if os.IsNotExist(err) {
+		go l.flushLoop()
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, l); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", l.path, err)
+	}
+	go l.flushLoop()
+	return l, nil
+}
+
+// periodKey 时间所在的统计周期
+func periodKey(period string, t time.Time) string {
+	switch period {
+	case PeriodMonth:
+		return t.Format("2006-01")
+	case PeriodYear:
+		return t.Format("2006")
+	default:
+		return t.Format("2006-01-02")
+	}
+}
+
+// boards 当前周期的排行榜，需持有锁
+func (l *Leaderboards) boards(period string, now time.Time) *PeriodBoards {
+	key := periodKey(period, now)
+	boards := l.Periods[period]
+	if boards == nil || boards.Key != key {
+		boards = &PeriodBoards{Key: key}
+		l.Periods[period] = boards
+	}
+	return boards
+}
+
+// insertTop 按 better 排序插入，只保留前 limit 项
+func insertTop[T any](list []T, item T, limit int, better func(a, b T) bool) []T {
+	idx := len(list)
+	for i := range list {
+		if better(item, list[i]) {
+			idx = i
+			break
+		}
+	}
+	if idx >= limit {
+		return list
+	}
+	list = append(list, item)
+	copy(list[idx+1:], list[idx:])
+	list[idx] = item
+	if len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+// Record 记录一局的结果和该局所有兑现的下注
+func (l *Leaderboards) Record(round TopRound, wins []TopWin) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.UnixMilli(round.EndDate)
+	for _, period := range leaderboardPeriods {
+		boards := l.boards(period, now)
+		boards.TopRounds = insertTop(boards.TopRounds, round, leaderboardSize, func(a, b TopRound) bool {
+			return a.MaxMultiplier > b.MaxMultiplier
+		})
+		for _, win := range wins {
+			boards.TopWins = insertTop(boards.TopWins, win, leaderboardSize, func(a, b TopWin) bool {
+				return a.WinAmountInMainCurrency > b.WinAmountInMainCurrency
+			})
+			boards.HugeWins = insertTop(boards.HugeWins, win, leaderboardSize, func(a, b TopWin) bool {
+				return a.Payout > b.Payout
+			})
+		}
+	}
+	l.dirty = true
+}
+
+// Flush 有变化时写盘，失败打印日志并在下次重试；只在序列化时持有锁，写盘不阻塞结算
+func (l *Leaderboards) Flush() error {
+	if l.path == "" {
+		return nil
+	}
+	l.saveMutex.Lock()
+	defer l.saveMutex.Unlock()
+
+	l.mutex.Lock()
+	if !l.dirty {
+		l.mutex.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(l)
+	l.dirty = false
+	l.mutex.Unlock()
+	if err == nil {
+		err = writeFileSync(l.path, data)
+	}
+	if err != nil {
+		logStore.Error("排行榜保存失败", "path", l.path, "err", err)
+		l.mutex.Lock()
+		l.dirty = true
+		l.mutex.Unlock()
+		return err
+	}
+	return nil
+}
+
+// flushLoop 定期把排行榜的变化写盘
+func (l *Leaderboards) flushLoop() {
+	ticker := time.NewTicker(leaderboardFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		l.Flush()
+	}
+}
+
+func (l *Leaderboards) TopWins(period string) []TopWin {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]TopWin{}, l.boards(normalizePeriod(period), time.Now()).TopWins...)
+}
+
+func (l *Leaderboards) HugeWins(period string) []TopWin {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]TopWin{}, l.boards(normalizePeriod(period), time.Now()).HugeWins...)
+}
+
+func (l *Leaderboards) TopRounds(period string) []TopRound {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return append([]TopRound{}, l.boards(normalizePeriod(period), time.Now()).TopRounds...)
+}
+
+func normalizePeriod(period string) string {
+	switch period {
+	case PeriodMonth, PeriodYear:
+		return period
+	default:
+		return PeriodDay
+	}
+}
+
+// numericPlayerId 账号 "33687&&demo" 中的数字ID
+func numericPlayerId(accountId string) int {
+	id, _ := strconv.Atoi(strings.SplitN(accountId, "&&", 2)[0])
+	return id
+}
+
+// RecordLeaderboards 结算时把本局兑现的真实玩家下注计入排行榜，需在清空下注之前调用
+func (g *AviatorGameContext) RecordLeaderboards(record *RoundRecord) {
+	round := TopRound{
+		RoundId:        record.RoundId,
+		RoundStartDate: record.StartDate,
+		EndDate:        record.EndDate,
+		MaxMultiplier:  record.Multiplier,
+		ServerSeed:     record.ServerSeed,
+		Zone:           GameZone,
+	}
+
+	wins := make([]TopWin, 0)
+	for _, player := range g.players {
+		for _, bet := range player.BetList {
+			if !bet.hasCashOut {
+				continue
+			}
+			// 排行榜按主币种排名，无法折算的不计入
+			mainWin, err := ToMainCurrency(bet.CashOut, player.Currency)
+			if err != nil {
+				g.log().Error("兑现金额无法折算为主币种，不计入排行榜", "player", player.AccountId, "err", err)
+				continue
+			}
+			wins = append(wins, TopWin{
+				MaxMultiplier:           record.Multiplier,
+				WinAmount:               bet.CashOut,
+				EndDate:                 record.EndDate,
+				Payout:                  bet.cashOutMultiplier,
+				IsFreeBet:               bet.isFreeBet,
+				ProfileImage:            player.ProfileImage,
+				Bet:                     bet.BetValue,
+				RoundBetId:              int64(record.RoundId)*10 + int64(bet.BetArea),
+				WinAmountInMainCurrency: mainWin,
+				Zone:                    GameZone,
+				Currency:                player.Currency,
+				RoundId:                 record.RoundId,
+				PlayerId:                numericPlayerId(player.AccountId),
+				Username:                player.Nickname,
+			})
+		}
+	}
+	leaderboards.Record(round, wins)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLeaderboardsFlush(t *testing.T) {
+	defer func(dir string) { DataDir = dir }(DataDir)
+	DataDir = t.TempDir()
+	path := filepath.Join(DataDir, "leaderboards.json")
+
+	l, err := LoadLeaderboards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	round := TopRound{MaxMultiplier: 12.5, EndDate: time.Now().UnixMilli(), RoundId: 7}
+	l.Record(round, nil)
+
+	// 结算时不写盘
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Record wrote %s, want it written only on Flush", path)
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadLeaderboards()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.TopRounds(PeriodDay); len(got) != 1 || got[0].RoundId != 7 {
+		t.Errorf("reloaded top rounds = %+v, want round 7", got)
+	}
+
+	// 没有变化时不重写文件
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Flush without changes rewrote %s", path)
+	}
+}
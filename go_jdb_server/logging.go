@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 日志子系统，每个子系统可以单独设置级别
+const (
+	LogMain      = "main"      // 启动、配置
+	LogWs        = "ws"        // websocket 连接和消息收发
+	LogSfs       = "sfs"       // SFS 协议编解码
+	LogGame      = "game"      // 游戏循环、下注、结算
+	LogStore     = "store"     // 持久化：余额、历史、流水等
+	LogAdmin     = "admin"     // 运营后台
+	LogHttp      = "http"      // HTTP 访问日志
+	LogTelemetry = "telemetry" // 客户端上报
+)
+
+// subsystemLog 一个子系统的日志和级别
+type subsystemLog struct {
+	level  *slog.LevelVar
+	logger *slog.Logger
+}
+
+// LogRegistry 所有子系统共用一个输出，级别分别设置
+type LogRegistry struct {
+	mutex      sync.Mutex
+	output     io.Writer
+	json       bool
+	subsystems map[string]*subsystemLog
+}
+
+var logs = &LogRegistry{output: os.Stdout, json: true, subsystems: make(map[string]*subsystemLog)}
+
+var (
+	logMain      = logs.Logger(LogMain)
+	logWs        = logs.Logger(LogWs)
+	logSfs       = logs.Logger(LogSfs)
+	logGame      = logs.Logger(LogGame)
+	logStore     = logs.Logger(LogStore)
+	logAdmin     = logs.Logger(LogAdmin)
+	logHttp      = logs.Logger(LogHttp)
+	logTelemetry = logs.Logger(LogTelemetry)
+)
+
+func (r *LogRegistry) handler(level *slog.LevelVar) slog.Handler {
+	options := &slog.HandlerOptions{Level: level}
+	if r.json {
+		return slog.NewJSONHandler(r.output, options)
+	}
+	return slog.NewTextHandler(r.output, options)
+}
+
+// Logger 子系统的日志，默认 info 级别
+func (r *LogRegistry) Logger(name string) *slog.Logger {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if sub, ok := r.subsystems[name]; ok {
+		return sub.logger
+	}
+	level := new(slog.LevelVar)
+	sub := &subsystemLog{level: level, logger: slog.New(r.handler(level)).With("subsystem", name)}
+	r.subsystems[name] = sub
+	return sub.logger
+}
+
+// SetFormat 切换输出格式 json 或 text，需在启动时、其他协程开始写日志前调用
+func (r *LogRegistry) SetFormat(format string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch format {
+	case "json", "":
+		r.json = true
+	case "text":
+		r.json = false
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+	for name, sub := range r.subsystems {
+		*sub.logger = *slog.New(r.handler(sub.level)).With("subsystem", name)
+	}
+	return nil
+}
+
+// SetLevels 解析 "info,game=debug,sfs=warn"：不带子系统的为所有子系统的默认级别
+func (r *LogRegistry) SetLevels(spec string) error {
+	levels := make(map[string]slog.Level)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			name, value = "", part
+		}
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return fmt.Errorf("invalid log level %q", part)
+		}
+		levels[strings.TrimSpace(name)] = level
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for name := range levels {
+		if _, ok := r.subsystems[name]; name != "" && !ok {
+			return fmt.Errorf("unknown log subsystem %q", name)
+		}
+	}
+	for name, sub := range r.subsystems {
+		if level, ok := levels[name]; ok {
+			sub.level.Set(level)
+		} else if level, ok := levels[""]; ok {
+			sub.level.Set(level)
+		}
+	}
+	return nil
+}
+
+// Levels 各子系统当前级别
+func (r *LogRegistry) Levels() map[string]string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	levels := make(map[string]string, len(r.subsystems))
+	for name, sub := range r.subsystems {
+		levels[name] = strings.ToLower(sub.level.Level().String())
+	}
+	return levels
+}
+
+// ginLogger HTTP 访问日志，debug 级别
+func ginLogger(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	logHttp.Debug("request",
+		"method", c.Request.Method,
+		"path", c.Request.URL.Path,
+		"status", c.Writer.Status(),
+		"latencyMs", time.Since(start).Milliseconds(),
+		"remote", c.ClientIP())
+}
+
+type LogLevelsRequest struct {
+	Levels string `json:"levels"` // 与 LOG_LEVEL 相同的写法
+}
+
+func adminGetLogLevels(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": logs.Levels()})
+}
+
+func adminSetLogLevels(c *gin.Context) {
+	var req LogLevelsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format", "detail": err.Error()})
+		return
+	}
+	err := logs.SetLevels(req.Levels)
+	audit(c, "setLogLevels", "", req, err)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": logs.Levels()})
+}
+
+// connId 日志中的连接标识
+func connId(conn *websocket.Conn) string {
+	return conn.RemoteAddr().String()
+}
@@ -2,16 +2,24 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 	"unicode/utf16"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
@@ -23,6 +31,10 @@ var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 	CheckOrigin: func(r *http.Request) bool {
+		if !serverConfig.OriginAllowed(r.Header.Get("Origin")) {
+			metricWsRejections.Inc(RejectOrigin)
+			return false
+		}
 		return true
 	},
 }
@@ -33,153 +45,398 @@ func StringToUint16Array(s string) []uint16 {
 	return utf16s
 }
 
-var g *AviatorGameContext = nil
-
 func main() {
+	if err := logs.SetFormat(os.Getenv("LOG_FORMAT")); err != nil {
+		logMain.Error("日志配置错误", "err", err)
+		os.Exit(1)
+	}
+	if err := logs.SetLevels(os.Getenv("LOG_LEVEL")); err != nil {
+		logMain.Error("日志配置错误", "err", err)
+		os.Exit(1)
+	}
+	var err error
+	serverConfig, err = LoadServerConfig(os.Args[1:])
+	if err != nil {
+		logMain.Error("服务配置错误", "err", err)
+		os.Exit(1)
+	}
+	abuseConfig, err := LoadAbuseConfig("abuse.json")
+	if err != nil {
+		logMain.Error("防刷配置读取失败", "err", err)
+		os.Exit(1)
+	}
+	abuse.SetConfig(abuseConfig)
+	if serverConfig.AnyOrigin() {
+		logMain.Warn("未限制浏览器来源，生产环境请配置 allowedOrigins")
+	}
 
-	g = NewGameContext()
-	g.Init()
-	g.NewGameInit()
+	roomConfigs, err := LoadRoomConfigs("rooms.json")
+	if err != nil {
+		logMain.Error("房间配置读取失败", "err", err)
+		os.Exit(1)
+	}
+	currencies, err = LoadCurrencies("currencies.json")
+	if err != nil {
+		logMain.Error("币种配置读取失败", "err", err)
+		os.Exit(1)
+	}
+	fxRates, err := LoadStaticFxRates("fx_rates.json")
+	if err != nil {
+		logMain.Error("汇率配置读取失败", "err", err)
+		os.Exit(1)
+	}
+	SetFxRateProvider(fxRates)
+	if err := currencies.CheckFxRates(); err != nil {
+		logMain.Error("币种缺少汇率", "err", err)
+		os.Exit(1)
+	}
 
-	r := gin.Default()
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "key", "timestamp", "x-trace-id", "x-token", "client-version", "User-Agent", "Cache-Control", "Pragma", "Expires"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	leaderboards, err = LoadLeaderboards()
+	if err != nil {
+		logMain.Error("排行榜读取失败", "err", err)
+		os.Exit(1)
+	}
+	chatSettings, err = LoadChatSettings("chat.json")
+	if err != nil {
+		logMain.Error("聊天配置读取失败", "err", err)
+		os.Exit(1)
+	}
+	chatFilter = NewProfanityFilter(chatSettings.Profanity)
+	chatModeration, err = OpenChatModeration()
+	if err != nil {
+		logMain.Error("禁言名单读取失败", "err", err)
+		os.Exit(1)
+	}
+
+	wallets, err = OpenWalletStore()
+	if err != nil {
+		logMain.Error("余额读取失败", "err", err)
+		os.Exit(1)
+	}
+	freeBets, err = OpenFreeBetLedger()
+	if err != nil {
+		logMain.Error("免费下注读取失败", "err", err)
+		os.Exit(1)
+	}
+	resultSettings, err = OpenResultSettings("result_settings.json")
+	if err != nil {
+		logMain.Error("开奖设置读取失败", "err", err)
+		os.Exit(1)
+	}
+	accounts, err = OpenAccountStore()
+	if err != nil {
+		logMain.Error("账号读取失败", "err", err)
+		os.Exit(1)
+	}
+	launchConfig, err := LoadLaunchConfig("launch.json")
+	if err != nil {
+		logMain.Error("启动配置读取失败", "err", err)
+		os.Exit(1)
+	}
+	if os.Getenv("LAUNCH_SECRET") == "" {
+		logMain.Warn("未设置 LAUNCH_SECRET，重启后已签发的令牌失效")
+	}
+	launch = NewLaunchService(launchConfig, os.Getenv("LAUNCH_SECRET"))
+	games, err = LoadGameCatalog("games.json")
+	if err != nil {
+		logMain.Error("游戏目录读取失败", "err", err)
+		os.Exit(1)
+	}
+	if _, ok := games.Get(launchConfig.DefaultMachineType); !ok {
+		logMain.Error("游戏目录中没有默认游戏", "machineType", launchConfig.DefaultMachineType)
+		os.Exit(1)
+	}
+	telemetry, err = OpenTelemetry()
+	if err != nil {
+		logMain.Error("客户端日志文件打开失败", "err", err)
+		os.Exit(1)
+	}
+	if exportURL := os.Getenv("TELEMETRY_EXPORT_URL"); exportURL != "" {
+		telemetry.AddExporter(NewHTTPExporter(exportURL))
+	}
+	adminOperators, err = LoadAdminOperators("admin_operators.json")
+	if err != nil {
+		logMain.Error("运营后台操作人配置读取失败", "err", err)
+		os.Exit(1)
+	}
+	if adminOperators.Len() == 0 {
+		logMain.Warn("未配置 admin_operators.json，运营后台拒绝所有请求")
+	}
+	auditLog, err = OpenAuditLog()
+	if err != nil {
+		logMain.Error("审计日志打开失败", "err", err)
+		os.Exit(1)
+	}
+
+	rooms, err = NewRoomManager(roomConfigs)
+	if err != nil {
+		logMain.Error("房间初始化失败", "err", err)
+		os.Exit(1)
+	}
+	rooms.Start()
+
+	if os.Getenv(gin.EnvGinMode) == "" {
+		gin.SetMode(gin.ReleaseMode)
+	}
+	r, err := serverConfig.NewRouter()
+	if err != nil {
+		logMain.Error("服务配置错误", "err", err)
+		os.Exit(1)
+	}
+
+	// 配置了 adminListen 时运营后台单独监听，否则与玩家端共用
+	a := r
+	if serverConfig.AdminListen != "" {
+		if a, err = serverConfig.NewRouter(); err != nil {
+			logMain.Error("服务配置错误", "err", err)
+			os.Exit(1)
+		}
+	}
 
 	r.GET("/websocket", wsHandler)
 	r.POST("/frontendAPI.do", reportConfigHandler)
 	r.POST("/rum", reportRumHandler)
 	r.POST("/batchLog", reportLogHandler)
-	r.POST("/cache/GetGameResultSetting", GetGameResultSetting)
+	a.POST("/cache/GetGameResultSetting", adminAuth, GetGameResultSetting)
+	a.GET("/metrics", adminAuth, metricsHandler)
+
+	admin := a.Group("/admin", adminAuth)
+	admin.GET("/freeBets", adminListFreeBets)
+	admin.POST("/freeBets", adminGrantFreeBets)
+	admin.DELETE("/freeBets/:id", adminRevokeFreeBet)
+	admin.GET("/chat/restrictions", adminListChatRestrictions)
+	admin.POST("/chat/restrictions", adminRestrictChat)
+	admin.DELETE("/chat/restrictions/:accountId", adminLiftChatRestriction)
+	admin.POST("/chat/rain", adminPromoRain)
+	admin.GET("/rooms", adminListRooms)
+	admin.GET("/rooms/:id", adminGetRoom)
+	admin.GET("/rooms/:id/players", adminListPlayers)
+	admin.POST("/rooms/:id/players/:accountId/kick", adminKickPlayer)
+	admin.POST("/rooms/:id/pause", adminPauseRoom)
+	admin.POST("/rooms/:id/resume", adminResumeRoom)
+	admin.PUT("/rooms/:id/limits", adminSetRoomLimits)
+	admin.POST("/rooms/:id/void", adminVoidRound)
+	admin.PUT("/currencies/:code/limits", adminSetCurrencyLimits)
+	admin.GET("/audit", adminAuditLog)
+	admin.GET("/telemetry/players/:accountId", adminPlayerTelemetry)
+	admin.GET("/logLevels", adminGetLogLevels)
+	admin.PUT("/logLevels", adminSetLogLevels)
 	// r.POST('https://spf-api.pgh-nmgat.com/mascot/get/notify',
 	// r.POST('https://spf-api.pgh-nmgat.com/whitelabel',
 	// r.POST('https://spf-api.pgh-nmgat.com/settinggetSetting',
 
-	fmt.Println("🚀 服务启动：")
-	fmt.Println("- WebSocket 地址：ws://localhost:3333/websocket")
-	r.Run(":3333")
-}
-func reportRumHandler(c *gin.Context) {
-	c.String(200, "1\t1")
-
+	servers := []*http.Server{{Addr: serverConfig.Listen, Handler: r}}
+	if serverConfig.AdminListen != "" {
+		servers = append(servers, &http.Server{Addr: serverConfig.AdminListen, Handler: a})
+	}
+	serveErr := make(chan error, len(servers))
+	for _, srv := range servers {
+		serverConfig.Serve(srv, serveErr)
+	}
+	logMain.Info("服务启动", "addr", serverConfig.Listen, "adminAddr", serverConfig.AdminListen,
+		"tls", serverConfig.TLS(), "websocket", serverConfig.WebsocketURL())
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		logMain.Error("HTTP 服务异常退出", "err", err)
+		exitCode = 1
+	case <-ctx.Done():
+		stop()
+	}
+	Shutdown(servers...)
+	if exitCode != 0 {
+		os.Exit(exitCode)
+	}
 }
 
-type LogEntry struct {
-	ID        string `json:"id"`
-	Namespace string `json:"namespace"`
-	Level     string `json:"level"`
-	// 你可以根据实际内容扩展其他字段
+// GameResultSettingRequest 不带 settings 时只查询，带 settings 时修改并生成新版本
+type GameResultSettingRequest struct {
+	Settings *ResultSettingsUpdate `json:"settings"`
 }
 
+// GetGameResultSetting 查询或修改开奖设置，修改在各房间下一个下注阶段生效
 func GetGameResultSetting(c *gin.Context) {
+	var req GameResultSettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format", "detail": err.Error()})
+		return
+	}
+
+	if req.Settings != nil {
+		settings, err := resultSettings.Update(*req.Settings, adminActor(c))
+		audit(c, "setGameResultSetting", fmt.Sprintf("v%d", settings.Version), req.Settings, err)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logAdmin.Info("开奖设置已更新，下一局生效", "version", settings.Version, "actor", settings.UpdatedBy)
+	}
 
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{
+		"current":  resultSettings.Current(),
+		"versions": resultSettings.History(resultSettingsKeep),
+	}})
 }
-func reportLogHandler(c *gin.Context) {
-	var logs []LogEntry
 
-	if err := c.ShouldBindJSON(&logs); err != nil {
-		c.JSON(400, gin.H{"error": "invalid JSON format", "detail": err.Error()})
-		return
-	}
+// 前端接口返回的状态码
+const (
+	FrontendStatusOK           = "0000"
+	FrontendStatusInvalidToken = "9001"
+	FrontendStatusBadRequest   = "9002"
+)
 
-	// ✅ 打印日志条数和内容做验证
-	fmt.Printf("📥 收到日志数量: %d\n", len(logs))
-	for _, log := range logs {
-		fmt.Printf("Log ID: %s, Namespace: %s, Level: %s\n", log.ID, log.Namespace, log.Level)
+// frontendToken 前端请求中的登录令牌，启动链接中为 token，旧链接为 x
+func frontendToken(c *gin.Context) string {
+	if token := c.PostForm("token"); token != "" {
+		return token
 	}
-	//返回{"data":"12 has been created."}
-	c.JSON(200, gin.H{"data": "12 has been created."})
+	return c.PostForm("x")
+}
 
+// frontendGame 请求的游戏，未指定 machineType 时取令牌中的游戏；同时带 gameType 时必须一致
+func frontendGame(c *gin.Context, claims LaunchClaims) (GameInfo, bool) {
+	machineType := claims.MachineType
+	for _, key := range []string{"machineType", "mType"} {
+		if v, err := strconv.Atoi(c.PostForm(key)); err == nil && v > 0 {
+			machineType = v
+			break
+		}
+	}
+	if machineType == 0 {
+		machineType = launch.config.DefaultMachineType
+	}
+	game, ok := games.Get(machineType)
+	if !ok {
+		return game, false
+	}
+	if gameType, err := strconv.Atoi(c.PostForm("gameType")); err == nil && gameType != game.GameType {
+		return game, false
+	}
+	return game, true
 }
 
 func reportConfigHandler(c *gin.Context) {
 	action := c.PostForm("action")
 
-	fmt.Println("🔐 收到 action:", action)
+	logHttp.Debug("frontendAPI", "action", action)
+
+	// 启动链接（20）可以不带令牌，此时新开试玩账号；其他接口都需要有效令牌
+	user, claims, err := launch.Authenticate(frontendToken(c))
+	if err != nil && action != "20" && action != "21" && action != "23" && action != "24" {
+		c.JSON(http.StatusOK, gin.H{"status": FrontendStatusInvalidToken, "err": err.Error()})
+		return
+	}
+
 	switch action {
 	case "101":
 		c.JSON(http.StatusOK, gin.H{
-			"status": "0000",
+			"status": FrontendStatusOK,
 			"data": gin.H{
-				"ots": "97a28971-122a-4559-a271-397400e9d84d",
+				"ots": launch.IssueOts(claims),
 			},
 		})
 	case "6":
 		c.JSON(http.StatusOK, gin.H{
-			"status": "0000",
+			"status": FrontendStatusOK,
 			"data": []gin.H{
 				{
-					"uid":        "demo001685@XX",
-					"userName":   "001685",
-					"lvl":        0,
-					"userStatus": 0,
-					"currency":   "XX",
-					"timeZone":   "GMT+08:00",
+					"uid":        user.Uid(),
+					"userName":   user.UserName,
+					"lvl":        user.Lvl,
+					"userStatus": user.Status,
+					"currency":   user.Currency,
+					"timeZone":   TimeZoneOffset(user.TimeZone),
 				},
 			},
 		})
 	case "20":
+		game, ok := frontendGame(c, claims)
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{"status": FrontendStatusBadRequest, "err": "unknown game"})
+			return
+		}
+		if err != nil {
+			currency := c.PostForm("currency")
+			if currency == "" {
+				currency = MainCurrency()
+			}
+			if !currencies.Supported(currency) {
+				c.JSON(http.StatusOK, gin.H{"status": FrontendStatusBadRequest, "err": "unsupported currency"})
+				return
+			}
+			if reason, ok := abuse.AllowDemoAccount(c.ClientIP()); !ok {
+				logHttp.Warn("拒绝新开试玩账号", "ip", c.ClientIP(), "reason", reason)
+				c.JSON(http.StatusOK, gin.H{"status": FrontendStatusBadRequest, "err": "too many demo accounts"})
+				return
+			}
+			user, err = accounts.CreateDemo(launch.config.Operator, currency, launch.config.TimeZone, launch.config.MaxDemoAccounts)
+			if err != nil {
+				c.JSON(http.StatusOK, gin.H{"status": FrontendStatusBadRequest, "err": err.Error()})
+				return
+			}
+			logMain.Info("新开试玩账号", "player", user.AccountId())
+		}
+		lang := c.DefaultPostForm("lang", "en")
 		c.JSON(http.StatusOK, gin.H{
-			"status": "0000",
+			"status": FrontendStatusOK,
 			"data": gin.H{
-				"url": "http://aviator.local.com/aviator/?currency=MAD&operator=demo&jurisdiction=CW&lang=pt&return_url&user=53302&token=OTf6G17K3bzYNpWc1uRqTduR2qovP1BR",
-				//"url": "http://abcd.jbp.com/?tpg2tl=1&d=1&isApp=true&gName=TreasureBowl_d65c592&lang=cn&homeUrl=&mute=0&gameType=14&mType=14042&x=e9tkQRED2CBLfk0amYQ8IuupMN-wAZcoIKYGa2P4tE2QLQjl6Qg_MmX6PUb8jPYvi0mYBom7O5nmo0unuC3eivfqG3Y3BIDC",
-				//	"url": "http://abcd.abcd.com/?tpg2tl=1&d=1&isApp=true&gName=PopPopCandy_096d45b&lang=cn&homeUrl=&mute=0&gameType=14&mType=14087&x=e9tkQRED2CClQmf9gCvFzgwjLyNIEyHpYaWaJUcxXZAYv4XExx8PPCqeD9kNReoH1u1relEAkvZBJu0EJcsF5wKTlotEyTq7",
-				//"url": "http://abcd.super.com/?tpg2tl=1&d=1&isApp=true&gName=LuckyDiamond_8dca129&lang=cn&homeUrl=&mute=0&gameType=14&mType=14054&x=e9tkQRED2CBWLS-LUoWn_VDFlws8ozYiyKUUY8aNoIitinh1Hku72QhwxKxXm9gHzAVLCNkc6pWdBRwpN3fwGN1M1OTa9tGh",
+				"url": launch.LaunchURL(user, game, lang, c.PostForm("returnUrl")),
 			},
 		})
 	case "19":
+		// 令牌只能用于签发时的游戏
+		game, ok := frontendGame(c, claims)
+		if !ok {
+			c.JSON(http.StatusOK, gin.H{"status": FrontendStatusBadRequest, "err": "unknown game"})
+			return
+		}
+		if game.MachineType != claims.MachineType {
+			c.JSON(http.StatusOK, gin.H{"status": FrontendStatusInvalidToken, "err": "token was issued for another game"})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
-			"status": "0000",
+			"status": FrontendStatusOK,
 			"data": gin.H{
 				"isShowAutoPlay": true,
 				"result4": gin.H{
-					"currency":         "XX",
-					"isDemoAccount":    true,
-					"showDemoFeatures": true,
+					"currency":         user.Currency,
+					"isDemoAccount":    user.IsDemo,
+					"showDemoFeatures": user.IsDemo,
 					"isApiAccount":     true,
 					"isShowJackpot":    false,
 					"isShowCurrency":   true,
 					"isShowDollarSign": false,
 					"decimalPoint":     2,
-					"gameGroup": []int{ //14054
-						131, 7, 0, 9, 140, 12, 141, 142, 0, 0, 18, 150, 22, 30, 31, 160, 32, 161, 162, 18, 50, 55, 56, 57, 58, 59, 60, 190, 66, 67, 70, 75, 80, 81, 90, 92, 93, 120,
-					},
-					"functionList": []string{},
+					"gameGroup":        game.GameGroup,
+					"functionList":     []string{},
 				},
 				"result6": gin.H{
-					"uid":        "demo000428@XX",
-					"userName":   "000428",
-					"lvl":        0,
-					"userStatus": 0,
-					"currency":   "XX",
+					"uid":        user.Uid(),
+					"userName":   user.UserName,
+					"lvl":        user.Lvl,
+					"userStatus": user.Status,
+					"currency":   user.Currency,
 				},
 				"result10": gin.H{
-					"status":    "0000",
+					"status":    FrontendStatusOK,
 					"sessionID": []string{"", "", "", "A", ""},
 
-					"zone":     "JDB_ZONE_GAME",
-					"gsInfo":   "jdb247.net_443_0",
-					"gameType": 14,
-
-					//  "machineType": 14042,//聚宝盆
-					//"machineType": 14087, //宝宝甜心
-					"machineType": 14054,
+					"zone":        game.Zone,
+					"gsInfo":      game.GsInfo,
+					"gameType":    game.GameType,
+					"machineType": game.MachineType,
 					"isRecovery":  false,
 					"s0":          "",
 					"s1":          "",
 					"s2":          "",
-					"s3":          "CD4414C0DB1C7818B1B9E175ADFFBC9FA5CDA709FC7815878E4D82530BDAFE4BC6A3CBE41610DDA4082A5F572CCBDF83DDD2527BB4B77464B2E147F01304A7F75E520E6EA4E55D2BB00597F9ABCF27B670E9E79272A0BC2C455B29E2CE458E2F17A6212C0BD3EC11E9867F8D66E378D6082A3B720E2A821E8C142CE6F1B1DC1C8E2E2074D9169F29CF95201512B4E266024A411F92BAE456D6BEE57909110F951CB02116DBA632719778FCEE2F44CE9ED841AA906A5AF7D51FBFB15D068F7C2BA73D0A351243C59208960186D5F5A711560B6BF472F0E370EEBC6A14612EDF669C10C84E40236744BC901F0B0E2AA906FB444CF6736D873C88BF6CBDAC6E8C0F2DFB42464D959A614FBD3ADB264BFB78BA2D090E951B845E1B7E00FAC008A2642A35E720F44EC6435B338D33B125804DE9CF33A7B42EC506DFD3E7EF27BC1C9917FADC3904014E8B3140074492E64187172A04D0A06CEBBF57EA3B0852DFB7FB2D09C1A97385601E23BE42575D8E326D65716B1DD24F07457D20232CF89447A70082593D869179A2FB0C4C9645A3217B3A27BCAD0766F4D588800E5E0B2F695C5A6E0E0B0E5398C25CF054B9D5E0B7F9417BDD97001E8DDE3777DA24F23C00CFDAB548B3E91E27A85788CE2461CC374C8F35202A6C9A1370384E3B355747D2C85010EC2C6765AB07E571320D9A40FE3172FB539D9D5A309CA1547BD53BE1B61AD0FC0F1EEE7DD1F0727DD567F4DF2E13",
-					// "s3":       "CD4414C0DB1C78180A701358764DC2753E49C01C5456222A8E4D82530BDAFE4B138D3425C162A2368E5B8E31354B29EC9E51756D2A887EDCDF7BCD82D67FA924877174E55B96280065DFD9F850681C0F70E9E79272A0BC2C455B29E2CE458E2F17A6212C0BD3EC11359573D7B5DC8B84082A3B720E2A821E7FA682E64FC4165BE31D5635679CFD8DECEBFBA665E6DF331878625875AFC8B82342E1068E535C25AF1285F0223E487D34E3873B77607F8FDEA3D1340533A6CB6DD17306B58262BFF15CCBB45CBA640B560B6BF472F0E370EEBC6A14612EDF669C10C84E40236744BC901F0B0E2AA906FB444CF6736D873C88BF6CBDAC6E8C0F29AC7924551BEFD6ACEB645832E623C488455466AE8C2203B476C9331522D85482386EDE3BD45DEB215D83E10E139114CBC4E57A57E6197788A99209EE217131A9C0E9CC41B14244505D6E90CF218329B78AFEED6EE7F8DCB79733E160923EFFC919143A5F26F1DA6F5322C99FB59B39C35F262BDC016F3410E05889F33EE1603B1E3EDC0A88BC09A3B2680270F17A7B98F201C741E6499F7ECE7FBDF1F36EF4F241BE34F6FDAD879EB51496B791603FAC538268EA71E73E00E056684E9BC07A25A1251C8EF556968E0C012E395CFDF395CA6AA045C777A36E963E636BD998409CB0328ECEB740F31905B2DA5F63B51EA8AAAE6FEF0A4CE5AAE59984E5248ED2",
-					"s4":       "",
-					"gameUid":  "demo000428@XX",
-					"gamePass": "2313ee4", //宝宝甜心
-					//"gamePass":             "b2ba01f",
+					// 登录令牌，游戏前端登录 websocket 时带回
+					"s3":                   launch.IssueToken(user, game.MachineType),
+					"s4":                   "",
+					"gameUid":              user.Uid(),
+					"gamePass":             game.GamePass,
 					"useSSL":               true,
 					"streamingUrl":         gin.H{},
 					"achievementServerUrl": "",
@@ -196,13 +453,13 @@ func reportConfigHandler(c *gin.Context) {
 		})
 	case "5":
 		c.JSON(200, gin.H{
-			"status": "0000",
+			"status": FrontendStatusOK,
 			"data": []gin.H{
 				{
-					"uid":        "demo000428@XX",
-					"userStatus": 0,
-					"ts":         1747360970322,
-					"timeZone":   "Asia/Taipei",
+					"uid":        user.Uid(),
+					"userStatus": user.Status,
+					"ts":         time.Now().UnixMilli(),
+					"timeZone":   user.TimeZone,
 					"hitJackpot": []interface{}{},
 				},
 			},
@@ -230,33 +487,68 @@ func HexForGoDeclaration(data []byte) string {
 	return fmt.Sprintf("hexData := \"%s\"", strings.ToUpper(hex.EncodeToString(data)))
 }
 func wsHandler(c *gin.Context) {
+	if shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "shutting down"})
+		return
+	}
+	ip := c.ClientIP()
+	if reason, ok := abuse.Admit(ip); !ok {
+		metricWsRejections.Inc(reason)
+		logWs.Info("拒绝连接", "remote", ip, "reason", reason)
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": reason})
+		return
+	}
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		fmt.Println("WebSocket Upgrade 错误:", err)
+		abuse.Release(nil, ip)
+		logWs.Warn("websocket 升级失败", "remote", ip, "err", err)
 		return
 	}
+	abuse.Attach(conn, ip)
+	defer abuse.Release(conn, ip)
+	conn.SetReadLimit(abuse.MaxMessageBytes())
+	defer startKeepAlive(conn)()
+	wsConns.Store(conn, struct{}{})
+	defer wsConns.Delete(conn)
 	defer conn.Close()
+	StartWriter(conn)
+	defer ReleaseConn(conn)
+	defer rooms.OnDisconnect(conn)
 
-	fmt.Println("✅ WebSocket 客户端连接成功")
+	logWs.Info("websocket 连接", "conn", connId(conn))
+	metricWsConnects.Inc()
+	metricWsConnections.Add(1)
+	defer metricWsConnections.Add(-1)
 
 	for {
 		messageType, data, err := conn.ReadMessage()
+		if errors.Is(err, websocket.ErrReadLimit) {
+			abuse.Violation(conn)
+			rejectWs(conn, RejectMessageSize)
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			metricWsIdleDisconnects.Inc(IdlePongTimeout)
+		}
 		if err != nil {
-			fmt.Println("读取消息失败:", err)
+			logWs.Info("websocket 断开", "conn", connId(conn), "err", err)
 			break
 		}
+		extendReadDeadline(conn)
+		if reason, ok := abuse.AllowMessage(conn); !ok {
+			rejectWs(conn, reason)
+			continue
+		}
 
 		if messageType == websocket.BinaryMessage {
-			fmt.Println("📥 收到二进制消息:", len(data))
-			// // //打印收到的数据
-			// fmt.Printf("字节: % x\n", data)
+			logWs.Debug("收到消息", "conn", connId(conn), "bytes", len(data))
+			if len(data) < 4 {
+				sfsDecodeError("消息长度不足", "conn", connId(conn), "bytes", len(data))
+				continue
+			}
 			// 传入 bytes.Reader，跳过前4字节
 			reader := bytes.NewReader(data[4:])
 			decoded, _ := DecodeSFSObject(reader, data[4:])
 
-			// decoded, consumed := DecodeSFSObject(data2[3:])
-			// fmt.Println("📥 consumed:", consumed)
-			//fmt.Printf("🧩 解码结果: %+v\n", decoded)
 			HandleSFSMessage(conn, decoded)
 
 		}
@@ -266,7 +558,7 @@ func wsHandler(c *gin.Context) {
 func HandleSFSMessage(conn *websocket.Conn, obj map[string]interface{}) {
 	aVal, ok := obj["a"]
 	if !ok {
-		fmt.Println("❌ 没有找到 'a' 字段")
+		sfsDecodeError("消息缺少 a 字段", "conn", connId(conn))
 		return
 	}
 
@@ -282,22 +574,25 @@ func HandleSFSMessage(conn *websocket.Conn, obj map[string]interface{}) {
 	case float64:
 		aInt = int(v)
 	default:
-		fmt.Printf("❌ 无法识别 'a' 字段类型: %T (%v)\n", v, v)
+		sfsDecodeError("无法识别 a 字段类型", "conn", connId(conn), "type", fmt.Sprintf("%T", v))
 		return
 	}
 
 	pVal, ok := obj["p"]
 	if !ok {
-		fmt.Println("❌ 没有找到 'p' 字段")
+		sfsDecodeError("消息缺少 p 字段", "conn", connId(conn), "a", aInt)
 		return
 	}
 	pMap, ok := pVal.(map[string]interface{})
 	if !ok {
-		fmt.Println("❌ 'p' 字段不是 map 类型")
+		sfsDecodeError("p 字段不是 map 类型", "conn", connId(conn), "a", aInt)
 		return
 	}
 
-	fmt.Printf("🎯 收到消息 a=%d, p内容=%+v\n", aInt, pMap)
+	logWs.Debug("收到请求", "conn", connId(conn), "a", aInt)
+	if aInt != 29 && aInt != 13 {
+		markActive(conn)
+	}
 
 	switch aInt {
 	case 0: //握手
@@ -306,14 +601,20 @@ func HandleSFSMessage(conn *websocket.Conn, obj map[string]interface{}) {
 	case 1: //登陆
 		handleLogin(conn, pMap)
 		// CallExtensionResponse(conn, pMap)
-	// case 2:
-	// 	handleJoinRoom(conn, pMap)
+	case 3: //房间列表
+		handleGetRoomList(conn, pMap)
+	case 4: //加入房间
+		handleJoinRoom(conn, pMap)
+	case 11: //设置房间变量
+		handleSetRoomVariables(conn, pMap)
+	case 14: //离开房间
+		handleLeaveRoom(conn, pMap)
 	case 29: //心跳
 		handleHeartbeat(conn, pMap)
 	case 13: //嵌套协议
 		handleCallExtension(conn, pMap)
 	default:
-		fmt.Printf("⚠️ 未知消息编号: %d\n", aInt)
+		sfsDecodeError("未知消息编号", "conn", connId(conn), "a", aInt)
 	}
 }
 
@@ -323,7 +624,7 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 
 	var fieldCount uint16
 	if err := binary.Read(reader, binary.BigEndian, &fieldCount); err != nil {
-		fmt.Println("❌ 字段数量读取失败:", err)
+		sfsDecodeError("字段数量读取失败", "err", err)
 		return result, 0
 	}
 	// fmt.Printf("📦 字段数量: %d\n", fieldCount)
@@ -337,21 +638,21 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 
 		var nameLen uint16
 		if err := binary.Read(reader, binary.BigEndian, &nameLen); err != nil {
-			fmt.Println("❌ 字段名长度读取失败:", err)
+			sfsDecodeError("字段名长度读取失败", "err", err)
 			break
 		}
 		// fmt.Printf("长度: %d 字节\n", nameLen)
 
 		nameBytes := make([]byte, nameLen)
 		if _, err := io.ReadFull(reader, nameBytes); err != nil {
-			fmt.Println("❌ 字段名读取失败:", err)
+			sfsDecodeError("字段名读取失败", "err", err)
 			break
 		}
 		fieldName := string(nameBytes)
 
 		fieldType, err := reader.ReadByte()
 		if err != nil {
-			fmt.Println("❌ 字段类型读取失败:", err)
+			sfsDecodeError("字段类型读取失败", "err", err)
 			break
 		}
 		// fmt.Printf("🔑 字段名: %s, 类型: 0x%02X\n", fieldName, fieldType)
@@ -359,11 +660,11 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 		switch fieldType {
 		case TypeNull:
 			result[fieldName] = nil
-			fmt.Println("✅ null")
+			logSfs.Debug("null 字段", "field", fieldName)
 		case TypeBool:
 			b, err := reader.ReadByte()
 			if err != nil {
-				fmt.Println("❌ bool 读取失败:", err)
+				sfsDecodeError("bool 读取失败", "err", err)
 				break
 			}
 			result[fieldName] = b != 0
@@ -372,7 +673,7 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 		case 0x02: // BYTE
 			b, err := reader.ReadByte()
 			if err != nil {
-				fmt.Println("❌ byte 读取失败:", err)
+				sfsDecodeError("byte 读取失败", "err", err)
 				break
 			}
 			result[fieldName] = b
@@ -381,7 +682,7 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 		case 0x03: // SHORT
 			var val int16
 			if err := binary.Read(reader, binary.BigEndian, &val); err != nil {
-				fmt.Println("❌ short 读取失败:", err)
+				sfsDecodeError("short 读取失败", "err", err)
 				break
 			}
 			result[fieldName] = val
@@ -389,7 +690,7 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 		case TypeInt:
 			var val int32
 			if err := binary.Read(reader, binary.BigEndian, &val); err != nil {
-				fmt.Println("❌ int 读取失败:", err)
+				sfsDecodeError("int 读取失败", "err", err)
 				break
 			}
 			result[fieldName] = val
@@ -398,7 +699,7 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 		case TypeLong:
 			var val int64
 			if err := binary.Read(reader, binary.BigEndian, &val); err != nil {
-				fmt.Println("❌ long 读取失败:", err)
+				sfsDecodeError("long 读取失败", "err", err)
 				break
 			}
 			result[fieldName] = val
@@ -407,7 +708,7 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 		case TypeFloat:
 			var val float32
 			if err := binary.Read(reader, binary.BigEndian, &val); err != nil {
-				fmt.Println("❌ float 读取失败:", err)
+				sfsDecodeError("float 读取失败", "err", err)
 				break
 			}
 			result[fieldName] = val
@@ -416,7 +717,7 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 		case TypeDouble:
 			var val float64
 			if err := binary.Read(reader, binary.BigEndian, &val); err != nil {
-				fmt.Println("❌ double 读取失败:", err)
+				sfsDecodeError("double 读取失败", "err", err)
 				break
 			}
 			result[fieldName] = val
@@ -424,12 +725,12 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 		case 0x08: // UTF_STRING
 			var strlen uint16
 			if err := binary.Read(reader, binary.BigEndian, &strlen); err != nil {
-				fmt.Println("❌ 字符串长度读取失败:", err)
+				sfsDecodeError("字符串长度读取失败", "err", err)
 				break
 			}
 			str := make([]byte, strlen)
 			if _, err := io.ReadFull(reader, str); err != nil {
-				fmt.Println("❌ 字符串读取失败:", err)
+				sfsDecodeError("字符串读取失败", "err", err)
 				break
 			}
 			result[fieldName] = string(str)
@@ -437,7 +738,7 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 		case TypeUtfStringArray:
 			var count int16
 			if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
-				fmt.Println("❌ UTF_STRING_ARRAY 长度读取失败:", err)
+				sfsDecodeError("UTF_STRING_ARRAY 长度读取失败", "err", err)
 				break
 			}
 			arr := make([]string, count)
@@ -449,12 +750,12 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 				arr[i] = string(b)
 			}
 			result[fieldName] = arr
-			fmt.Printf("✅ UTF_STRING_ARRAY: %+v\n", arr)
+			logSfs.Debug("UTF_STRING_ARRAY 字段", "field", fieldName, "len", len(arr))
 
 		case TypeIntArray:
 			var count int16
 			if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
-				fmt.Println("❌ INT_ARRAY 长度读取失败:", err)
+				sfsDecodeError("INT_ARRAY 长度读取失败", "err", err)
 				break
 			}
 			arr := make([]int32, count)
@@ -467,7 +768,7 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 		case TypeDoubleArray:
 			var count int16
 			if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
-				fmt.Println("❌ DOUBLE_ARRAY 长度读取失败:", err)
+				sfsDecodeError("DOUBLE_ARRAY 长度读取失败", "err", err)
 				break
 			}
 			arr := make([]float64, count)
@@ -483,37 +784,15 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 			result[fieldName] = subResult
 			// fmt.Printf("✅ 嵌套字段 %s 完成\n", fieldName)
 		case TypeSFSArray:
-			var count int16
-			if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
-				fmt.Println("❌ SFS_ARRAY 长度读取失败:", err)
+			arr, err := DecodeSFSArray(reader, fullData)
+			if err != nil {
+				sfsDecodeError("SFS_ARRAY 读取失败", "err", err)
 				break
 			}
-			// fmt.Printf("🔁 SFSArray 长度: %d\n", count)
-			arr := make([]interface{}, count)
-			for i := int16(0); i < count; i++ {
-				typ, err := reader.ReadByte()
-				if err != nil {
-					fmt.Println("❌ SFSArray 元素类型读取失败:", err)
-					break
-				}
-				// 👇 递归伪装字段名处理：用 index 作为临时字段名
-				fakeMap := map[string]interface{}{}
-				fakeField := fmt.Sprintf("%d", i)
-				switch typ {
-				case TypeSFSObject:
-					subStart := len(fullData) - reader.Len()
-					subObj, _ := DecodeSFSObject(reader, fullData[subStart:])
-					arr[i] = subObj
-				default:
-					reader.UnreadByte()
-					DecodeSFSObjectElement(reader, fullData, fakeField, typ, fakeMap)
-					arr[i] = fakeMap[fakeField]
-				}
-			}
 			result[fieldName] = arr
 			// fmt.Printf("✅ SFS_ARRAY: %+v\n", arr)
 		default:
-			fmt.Printf("⚠️ 不支持字段类型: 0x%02X (%s)\n", fieldType, fieldName)
+			sfsDecodeError("不支持的字段类型", "type", fieldType, "field", fieldName)
 		}
 	}
 
@@ -521,6 +800,29 @@ func DecodeSFSObject(reader *bytes.Reader, fullData []byte) (map[string]interfac
 	// fmt.Printf("✅ 解码完成, 消耗字节: %d\n", consumed)
 	return result, consumed
 }
+
+// DecodeSFSArray 解析 SFSArray，元素可以是 SFSObject 或嵌套的 SFSArray
+func DecodeSFSArray(reader *bytes.Reader, fullData []byte) ([]interface{}, error) {
+	var count int16
+	if err := binary.Read(reader, binary.BigEndian, &count); err != nil {
+		return nil, err
+	}
+	// fmt.Printf("🔁 SFSArray 长度: %d\n", count)
+	arr := make([]interface{}, count)
+	for i := int16(0); i < count; i++ {
+		typ, err := reader.ReadByte()
+		if err != nil {
+			return arr, err
+		}
+		// 👇 递归伪装字段名处理：用 index 作为临时字段名
+		fakeMap := map[string]interface{}{}
+		fakeField := fmt.Sprintf("%d", i)
+		DecodeSFSObjectElement(reader, fullData, fakeField, typ, fakeMap)
+		arr[i] = fakeMap[fakeField]
+	}
+	return arr, nil
+}
+
 func DecodeSFSObjectElement(reader *bytes.Reader, fullData []byte, fieldName string, fieldType byte, result map[string]interface{}) {
 	switch fieldType {
 	case TypeNull:
@@ -602,8 +904,12 @@ func DecodeSFSObjectElement(reader *bytes.Reader, fullData []byte, fieldName str
 		obj, _ := DecodeSFSObject(reader, fullData[subStart:])
 		result[fieldName] = obj
 
+	case TypeSFSArray:
+		arr, _ := DecodeSFSArray(reader, fullData)
+		result[fieldName] = arr
+
 	default:
-		fmt.Printf("⚠️ DecodeSFSObjectElement 暂不支持字段类型: 0x%02X\n", fieldType)
+		sfsDecodeError("数组中不支持的字段类型", "type", fieldType)
 	}
 }
 
@@ -833,12 +1139,12 @@ func BuildSFSMessage(a int16, c interface{}, p map[string]interface{}) []byte {
 			buf.WriteByte(TypeShort)
 			binary.Write(buf, binary.BigEndian, int16(v))
 		} else {
-			fmt.Printf("⚠️ c 类型 int 超出支持范围: %d，默认使用 byte=0\n", v)
+			sfsEncodeError("c 超出支持范围，使用 byte=0", "c", v)
 			buf.WriteByte(TypeByte)
 			buf.WriteByte(0)
 		}
 	default:
-		fmt.Printf("⚠️ 不支持的 c 类型: %T (%v)，默认使用 byte=0\n", v, v)
+		sfsEncodeError("不支持的 c 类型，使用 byte=0", "type", fmt.Sprintf("%T", v))
 		buf.WriteByte(TypeByte)
 		buf.WriteByte(0)
 	}
@@ -856,6 +1162,140 @@ func BuildSFSMessage(a int16, c interface{}, p map[string]interface{}) []byte {
 	return final.Bytes()
 }
 
+const (
+	wsSendQueueSize = 256             // 每个连接等待发送的封包上限，超过时断开慢速连接
+	wsWriteWait     = 5 * time.Second // 单个封包的写超时
+)
+
+var (
+	ErrConnClosed    = errors.New("connection closed")
+	ErrSendQueueFull = errors.New("send queue full")
+)
+
+// outPacket 等待发送的封包；closeConn 为 true 时发送后关闭连接，closeMsg 不为空时先发送关闭帧
+type outPacket struct {
+	data      []byte
+	closeConn bool
+	closeMsg  []byte
+}
+
+// connWriter 每个连接一个发送协程：游戏循环只把封包放入有界队列，不会因某个客户端写得慢而阻塞房间
+type connWriter struct {
+	conn   *websocket.Conn
+	queue  chan outPacket
+	stop   chan struct{}
+	once   sync.Once
+	closed atomic.Bool
+}
+
+var (
+	connWriters sync.Map       // *websocket.Conn -> *connWriter
+	wsWriters   sync.WaitGroup // 运行中的发送协程，停机时等待关闭通知发出
+)
+
+// StartWriter 连接升级后启动发送协程，连接关闭后调用 ReleaseConn
+func StartWriter(conn *websocket.Conn) {
+	w := &connWriter{conn: conn, queue: make(chan outPacket, wsSendQueueSize), stop: make(chan struct{})}
+	connWriters.Store(conn, w)
+	wsWriters.Add(1)
+	go w.run()
+}
+
+func (w *connWriter) run() {
+	defer wsWriters.Done()
+	defer func() {
+		w.closed.Store(true)
+		metricWsSendQueue.Add(-float64(len(w.queue)))
+	}()
+	for {
+		var p outPacket
+		select {
+		case <-w.stop:
+			return
+		case p = <-w.queue:
+		}
+		metricWsSendQueue.Add(-1)
+		start := time.Now()
+		w.conn.SetWriteDeadline(start.Add(wsWriteWait))
+		err := w.conn.WriteMessage(websocket.BinaryMessage, p.data)
+		metricWsSendLatency.Observe(time.Since(start).Seconds())
+		if err != nil {
+			metricWsSendErrors.Inc()
+			logWs.Info("发送失败，关闭连接", "conn", connId(w.conn), "err", err)
+			w.conn.Close()
+			return
+		}
+		if p.closeConn {
+			if p.closeMsg != nil {
+				w.conn.WriteControl(websocket.CloseMessage, p.closeMsg, time.Now().Add(time.Second))
+			}
+			w.conn.Close()
+			return
+		}
+	}
+}
+
+// enqueue 放入发送队列；队列已满说明客户端读得太慢，直接断开
+func (w *connWriter) enqueue(p outPacket) error {
+	if w.closed.Load() {
+		return ErrConnClosed
+	}
+	select {
+	case w.queue <- p:
+		metricWsSendQueue.Add(1)
+		return nil
+	default:
+		metricWsSlowClients.Inc()
+		logWs.Warn("发送队列已满，断开慢速连接", "conn", connId(w.conn), "queued", len(w.queue))
+		w.conn.Close()
+		return ErrSendQueueFull
+	}
+}
+
+// WritePacket 发送封包：放入连接的发送队列后立即返回，由发送协程按顺序写出（websocket 不支持并发写）
+func WritePacket(conn *websocket.Conn, packet []byte) error {
+	v, ok := connWriters.Load(conn)
+	if !ok {
+		return ErrConnClosed
+	}
+	return v.(*connWriter).enqueue(outPacket{data: packet})
+}
+
+// WritePacketAndClose 发送最后一个封包后关闭连接，closeMsg 不为空时在关闭前发送关闭帧
+func WritePacketAndClose(conn *websocket.Conn, packet []byte, closeMsg []byte) {
+	v, ok := connWriters.Load(conn)
+	if !ok {
+		conn.Close()
+		return
+	}
+	if err := v.(*connWriter).enqueue(outPacket{data: packet, closeConn: true, closeMsg: closeMsg}); err != nil {
+		conn.Close()
+	}
+}
+
+// WaitWriters 等待所有发送协程退出，最多等待 timeout
+func WaitWriters(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		wsWriters.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// ReleaseConn 连接关闭后停止发送协程
+func ReleaseConn(conn *websocket.Conn) {
+	if v, ok := connWriters.LoadAndDelete(conn); ok {
+		w := v.(*connWriter)
+		w.once.Do(func() { close(w.stop) })
+	}
+}
+
 // 构建嵌套的 SFSObject（二进制）
 func BuildSFSObject(obj map[string]interface{}) []byte {
 	buf := new(bytes.Buffer)
@@ -887,6 +1327,9 @@ func BuildSFSObject(obj map[string]interface{}) []byte {
 		case float64:
 			buf.WriteByte(TypeDouble)
 			binary.Write(buf, binary.BigEndian, v)
+		case Money: // 金额只在编码时转换为 double
+			buf.WriteByte(TypeDouble)
+			binary.Write(buf, binary.BigEndian, v.Float64())
 		case float32:
 			buf.WriteByte(TypeFloat)
 			binary.Write(buf, binary.BigEndian, v)
@@ -911,6 +1354,12 @@ func BuildSFSObject(obj map[string]interface{}) []byte {
 			for _, f := range v {
 				binary.Write(buf, binary.BigEndian, f) // 写入每个 float64 值
 			}
+		case []Money:
+			buf.WriteByte(TypeDoubleArray)
+			binary.Write(buf, binary.BigEndian, int16(len(v)))
+			for _, m := range v {
+				binary.Write(buf, binary.BigEndian, m.Float64())
+			}
 			// ✅ 新增支持 []int → INT_ARRAY
 		case []int:
 			buf.WriteByte(TypeIntArray)
@@ -953,7 +1402,7 @@ func BuildSFSObject(obj map[string]interface{}) []byte {
 			}
 
 		default:
-			fmt.Printf("⚠️ 暂不支持类型: %T (%v)\n", v, v)
+			sfsEncodeError("不支持的编码类型", "key", key, "type", fmt.Sprintf("%T", v))
 		}
 	}
 
@@ -966,6 +1415,8 @@ func writeSFSArray(buf *bytes.Buffer, arr []interface{}) {
 
 	for _, item := range arr {
 		switch v := item.(type) {
+		case nil:
+			buf.WriteByte(TypeNull)
 		case int:
 			buf.WriteByte(TypeInt)
 			binary.Write(buf, binary.BigEndian, int32(v))
@@ -994,6 +1445,9 @@ func writeSFSArray(buf *bytes.Buffer, arr []interface{}) {
 		case float64:
 			buf.WriteByte(TypeDouble)
 			binary.Write(buf, binary.BigEndian, v)
+		case Money:
+			buf.WriteByte(TypeDouble)
+			binary.Write(buf, binary.BigEndian, v.Float64())
 
 		case string:
 			buf.WriteByte(TypeUtfString)
@@ -1027,14 +1481,14 @@ func writeSFSArray(buf *bytes.Buffer, arr []interface{}) {
 			}
 
 		default:
-			fmt.Printf("⚠️ SFSArray中暂不支持类型: %T (%v)\n", v, v)
+			sfsEncodeError("SFSArray 中不支持的编码类型", "type", fmt.Sprintf("%T", v))
 		}
 	}
 }
 func handleHeartbeat(conn *websocket.Conn, obj map[string]interface{}) {
 	p := map[string]interface{}{}
 	packet := BuildSFSMessage(29, 0, p)
-	conn.WriteMessage(websocket.BinaryMessage, packet)
+	WritePacket(conn, packet)
 }
 func handleHandshake(conn *websocket.Conn, obj map[string]interface{}) {
 	p := map[string]interface{}{
@@ -1044,7 +1498,7 @@ func handleHandshake(conn *websocket.Conn, obj map[string]interface{}) {
 	}
 
 	packet := BuildSFSMessage(0, 0, p)
-	conn.WriteMessage(websocket.BinaryMessage, packet)
+	WritePacket(conn, packet)
 }
 func handleLogin(conn *websocket.Conn, obj map[string]interface{}) {
 
@@ -1072,62 +1526,175 @@ func handleLogin(conn *websocket.Conn, obj map[string]interface{}) {
 	// 	"rl": roomList,        // 房间列表
 	// 	"id": int32(1928827),  // 用户 ID
 	// }
-	roomList := []interface{}{
-		[]interface{}{0, "game_state", "default", false, false, false, 0, 20, []interface{}{}},
+	// 带令牌登录时校验签名，账号以令牌为准
+	if err := launch.AuthenticateLogin(obj); err != nil {
+		logWs.Warn("登录令牌校验失败", "conn", connId(conn), "err", err)
+		rejectLogin(conn, SFSErrLoginBadPassword, fmt.Sprint(obj["un"]))
+		return
+	}
+	// 币种必须受支持，并与钱包的币种一致
+	currency := LoginCurrency(obj)
+	if !currencies.Supported(currency) {
+		logWs.Warn("登录币种不受支持", "conn", connId(conn), "currency", currency)
+		rejectLogin(conn, SFSErrGeneric, currency)
+		return
+	}
+	if _, err := wallets.Open(LoginAccountId(obj), currency); err != nil {
+		logWs.Warn("登录币种与钱包不一致", "conn", connId(conn), "player", LoginAccountId(obj), "err", err)
+		rejectLogin(conn, SFSErrGeneric, currency)
+		return
 	}
+	// 没有可加入的房间时登录失败，否则客户端收不到房间初始化数据
+	room := rooms.DefaultRoom(LoginAccountId(obj), currency)
+	if room == nil {
+		logWs.Warn("没有可加入的房间", "conn", connId(conn), "player", LoginAccountId(obj), "currency", currency)
+		rejectLogin(conn, SFSErrGeneric, currency)
+		return
+	}
+	session := rooms.OnLogin(conn, obj)
+
 	// 构造返回数据 map[payload]
 	p := map[string]interface{}{
-		"rs": int16(0),                   // 登录成功
-		"zn": "aviator_core_inst2_demo1", // 区域名
-		"un": obj["un"],                  // 用户名
-		"pi": int16(0),                   // playerId
-		"rl": roomList,                   // 房间列表
-		"id": int32(1928827),             // 用户 ID
+		"rs": int16(0),         // 登录成功
+		"zn": GameZone,         // 区域名
+		"un": obj["un"],        // 用户名
+		"pi": int16(0),         // playerId
+		"rl": rooms.RoomList(), // 房间列表
+		"id": session.UserId,   // 用户 ID
 	}
 	// 构造封包并发送
 	packet := BuildSFSMessage(1, 0, p)
-	conn.WriteMessage(websocket.BinaryMessage, packet)
+	WritePacket(conn, packet)
+
+	logWs.Info("登录", "conn", connId(conn), "player", session.AccountId, "userId", session.UserId)
+	// 登录期间房间被占满等，按加入房间失败通知客户端
+	if errCode := rooms.Join(session, room, ""); errCode != 0 {
+		logWs.Warn("加入默认房间失败", "conn", connId(conn), "player", session.AccountId, "room", room.Id, "code", errCode)
+		WritePacket(conn, BuildSFSMessage(4, 0, map[string]interface{}{
+			"ec": int16(errCode),
+			"ep": []string{room.Name},
+		}))
+		return
+	}
+	rooms.Enter(session)
+}
+
+// rejectLogin 登录失败，ep 为错误参数
+func rejectLogin(conn *websocket.Conn, errCode int, param string) {
+	p := map[string]interface{}{
+		"ec": int16(errCode),
+		"ep": []string{param},
+	}
+	WritePacket(conn, BuildSFSMessage(1, 0, p))
+}
+
+// handleJoinRoom 切换房间，r 为房间ID或房间名，p 为私人桌密码
+func handleJoinRoom(conn *websocket.Conn, obj map[string]interface{}) {
+	session := rooms.Session(conn)
+	if session == nil {
+		return
+	}
+
+	var room *GameRoom
+	switch v := obj["r"].(type) {
+	case int32:
+		room = rooms.Room(int(v))
+	case int16:
+		room = rooms.Room(int(v))
+	case string:
+		room = rooms.RoomByName(v)
+	}
+	password, _ := obj["p"].(string)
+
+	errCode := SFSErrJoinBadRoom
+	if room != nil {
+		errCode = rooms.Join(session, room, password)
+	}
+	if errCode != 0 {
+		p := map[string]interface{}{
+			"ec": int16(errCode),
+			"ep": []string{fmt.Sprint(obj["r"])},
+		}
+		packet := BuildSFSMessage(4, 0, p)
+		WritePacket(conn, packet)
+		return
+	}
+
+	p := map[string]interface{}{
+		"r":  room.ToSFSArray(),
+		"ul": rooms.UserList(room),
+	}
+	packet := BuildSFSMessage(4, 0, p)
+	WritePacket(conn, packet)
+	rooms.Enter(session)
+}
+
+// handleLeaveRoom 离开房间，r 为房间ID，不传时离开当前房间
+func handleLeaveRoom(conn *websocket.Conn, obj map[string]interface{}) {
+	session := rooms.Session(conn)
+	if session == nil || session.room == nil {
+		return
+	}
+	if roomId, ok := obj["r"].(int32); ok && int(roomId) != session.room.Id {
+		return
+	}
+	rooms.Leave(session)
+}
 
-	fmt.Println("✅ 已发送 Login 响应")
-	AfterLogin(conn, obj)
-	g.OnLogin(conn, obj)
+// handleGetRoomList 返回公开房间列表及实时人数
+func handleGetRoomList(conn *websocket.Conn, obj map[string]interface{}) {
+	p := map[string]interface{}{
+		"rl": rooms.RoomList(),
+	}
+	packet := BuildSFSMessage(3, 0, p)
+	WritePacket(conn, packet)
 }
 
-func AfterLogin(conn *websocket.Conn, obj map[string]interface{}) {
+// handleSetRoomVariables 客户端设置房间变量，vl 为变量数组，服务端变量只读
+func handleSetRoomVariables(conn *websocket.Conn, obj map[string]interface{}) {
+	session := rooms.Session(conn)
+	if session == nil || session.room == nil {
+		return
+	}
+	if roomId, ok := obj["r"].(int32); ok && int(roomId) != session.room.Id {
+		return
+	}
+
+	vl, _ := obj["vl"].([]interface{})
+	vars := make([]RoomVariable, 0, len(vl))
+	for _, item := range vl {
+		arr, ok := item.([]interface{})
+		if !ok {
+			continue
+		}
+		if v, ok := RoomVariableFromSFSArray(arr); ok {
+			vars = append(vars, v)
+		}
+	}
+	rooms.SetRoomVariables(session.room, vars, false)
+}
+
+func AfterLogin(conn *websocket.Conn, obj map[string]interface{}, room *GameRoom) {
+	currency := room.g.PlayerCurrency(obj)
+	limits := room.g.LimitsFor(currency)
+	roundsInfo, _ := StructToMap(&RoundsInfo{
+		RoundsInfo: room.g.history.RoundsInfo(roundsInfoCount),
+	})
+	freeBetsInfo, _ := StructToMap(&ActiveFreeBetsInfo{
+		ActiveFreeBetsInfo: freeBets.ActiveInfo(LoginAccountId(obj)),
+	})
+	chatConfig, _ := StructToMap(&chatSettings.Chat)
+	accountId := LoginAccountId(obj)
+	snapshot, _ := StructToMap(room.g.LoginSnapshot(accountId))
+
 	p := map[string]interface{}{
 		"c": "init",
 		"p": map[string]interface{}{
-			"roundsInfo": []map[string]interface{}{
-				{"maxMultiplier": 2.25, "roundId": 8241979},
-				{"maxMultiplier": 1.35, "roundId": 8241977},
-				{"maxMultiplier": 1.37, "roundId": 8241974},
-				{"maxMultiplier": 1.0, "roundId": 8241972},
-				{"maxMultiplier": 2.83, "roundId": 8241969},
-				{"maxMultiplier": 2.37, "roundId": 8241965},
-				{"maxMultiplier": 2.52, "roundId": 8241964},
-				{"maxMultiplier": 1.0, "roundId": 8241963},
-				{"maxMultiplier": 4.41, "roundId": 8241960},
-				{"maxMultiplier": 1.74, "roundId": 8241958},
-				{"maxMultiplier": 1.98, "roundId": 8241955},
-				{"maxMultiplier": 1.03, "roundId": 8241954},
-				{"maxMultiplier": 2.41, "roundId": 8241952},
-				{"maxMultiplier": 1.52, "roundId": 8241951},
-				{"maxMultiplier": 1.45, "roundId": 8241949},
-				{"maxMultiplier": 2.37, "roundId": 8241946},
-				{"maxMultiplier": 1.29, "roundId": 8241944},
-				{"maxMultiplier": 1.12, "roundId": 8241943},
-				{"maxMultiplier": 18.16, "roundId": 8241939},
-				{"maxMultiplier": 1.0, "roundId": 8241938},
-				{"maxMultiplier": 1.8, "roundId": 8241937},
-				{"maxMultiplier": 4.05, "roundId": 8241935},
-				{"maxMultiplier": 178.86, "roundId": 8241931},
-				{"maxMultiplier": 1.73, "roundId": 8241928},
-				{"maxMultiplier": 1.77, "roundId": 8241926},
-			},
+			"roundsInfo":         roundsInfo["roundsInfo"],
 			"code":               200,
-			"activeBets":         []interface{}{}, // 空 SFSArray
-			"activeFreeBetsInfo": []interface{}{}, // 空 SFSArray
-			"onlinePlayers":      1329,
+			"activeBets":         snapshot["activeBets"],
+			"activeFreeBetsInfo": freeBetsInfo["activeFreeBetsInfo"],
+			"onlinePlayers":      snapshot["activePlayersCount"],
 			"user": map[string]interface{}{
 				"settings": map[string]interface{}{
 					"music":     false,
@@ -1135,15 +1702,15 @@ func AfterLogin(conn *websocket.Conn, obj map[string]interface{}) {
 					"secondBet": true,
 					"animation": true,
 				},
-				"balance":      5000.0,
+				"balance":      wallets.Balance(accountId),
 				"profileImage": "av-21.png",
-				"userId":       "33687&&demo",
-				"username":     "demo_71815",
+				"userId":       accountId,
+				"username":     LoginNickname(obj),
 			},
 			"config": map[string]interface{}{
 				"isAutoBetFeatureEnabled":        true,
-				"betPrecision":                   2,
-				"maxBet":                         1000.0,
+				"betPrecision":                   limits.Precision,
+				"maxBet":                         limits.MaxBet,
 				"isAlderneyModalShownOnInit":     false,
 				"isCurrencyNameHidden":           false,
 				"isLoginTimer":                   false,
@@ -1152,29 +1719,29 @@ func AfterLogin(conn *websocket.Conn, obj map[string]interface{}) {
 				"betInputStep":                   1.0,
 				"autoBetOptions": map[string]interface{}{
 					"decreaseOrExceedStopPointReq": true,
-					"numberOfRounds":               []int{10, 20, 50, 100},
+					"numberOfRounds":               AutoBetRoundOptions,
 				},
 				"isGameRulesHaveMaxWin":            false,
 				"isBetsHistoryStartBalanceEnabled": false,
 				"isMaxUserMultiplierEnabled":       false,
 				"isShowActivePlayersWidget":        true,
 				"backToHomeActionType":             "navigate",
-				"inactivityTimeForDisconnect":      0,
+				"inactivityTimeForDisconnect":      serverConfig.InactivityTimeForDisconnect,
 				"isActiveGameFocused":              false,
 				"isNetSessionEnabled":              false,
-				"fullBetTime":                      5000,
-				"minBet":                           1.0,
+				"fullBetTime":                      BET_TIME.Milliseconds(),
+				"minBet":                           limits.MinBet,
 				"isGameRulesHaveMinimumBankValue":  false,
 				"isShowTotalWinWidget":             true,
 				"isShowBetControlNumber":           false,
-				"betOptions":                       []float64{10, 20, 50, 100},
+				"betOptions":                       limits.BetOptions,
 				"modalShownOnInit":                 "none",
 				"isLiveBetsAndStatisticsHidden":    false,
 				"onLockUIActions":                  "cancelBet",
 				"isEmbeddedVideoHidden":            false,
 				"isBetTimerBranded":                true,
-				"defaultBetValue":                  1.0,
-				"maxUserWin":                       100000.0,
+				"defaultBetValue":                  limits.DefaultBetValue,
+				"maxUserWin":                       limits.MaxUserWin,
 				"isUseMaskedUsername":              true,
 				"isShowWinAmountUntilNextRound":    false,
 				"multiplierPrecision":              2,
@@ -1188,61 +1755,60 @@ func AfterLogin(conn *websocket.Conn, obj map[string]interface{}) {
 					"isExternalChatEnabled": false,
 				},
 				"isFreeBetsEnabled":                true,
-				"pingIntervalMs":                   15000,
+				"pingIntervalMs":                   serverConfig.PingIntervalMs,
 				"isLogoUrlHidden":                  false,
 				"chatApiVersion":                   2,
-				"currency":                         "MAD",
+				"currency":                         currency,
 				"showCrashExampleInRules":          false,
 				"isPodSelectAvailable":             true,
-				"returnToPlayer":                   97,
+				"returnToPlayer":                   resultSettings.Current().Rtp,
 				"isBalanceValidationEnabled":       true,
 				"isHolidayTheme":                   false,
 				"isGameRulesHaveMultiplierFormula": false,
 				"accountHistoryActionType":         "navigate",
-				"chat": map[string]interface{}{
-					"promo": map[string]interface{}{
-						"isEnabled": true,
-					},
-					"rain": map[string]interface{}{
-						"isEnabled":         false,
-						"rainMinBet":        1.0,
-						"defaultNumOfUsers": 5,
-						"minNumOfUsers":     3,
-						"maxNumOfUsers":     10,
-						"rainMaxBet":        100.0,
-					},
-					"isGifsEnabled":    true,
-					"sendMessageDelay": 5000.0,
-					"isEnabled":        false,
-					"maxMessages":      70,
-					"maxMessageLength": 160,
-				},
-				"ircDisplayType":           "modal",
-				"gameRulesAutoCashOutType": "default",
+				"chat":                             chatConfig,
+				"ircDisplayType":                   "modal",
+				"gameRulesAutoCashOutType":         "default",
 			},
-			"roundId":           8241983,
-			"stageId":           2,
-			"currentMultiplier": 1.17,
+			"roundId":           snapshot["roundId"],
+			"stageId":           snapshot["stageId"],
+			"currentMultiplier": snapshot["currentMultiplier"],
 		},
 	}
 
 	packet := BuildSFSMessage(13, 1, p)
-	conn.WriteMessage(websocket.BinaryMessage, packet)
+	WritePacket(conn, packet)
 }
 func handleCallExtension(conn *websocket.Conn, obj map[string]interface{}) {
 	// 从 obj 中提取扩展名、参数、请求ID
 	cmd, _ := obj["c"].(string)
 	params, _ := obj["p"].(map[string]interface{})
 
-	fmt.Printf("📨 CallExtension: cmd=%s, reqId=%v, params=%v\n", cmd, params)
+	logWs.Debug("扩展请求", "conn", connId(conn), "cmd", cmd)
+	accountId := ""
+	if session := rooms.Session(conn); session != nil {
+		accountId = session.AccountId
+	}
+	if !abuse.AllowCommand(conn, accountId, cmd) {
+		rejectWs(conn, RejectRateLimit)
+		return
+	}
 
 	switch cmd {
 	case "GEN_HEARTBEAT":
 		handleGENHeartbeat(conn, params)
 	case "PING_REQUEST":
-		//handlePingRequest(conn, params)
+		handlePingRequest(conn, params)
+	case "CLOCK_SYNC":
+		handleClockSync(conn, params)
 	default:
-		g.OnRecv(conn, obj)
+		markActive(conn)
+		room := rooms.RoomOf(conn)
+		if room == nil {
+			logWs.Warn("未加入房间", "conn", connId(conn), "cmd", cmd)
+			return
+		}
+		room.g.OnRecv(conn, obj)
 		//fmt.Printf("⚠️ 未知扩展命令: %s\n", cmd)
 	}
 }
@@ -1250,19 +1816,45 @@ func handleCallExtension(conn *websocket.Conn, obj map[string]interface{}) {
 func handleGENHeartbeat(conn *websocket.Conn, obj map[string]interface{}) {
 	p := map[string]interface{}{
 		"p": map[string]interface{}{
-			"heartbeat": int64(1747365913855),
+			"heartbeat": time.Now().UnixMilli(),
 		},
 		"c": "heartbeat",
 	}
 	packet := BuildSFSMessage(13, 1, p)
-	conn.WriteMessage(websocket.BinaryMessage, packet)
+	WritePacket(conn, packet)
 }
 
+// handleClockSync 时钟同步（类似 NTP）：客户端连续发送若干次，取往返时间最短的一次的偏移，
+// 换算服务器时间后再绘制倒计时和倍数曲线
+func handleClockSync(conn *websocket.Conn, obj map[string]interface{}) {
+	receiveTime := time.Now().UnixMilli()
+	var req ClockSyncRequest
+	if err := MapToStruct(obj, &req); err != nil {
+		sfsDecodeError("时钟同步请求解析失败", "conn", connId(conn), "err", err)
+		return
+	}
+	rsp, _ := StructToMap(&ClockSyncResponse{
+		Code:        200,
+		Seq:         req.Seq,
+		ClientTime:  req.ClientTime,
+		ReceiveTime: receiveTime,
+		SendTime:    time.Now().UnixMilli(),
+	})
+	packet := BuildSFSMessage(13, 1, map[string]interface{}{
+		"p": rsp,
+		"c": "CLOCK_SYNC_RESPONSE",
+	})
+	WritePacket(conn, packet)
+}
+
+// handlePingRequest 客户端测延迟，回复服务器时间（毫秒）
 func handlePingRequest(conn *websocket.Conn, obj map[string]interface{}) {
 	p := map[string]interface{}{
-		"p": map[string]interface{}{},
+		"p": map[string]interface{}{
+			"serverTime": time.Now().UnixMilli(),
+		},
 		"c": "PING_RESPONSE",
 	}
 	packet := BuildSFSMessage(13, 1, p)
-	conn.WriteMessage(websocket.BinaryMessage, packet)
+	WritePacket(conn, packet)
 }
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Prometheus 文本格式的指标，只实现服务用到的计数器、仪表和直方图
+
+type metricSeries struct {
+	labels  []string
+	value   float64
+	buckets []uint64 // 直方图各桶的累计次数
+	sum     float64
+	count   uint64
+}
+
+// MetricVec 一个指标及其按标签区分的序列
+type MetricVec struct {
+	mutex      sync.Mutex
+	name       string
+	help       string
+	kind       string // counter gauge histogram
+	labelNames []string
+	bounds     []float64 // 直方图桶上界
+	series     map[string]*metricSeries
+}
+
+// MetricsRegistry /metrics 输出的所有指标
+type MetricsRegistry struct {
+	mutex   sync.Mutex
+	metrics []*MetricVec
+	gauges  []gaugeFunc
+}
+
+type gaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+var metrics = &MetricsRegistry{}
+
+func (r *MetricsRegistry) register(kind string, name string, help string, bounds []float64, labels ...string) *MetricVec {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	m := &MetricVec{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labels,
+		bounds:     bounds,
+		series:     make(map[string]*metricSeries),
+	}
+	// 不带标签的指标启动时就输出0
+	if len(labels) == 0 {
+		m.get(nil)
+	}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+func (r *MetricsRegistry) Counter(name string, help string, labels ...string) *MetricVec {
+	return r.register("counter", name, help, nil, labels...)
+}
+
+func (r *MetricsRegistry) Gauge(name string, help string, labels ...string) *MetricVec {
+	return r.register("gauge", name, help, nil, labels...)
+}
+
+func (r *MetricsRegistry) Histogram(name string, help string, bounds []float64, labels ...string) *MetricVec {
+	return r.register("histogram", name, help, bounds, labels...)
+}
+
+// GaugeFunc 抓取时才计算的仪表
+func (r *MetricsRegistry) GaugeFunc(name string, help string, fn func() float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.gauges = append(r.gauges, gaugeFunc{name: name, help: help, fn: fn})
+}
+
+func (m *MetricVec) get(labels []string) *metricSeries {
+	key := strings.Join(labels, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &metricSeries{labels: append([]string{}, labels...)}
+		if m.kind == "histogram" {
+			s.buckets = make([]uint64, len(m.bounds))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Add 计数器或仪表增加 v，标签值按注册时的顺序传入
+func (m *MetricVec) Add(v float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.get(labels).value += v
+}
+
+func (m *MetricVec) Inc(labels ...string) {
+	m.Add(1, labels...)
+}
+
+// Set 仪表设为 v
+func (m *MetricVec) Set(v float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.get(labels).value = v
+}
+
+// Observe 直方图记录一次观测值
+func (m *MetricVec) Observe(v float64, labels ...string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	s := m.get(labels)
+	for i, bound := range m.bounds {
+		if v <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.sum += v
+	s.count++
+}
+
+// labelEscaper 文本格式的标签值只转义反斜杠、双引号和换行，其余字符（包括非 ASCII）原样输出
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(names []string, values []string, extra ...string) string {
+	pairs := make([]string, 0, len(names)+1)
+	for i, name := range names {
+		pairs = append(pairs, name+`="`+labelEscaper.Replace(values[i])+`"`)
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+labelEscaper.Replace(extra[1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (m *MetricVec) write(buf *bytes.Buffer) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := m.series[key]
+		if m.kind != "histogram" {
+			fmt.Fprintf(buf, "%s%s %s\n", m.name, formatLabels(m.labelNames, s.labels), formatValue(s.value))
+			continue
+		}
+		for i, bound := range m.bounds {
+			fmt.Fprintf(buf, "%s_bucket%s %d\n", m.name, formatLabels(m.labelNames, s.labels, "le", formatValue(bound)), s.buckets[i])
+		}
+		fmt.Fprintf(buf, "%s_bucket%s %d\n", m.name, formatLabels(m.labelNames, s.labels, "le", "+Inf"), s.count)
+		fmt.Fprintf(buf, "%s_sum%s %s\n", m.name, formatLabels(m.labelNames, s.labels), formatValue(s.sum))
+		fmt.Fprintf(buf, "%s_count%s %d\n", m.name, formatLabels(m.labelNames, s.labels), s.count)
+	}
+}
+
+// Write 输出 Prometheus 文本格式
+func (r *MetricsRegistry) Write(buf *bytes.Buffer) {
+	r.mutex.Lock()
+	list := append([]*MetricVec{}, r.metrics...)
+	gauges := append([]gaugeFunc{}, r.gauges...)
+	r.mutex.Unlock()
+
+	for _, m := range list {
+		m.write(buf)
+	}
+	for _, g := range gauges {
+		fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", g.name, g.help, g.name, g.name, formatValue(g.fn()))
+	}
+}
+
+func metricsHandler(c *gin.Context) {
+	buf := new(bytes.Buffer)
+	metrics.Write(buf)
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+}
+
+var (
+	latencyBuckets    = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+	multiplierBuckets = []float64{1, 1.2, 1.5, 2, 3, 5, 10, 20, 50, 100, 1000}
+)
+
+var (
+	metricRounds            = metrics.Counter("aviator_rounds_total", "Rounds settled.", "room")
+	metricVoidRounds        = metrics.Counter("aviator_void_rounds_total", "Rounds voided.", "room")
+	metricCrashMultiplier   = metrics.Histogram("aviator_crash_multiplier", "Crash multiplier of settled rounds.", multiplierBuckets)
+	metricBets              = metrics.Counter("aviator_bets_total", "Bets placed by real players.", "currency")
+	metricBetAmount         = metrics.Counter("aviator_bet_amount_total", "Stake placed by real players, free bets excluded.", "currency")
+	metricCashOuts          = metrics.Counter("aviator_cashouts_total", "Cash-outs by real players.", "currency")
+	metricCashOutAmount     = metrics.Counter("aviator_cashout_amount_total", "Amount paid on cash-outs.", "currency")
+	metricHouseGGR          = metrics.Gauge("aviator_house_ggr", "House gross gaming revenue since start: stakes minus payouts, refunds and adjustments.", "currency")
+	metricTickDuration      = metrics.Histogram("aviator_tick_duration_seconds", "Time spent in one game loop tick.", latencyBuckets)
+	metricTickJitter        = metrics.Histogram("aviator_tick_jitter_seconds", "Deviation of the tick interval from the configured interval.", latencyBuckets)
+	metricSfsDecodeErrors   = metrics.Counter("aviator_sfs_decode_errors_total", "SFS messages or fields that failed to decode.")
+	metricSfsEncodeErrors   = metrics.Counter("aviator_sfs_encode_errors_total", "Values the SFS encoder could not represent.")
+	metricWsConnections     = metrics.Gauge("aviator_ws_connections", "Open websocket connections.")
+	metricWsConnects        = metrics.Counter("aviator_ws_connections_total", "Websocket connections accepted.")
+	metricWsSendLatency     = metrics.Histogram("aviator_ws_send_seconds", "Time to write one message to a websocket.", latencyBuckets)
+	metricWsSendQueue       = metrics.Gauge("aviator_ws_send_queue_depth", "Messages waiting in websocket send queues.")
+	metricWsSendErrors      = metrics.Counter("aviator_ws_send_errors_total", "Websocket writes that failed or timed out.")
+	metricWsSlowClients     = metrics.Counter("aviator_ws_slow_client_disconnects_total", "Websocket connections closed because their send queue was full.")
+	metricWsRejections      = metrics.Counter("aviator_ws_rejections_total", "Websocket connections refused or messages dropped by abuse protection.", "reason")
+	metricWsIdleDisconnects = metrics.Counter("aviator_ws_idle_disconnects_total", "Websocket connections closed for missing pongs or player inactivity.", "reason")
+	metricWsBans            = metrics.Counter("aviator_ws_bans_total", "Temporary IP bans issued.")
+)
+
+func init() {
+	metrics.GaugeFunc("aviator_goroutines", "Number of goroutines.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	metrics.GaugeFunc("aviator_ws_banned_ips", "IPs currently banned.", func() float64 {
+		return float64(abuse.Bans())
+	})
+}
+
+// sfsDecodeError 记录一次解码错误
+func sfsDecodeError(msg string, args ...any) {
+	metricSfsDecodeErrors.Inc()
+	logSfs.Warn(msg, args...)
+}
+
+// sfsEncodeError 记录一次编码错误
+func sfsEncodeError(msg string, args ...any) {
+	metricSfsEncodeErrors.Inc()
+	logSfs.Warn(msg, args...)
+}
+
+// metricCurrencyOther 不受支持的币种统一记在这个标签下，币种标签的取值个数不超过配置的币种数加一
+const metricCurrencyOther = "other"
+
+func metricCurrency(currency string) string {
+	if currencies.Supported(currency) {
+		return currency
+	}
+	return metricCurrencyOther
+}
+
+// observeJournal 按牌局流水统计下注、兑现和 GGR
+func observeJournal(entry *JournalEntry) {
+	if entry.Currency == "" {
+		return
+	}
+	currency := metricCurrency(entry.Currency)
+	switch entry.Type {
+	case JournalBet:
+		metricBets.Inc(currency)
+		if !entry.IsFreeBet {
+			metricBetAmount.Add(entry.Bet.Float64(), currency)
+		}
+	case JournalCashOut:
+		metricCashOuts.Inc(currency)
+		metricCashOutAmount.Add(entry.WinAmount.Float64(), currency)
+	}
+	if entry.Delta != 0 {
+		metricHouseGGR.Add(-entry.Delta.Float64(), currency)
+	}
+}
+
+// observeTick 记录一次 tick 的耗时和间隔抖动
+func observeTick(start time.Time, last time.Time, interval time.Duration) {
+	metricTickDuration.Observe(time.Since(start).Seconds())
+	if !last.IsZero() {
+		metricTickJitter.Observe(math.Abs((start.Sub(last) - interval).Seconds()))
+	}
+}
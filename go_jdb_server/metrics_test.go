@@ -0,0 +1,45 @@
+package main
+
+import "testing"
+
+func TestFormatLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		names  []string
+		values []string
+		extra  []string
+		want   string
+	}{
+		{"none", nil, nil, nil, ""},
+		{"plain", []string{"room"}, []string{"1"}, nil, `{room="1"}`},
+		{"backslash", []string{"path"}, []string{`a\b`}, nil, `{path="a\\b"}`},
+		{"double quote", []string{"msg"}, []string{`say "hi"`}, nil, `{msg="say \"hi\""}`},
+		{"newline", []string{"msg"}, []string{"a\nb"}, nil, `{msg="a\nb"}`},
+		{"unicode kept as is", []string{"name"}, []string{"房间一"}, nil, `{name="房间一"}`},
+		{"tab kept as is", []string{"msg"}, []string{"a\tb"}, nil, "{msg=\"a\tb\"}"},
+		{"extra label", []string{"room"}, []string{"1"}, []string{"le", "+Inf"}, `{room="1",le="+Inf"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatLabels(tt.names, tt.values, tt.extra...); got != tt.want {
+				t.Errorf("formatLabels() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricCurrency(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{MainCurrency(), MainCurrency()},
+		{"XYZ", metricCurrencyOther},
+		{"mad\n", metricCurrencyOther},
+	}
+	for _, tt := range tests {
+		if got := metricCurrency(tt.in); got != tt.want {
+			t.Errorf("metricCurrency(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Money 定点数金额，以 1e-8 为最小单位，所有余额、下注和赔付都用它计算；
+// 只在 SFS/JSON 编码时转换为 float64
+type Money int64
+
+const (
+	moneyDecimals = 8
+	moneyScale    = 100000000
+)
+
+// MultiplierPrecision 倍数小数位数，对应 multiplierPrecision
+const MultiplierPrecision = 2
+
+func MoneyFromInt(units int64) Money {
+	return Money(units * moneyScale)
+}
+
+// MoneyFromFloat 仅用于解析外部输入，按 1e-8 四舍五入
+func MoneyFromFloat(f float64) Money {
+	return Money(math.Round(f * moneyScale))
+}
+
+// ParseMoney 精确解析十进制字符串，超过 8 位的小数四舍五入
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, err
+		}
+		return MoneyFromFloat(f), nil
+	}
+
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+
+	roundUp := false
+	if len(fracPart) > moneyDecimals {
+		roundUp = fracPart[moneyDecimals] >= '5'
+		fracPart = fracPart[:moneyDecimals]
+	}
+	fracPart += strings.Repeat("0", moneyDecimals-len(fracPart))
+
+	units, err := strconv.ParseInt("0"+intPart+fracPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q: %v", s, err)
+	}
+	if roundUp {
+		units++
+	}
+	if neg {
+		units = -units
+	}
+	return Money(units), nil
+}
+
+// Float64 编码边界使用，不要参与计算
+func (m Money) Float64() float64 {
+	return float64(m) / moneyScale
+}
+
+func (m Money) String() string {
+	sign := ""
+	units := int64(m)
+	if units < 0 {
+		sign = "-"
+		units = -units
+	}
+	str := fmt.Sprintf("%s%d.%08d", sign, units/moneyScale, units%moneyScale)
+	str = strings.TrimRight(str, "0")
+	return strings.TrimSuffix(str, ".")
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	str := strings.Trim(string(data), `"`)
+	if str == "null" || str == "" {
+		*m = 0
+		return nil
+	}
+	v, err := ParseMoney(str)
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
+
+func pow10(precision int) int64 {
+	return int64(math.Pow10(moneyDecimals - precision))
+}
+
+// Round 按精度四舍五入，用于下注金额
+func (m Money) Round(precision int) Money {
+	if precision >= moneyDecimals {
+		return m
+	}
+	step := pow10(precision)
+	units := int64(m)
+	if units < 0 {
+		return -Money(-units).Round(precision)
+	}
+	return Money((units + step/2) / step * step)
+}
+
+// Floor 按精度向下取整，用于赔付金额，赔付只舍不入
+func (m Money) Floor(precision int) Money {
+	if precision >= moneyDecimals {
+		return m
+	}
+	step := pow10(precision)
+	units := int64(m)
+	floored := units / step * step
+	if units < 0 && floored != units {
+		floored -= step
+	}
+	return Money(floored)
+}
+
+// mulDiv 计算 a*b/c，中间结果用大数避免溢出，结果向零取整
+func mulDiv(a, b, c int64) int64 {
+	r := new(big.Int).Mul(big.NewInt(a), big.NewInt(b))
+	return r.Quo(r, big.NewInt(c)).Int64()
+}
+
+// MultiplierUnits 倍数按 MultiplierPrecision 向下取整后的整数表示，如 1.57 -> 157
+func MultiplierUnits(x float64) int64 {
+	return int64(math.Floor(x*math.Pow10(MultiplierPrecision) + 1e-9))
+}
+
+// FloorMultiplier 倍数按 MultiplierPrecision 向下取整
+func FloorMultiplier(x float64) float64 {
+	return float64(MultiplierUnits(x)) / math.Pow10(MultiplierPrecision)
+}
+
+// MulMultiplier 金额乘以倍数，结果按 precision 向下取整
+func (m Money) MulMultiplier(x float64, precision int) Money {
+	units := mulDiv(int64(m), MultiplierUnits(x), int64(math.Pow10(MultiplierPrecision)))
+	return Money(units).Floor(precision)
+}
+
+// MulRate 金额乘以汇率，结果按 precision 向下取整
+func (m Money) MulRate(rate float64, precision int) Money {
+	units := mulDiv(int64(m), int64(MoneyFromFloat(rate)), moneyScale)
+	return Money(units).Floor(precision)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"1", MoneyFromInt(1), false},
+		{"0.1", 10000000, false},
+		{"12.34", 1234000000, false},
+		{"-2.5", -250000000, false},
+		{"+3", MoneyFromInt(3), false},
+		{".5", 50000000, false},
+		{"0.00000001", 1, false},
+		{"0.000000005", 1, false},
+		{"0.000000004", 0, false},
+		{"1.999999995", MoneyFromInt(2), false},
+		{"1e2", MoneyFromInt(100), false},
+		{" 7 ", MoneyFromInt(7), false},
+		{"", 0, true},
+		{"-", 0, true},
+		{"abc", 0, true},
+		{"1.2.3", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseMoney(%q) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseMoney(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		in   Money
+		want string
+	}{
+		{0, "0"},
+		{MoneyFromInt(5), "5"},
+		{150000000, "1.5"},
+		{1, "0.00000001"},
+		{-250000000, "-2.5"},
+		{-1, "-0.00000001"},
+	}
+	for _, tt := range tests {
+		if got := tt.in.String(); got != tt.want {
+			t.Errorf("Money(%d).String() = %q, want %q", int64(tt.in), got, tt.want)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Money
+	}{
+		{`12.5`, 1250000000},
+		{`"12.5"`, 1250000000},
+		{`null`, 0},
+		{`0.1`, 10000000},
+	}
+	for _, tt := range tests {
+		var got Money
+		if err := json.Unmarshal([]byte(tt.in), &got); err != nil {
+			t.Errorf("Unmarshal(%s) err = %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, want %d", tt.in, got, tt.want)
+		}
+		data, _ := json.Marshal(got)
+		var back Money
+		if err := json.Unmarshal(data, &back); err != nil || back != got {
+			t.Errorf("round trip of %s = %d (%v), want %d", data, back, err, got)
+		}
+	}
+}
+
+func TestMoneyRound(t *testing.T) {
+	tests := []struct {
+		in        string
+		precision int
+		round     string
+		floor     string
+	}{
+		{"1.005", 2, "1.01", "1"},
+		{"1.004", 2, "1", "1"},
+		{"1.999", 2, "2", "1.99"},
+		{"-1.005", 2, "-1.01", "-1.01"},
+		{"-1.004", 2, "-1", "-1.01"},
+		{"2.5", 0, "3", "2"},
+		{"0.12345678", 8, "0.12345678", "0.12345678"},
+		{"0.12345678", 4, "0.1235", "0.1234"},
+	}
+	for _, tt := range tests {
+		m, _ := ParseMoney(tt.in)
+		if got := m.Round(tt.precision).String(); got != tt.round {
+			t.Errorf("%s.Round(%d) = %s, want %s", tt.in, tt.precision, got, tt.round)
+		}
+		if got := m.Floor(tt.precision).String(); got != tt.floor {
+			t.Errorf("%s.Floor(%d) = %s, want %s", tt.in, tt.precision, got, tt.floor)
+		}
+	}
+}
+
+func TestFloorMultiplier(t *testing.T) {
+	tests := []struct {
+		in   float64
+		want float64
+	}{
+		{1, 1},
+		{1.579, 1.57},
+		{2.3, 2.3}, // 2.3*100 在浮点数中略小于 230
+		{1.1, 1.1},
+		{1000.999, 1000.99},
+	}
+	for _, tt := range tests {
+		if got := FloorMultiplier(tt.in); got != tt.want {
+			t.Errorf("FloorMultiplier(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMulMultiplier(t *testing.T) {
+	tests := []struct {
+		bet        string
+		multiplier float64
+		precision  int
+		want       string
+	}{
+		{"10", 2.5, 2, "25"},
+		{"0.33", 1.57, 2, "0.51"}, // 0.5181 向下取整
+		{"1", 1.009, 2, "1"},      // 倍数先按两位小数向下取整
+		{"0.1", 2.3, 2, "0.23"},
+		{"3", 1.01, 0, "3"},
+		{"50000000000", 1.5, 2, "75000000000"}, // 中间结果超过 int64
+	}
+	for _, tt := range tests {
+		bet, _ := ParseMoney(tt.bet)
+		if got := bet.MulMultiplier(tt.multiplier, tt.precision).String(); got != tt.want {
+			t.Errorf("%s x %v (precision %d) = %s, want %s", tt.bet, tt.multiplier, tt.precision, got, tt.want)
+		}
+	}
+}
+
+func TestMulRate(t *testing.T) {
+	tests := []struct {
+		amount    string
+		rate      float64
+		precision int
+		want      string
+	}{
+		{"100", 0.1, 2, "10"},
+		{"1", 1.08, 2, "1.08"},
+		{"999", 0.0067, 2, "6.69"},
+		{"0.5", 65000, 2, "32500"},
+	}
+	for _, tt := range tests {
+		amount, _ := ParseMoney(tt.amount)
+		if got := amount.MulRate(tt.rate, tt.precision).String(); got != tt.want {
+			t.Errorf("%s x %v = %s, want %s", tt.amount, tt.rate, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RoomState 运营后台查看的房间实时状态，金额合计折算为主币种
+type RoomState struct {
+	RoomId         int     `json:"roomId"`
+	Name           string  `json:"name"`
+	Currency       string  `json:"currency"`
+	RoundId        int     `json:"roundId"`
+	Stage          int32   `json:"stage"`
+	StageElapsedMs int64   `json:"stageElapsedMs"`
+	Multiplier     float64 `json:"multiplier"`
+	Paused         bool    `json:"paused"`
+	Players        int     `json:"players"` // 在线真人玩家
+	OpenBets       int     `json:"openBets"`
+	OpenStake      Money   `json:"openStake"` // 未兑现的真人下注
+	Exposure       Money   `json:"exposure"`  // 未兑现的真人下注按当前倍数兑现时的赔付
+	TotalBet       Money   `json:"totalBet"`
+	TotalCashOut   Money   `json:"totalCashOut"`
+	MinBet         Money   `json:"minBet"`
+	MaxBet         Money   `json:"maxBet"`
+	MainCurrency   string  `json:"mainCurrency"`
+}
+
+// OpenBetState 本局的一注真人下注
+type OpenBetState struct {
+	AccountId   string  `json:"accountId"`
+	BetId       int32   `json:"betId"`
+	Bet         Money   `json:"bet"`
+	Currency    string  `json:"currency"`
+	IsFreeBet   bool    `json:"isFreeBet"`
+	AutoCashOut float64 `json:"autoCashOut"`
+	CashedOut   bool    `json:"cashedOut"`
+	Multiplier  float64 `json:"multiplier,omitempty"`
+	WinAmount   Money   `json:"winAmount,omitempty"`
+}
+
+// PlayerState 房间内的真人玩家
+type PlayerState struct {
+	AccountId string `json:"accountId"`
+	Nickname  string `json:"nickname"`
+	Currency  string `json:"currency"`
+	Balance   Money  `json:"balance"`
+	IsOffline bool   `json:"isOffline"`
+	AutoBet   bool   `json:"autoBet"`
+	Bets      int    `json:"bets"`
+}
+
+// AdminState 调用方需持有 g.mutex
+func (g *AviatorGameContext) AdminState() RoomState {
+	state := RoomState{
+		RoomId:         g.RoomId,
+		Currency:       g.Currency,
+		RoundId:        g.RecordId,
+		Stage:          g.CurStage,
+		StageElapsedMs: time.Now().UnixMilli() - g.curStateStartTime,
+		Multiplier:     g.CurMultiplier,
+		Paused:         g.paused,
+		OpenBets:       g.OpenBetsCount(),
+		MinBet:         g.MinBet,
+		MaxBet:         g.MaxBet,
+		MainCurrency:   MainCurrency(),
+	}
+	if g.paused {
+		state.StageElapsedMs = g.pausedAt - g.curStateStartTime
+	}
+	state.TotalBet, state.TotalCashOut = g.PlayerTotals()
+	for _, player := range g.players {
+		if !player.IsOffline {
+			state.Players++
+		}
+		for _, bet := range player.BetList {
+			if bet.hasCashOut {
+				continue
+			}
+			if !bet.isFreeBet {
+				state.OpenStake += mainCurrencyAmount(bet.BetValue, player.Currency)
+			}
+			state.Exposure += mainCurrencyAmount(bet.WinAmount(g.CurMultiplier, player.Currency), player.Currency)
+		}
+	}
+	return state
+}
+
+// AdminOpenBets 本局所有真人下注，调用方需持有 g.mutex
+func (g *AviatorGameContext) AdminOpenBets() []OpenBetState {
+	list := make([]OpenBetState, 0)
+	for _, player := range g.players {
+		for _, bet := range player.BetList {
+			list = append(list, OpenBetState{
+				AccountId:   player.AccountId,
+				BetId:       bet.BetArea,
+				Bet:         bet.BetValue,
+				Currency:    player.Currency,
+				IsFreeBet:   bet.isFreeBet,
+				AutoCashOut: bet.autoCashOut,
+				CashedOut:   bet.hasCashOut,
+				Multiplier:  bet.cashOutMultiplier,
+				WinAmount:   bet.CashOut,
+			})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].AccountId != list[j].AccountId {
+			return list[i].AccountId < list[j].AccountId
+		}
+		return list[i].BetId < list[j].BetId
+	})
+	return list
+}
+
+// AdminPlayers 房间内的真人玩家，调用方需持有 g.mutex
+func (g *AviatorGameContext) AdminPlayers() []PlayerState {
+	list := make([]PlayerState, 0, len(g.players))
+	for _, player := range g.players {
+		list = append(list, PlayerState{
+			AccountId: player.AccountId,
+			Nickname:  player.Nickname,
+			Currency:  player.Currency,
+			Balance:   player.Balance,
+			IsOffline: player.IsOffline,
+			AutoBet:   player.AutoBet,
+			Bets:      len(player.BetList),
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].AccountId < list[j].AccountId })
+	return list
+}
+
+// Pause 暂停游戏循环，倍数和阶段计时都停在当前位置，调用方需持有 g.mutex
+func (g *AviatorGameContext) Pause() error {
+	if g.paused {
+		return fmt.Errorf("room %d is already paused", g.RoomId)
+	}
+	g.StopTimer()
+	g.paused = true
+	g.pausedAt = time.Now().UnixMilli()
+	return nil
+}
+
+// Resume 恢复游戏循环，暂停的时长不计入当前阶段，调用方需持有 g.mutex
+func (g *AviatorGameContext) Resume() error {
+	if !g.paused {
+		return fmt.Errorf("room %d is not paused", g.RoomId)
+	}
+	if g.draining {
+		return fmt.Errorf("room %d is shutting down", g.RoomId)
+	}
+	if g.voidPolicy != "" {
+		return fmt.Errorf("room %d: round is partially voided, retry the void first", g.RoomId)
+	}
+	pausedFor := time.Now().UnixMilli() - g.pausedAt
+	g.curStateStartTime += pausedFor
+	if g.stageDeadline > 0 {
+		g.stageDeadline += pausedFor
+	}
+	g.paused = false
+	g.pausedAt = 0
+	g.lastTickAt = time.Time{}
+	g.StartTimer(g.tickInterval, g.OnTick)
+	return nil
+}
+
+// SetLimits 修改限定币种房间的下注限额，下一次下注生效，调用方需持有 g.mutex
+func (g *AviatorGameContext) SetLimits(minBet Money, maxBet Money) error {
+	if g.Currency == "" {
+		return fmt.Errorf("room %d accepts any currency, change the currency limits instead", g.RoomId)
+	}
+	if minBet <= 0 || maxBet < minBet {
+		return fmt.Errorf("invalid bet limits")
+	}
+	g.MinBet = minBet
+	g.MaxBet = maxBet
+	return nil
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 红包雨被拒绝的原因
+const (
+	RainRejectDisabled      = "rainDisabled"
+	RainRejectAmount        = "invalidAmount"
+	RainRejectNumOfUsers    = "invalidNumOfUsers"
+	RainRejectNoBalance     = "insufficientBalance"
+	RainRejectNotEnoughUser = "notEnoughActivePlayers"
+	RainRejectNotRecipient  = "notRecipient"
+	RainRejectClaimed       = "alreadyClaimed"
+	RainRejectExpired       = "expired"
+	RainRejectUnavailable   = "unavailable" // 流水写入失败
+)
+
+const (
+	rainClaimTimeout = 30 * time.Second // 领取按钮的有效期
+	rainActiveWindow = 10 * time.Minute // 最近在该时间内下注或发言的玩家才能被选中
+)
+
+// TouchActivity 记录玩家在房间内的活跃时间，用于红包雨选人
+func (g *AviatorGameContext) TouchActivity(accountId string) {
+	g.chat.lastActive[accountId] = time.Now().UnixMilli()
+}
+
+// RainCandidates 最近活跃、在线且与红包雨同币种的真人玩家
+func (g *AviatorGameContext) RainCandidates(currency string, exclude string) []*AviatorPlayerInfo {
+	since := time.Now().Add(-rainActiveWindow).UnixMilli()
+	candidates := make([]*AviatorPlayerInfo, 0)
+	for _, player := range g.players {
+		if player.IsOffline || player.isRobot || player.AccountId == exclude || player.Currency != currency {
+			continue
+		}
+		if g.chat.lastActive[player.AccountId] < since {
+			continue
+		}
+		candidates = append(candidates, player)
+	}
+	return candidates
+}
+
+// StartRain 从活跃玩家中随机选出 numOfUsers 人平分 amount，在聊天中公告；
+// 不能整除的余数不计入红包雨，starter 为nil时是运营方红包雨。失败时返回原因
+func (g *AviatorGameContext) StartRain(starter *AviatorPlayerInfo, amount Money, currency string, numOfUsers int) (*ChatMessage, string) {
+	rain := chatSettings.Rain
+	if numOfUsers < rain.MinNumOfUsers || numOfUsers > rain.MaxNumOfUsers {
+		return nil, RainRejectNumOfUsers
+	}
+	amount = RoundAmount(amount, currency)
+	if mainAmount, err := ToMainCurrency(amount, currency); err != nil || amount <= 0 || mainAmount < rain.RainMinBet || mainAmount > rain.RainMaxBet {
+		return nil, RainRejectAmount
+	}
+
+	exclude := ""
+	if starter != nil {
+		exclude = starter.AccountId
+	}
+	candidates := g.RainCandidates(currency, exclude)
+	if len(candidates) < numOfUsers {
+		return nil, RainRejectNotEnoughUser
+	}
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+
+	share := FloorAmount(amount/Money(numOfUsers), currency)
+	if share <= 0 {
+		return nil, RainRejectAmount
+	}
+	info := &ChatRainInfo{
+		Amount:     share * Money(numOfUsers),
+		Share:      share,
+		Currency:   currency,
+		IsPromo:    starter == nil,
+		Recipients: make([]string, 0, numOfUsers),
+		Claimed:    make([]string, 0, numOfUsers),
+		ExpiresAt:  time.Now().Add(rainClaimTimeout).UnixMilli(),
+	}
+	for _, player := range candidates[:numOfUsers] {
+		info.Recipients = append(info.Recipients, player.AccountId)
+	}
+
+	msg := &ChatMessage{
+		Type:     "rain",
+		Username: "promo",
+		Message:  fmt.Sprintf("%s %s", info.Amount, currency),
+		Rain:     info,
+	}
+	entry := JournalEntry{Type: JournalRain, Currency: currency}
+	if starter != nil {
+		msg.PlayerID = starter.AccountId
+		msg.Username = starter.Nickname
+		msg.ProfileImage = starter.ProfileImage
+		//扣钱，不能整除的余数不扣
+		entry.AccountId = starter.AccountId
+		entry.Delta = -info.Amount
+	}
+	g.chat.nextId++
+	msg.ID = g.chat.nextId
+	entry.RainId = msg.ID
+	if err := g.RainJournal(entry); errors.Is(err, ErrInsufficientFunds) {
+		return nil, RainRejectNoBalance
+	} else if err != nil {
+		return nil, RainRejectUnavailable
+	}
+	g.AddChatMessage(msg)
+	g.chat.rains = append(g.chat.rains, msg)
+	return msg, ""
+}
+
+func (g *AviatorGameContext) C2sRain(conn *websocket.Conn, req *RainRequest) {
+	playerInfo := g.players[conn.RemoteAddr().String()]
+	if playerInfo == nil {
+		return
+	}
+	reply := func(resp *RainResponse) {
+		result, _ := StructToMap(resp)
+		g.SendToClient(playerInfo, "rain", result)
+	}
+
+	if !chatSettings.IsEnabled || !chatSettings.Rain.IsEnabled {
+		reply(&RainResponse{Code: 400, Reason: RainRejectDisabled})
+		return
+	}
+	if restriction := chatModeration.Check(playerInfo.AccountId); restriction != nil {
+		reason := ChatRejectMuted
+		if restriction.Kind == ChatRestrictionBan {
+			reason = ChatRejectBanned
+		}
+		reply(&RainResponse{Code: 400, Reason: reason})
+		return
+	}
+	if RoundAmount(req.Amount, playerInfo.Currency) > wallets.Balance(playerInfo.AccountId) {
+		reply(&RainResponse{Code: 400, Reason: RainRejectNoBalance})
+		return
+	}
+	if req.NumOfUsers == 0 {
+		req.NumOfUsers = chatSettings.Rain.DefaultNumOfUsers
+	}
+
+	msg, reason := g.StartRain(playerInfo, req.Amount, playerInfo.Currency, req.NumOfUsers)
+	if msg == nil {
+		reply(&RainResponse{Code: 400, Reason: reason})
+		return
+	}
+	g.TouchActivity(playerInfo.AccountId)
+	reply(&RainResponse{Code: 200, ID: msg.ID})
+}
+
+func (g *AviatorGameContext) C2sClaimRain(conn *websocket.Conn, req *RainClaimRequest) {
+	playerInfo := g.players[conn.RemoteAddr().String()]
+	if playerInfo == nil {
+		return
+	}
+
+	result, _ := StructToMap(g.ClaimRain(playerInfo, req.ID))
+	g.SendToClient(playerInfo, "claimRain", result)
+}
+
+// ClaimRain 玩家领取一份红包雨，每人只能领取一次；最后一份被领取时红包雨结束
+func (g *AviatorGameContext) ClaimRain(playerInfo *AviatorPlayerInfo, id int64) *RainResponse {
+	idx := slices.IndexFunc(g.chat.rains, func(msg *ChatMessage) bool { return msg.ID == id })
+	if idx < 0 {
+		return &RainResponse{Code: 400, ID: id, Reason: RainRejectExpired}
+	}
+	msg := g.chat.rains[idx]
+	info := msg.Rain
+	if time.Now().UnixMilli() >= info.ExpiresAt {
+		return &RainResponse{Code: 400, ID: id, Reason: RainRejectExpired}
+	}
+	if !slices.Contains(info.Recipients, playerInfo.AccountId) {
+		return &RainResponse{Code: 400, ID: id, Reason: RainRejectNotRecipient}
+	}
+	if slices.Contains(info.Claimed, playerInfo.AccountId) {
+		return &RainResponse{Code: 400, ID: id, Reason: RainRejectClaimed}
+	}
+
+	entry := JournalEntry{Type: JournalRainClaim, RainId: msg.ID, AccountId: playerInfo.AccountId, Currency: info.Currency, Delta: info.Share}
+	if g.RainJournal(entry) != nil {
+		return &RainResponse{Code: 400, ID: id, Reason: RainRejectUnavailable}
+	}
+	info.Claimed = append(info.Claimed, playerInfo.AccountId)
+
+	if len(info.Claimed) == len(info.Recipients) {
+		g.chat.rains = slices.Delete(g.chat.rains, idx, idx+1)
+		g.EndRain(msg)
+	}
+	g.S2cRainUpdate(msg, false)
+	return &RainResponse{Code: 200, ID: id, Share: info.Share}
+}
+
+// ExpireRains 过期未领取的份额退还给发起人，运营方红包雨不退还
+func (g *AviatorGameContext) ExpireRains(now int64) {
+	if len(g.chat.rains) == 0 {
+		return
+	}
+	pending := make([]*ChatMessage, 0, len(g.chat.rains))
+	expired := make([]*ChatMessage, 0)
+	for _, msg := range g.chat.rains {
+		if now < msg.Rain.ExpiresAt {
+			pending = append(pending, msg)
+			continue
+		}
+
+		info := msg.Rain
+		unclaimed := info.Share * Money(len(info.Recipients)-len(info.Claimed))
+		if !info.IsPromo && unclaimed > 0 {
+			entry := JournalEntry{Type: JournalRainRefund, RainId: msg.ID, AccountId: msg.PlayerID, Currency: info.Currency, Delta: unclaimed}
+			if g.RainJournal(entry) != nil {
+				// 下一个 tick 重试
+				pending = append(pending, msg)
+				continue
+			}
+		}
+		expired = append(expired, msg)
+	}
+	// 先移出过期的红包雨，最后一场结束时 EndRain 清空流水
+	g.chat.rains = pending
+	for _, msg := range expired {
+		g.S2cRainUpdate(msg, true)
+		g.EndRain(msg)
+	}
+}
+
+// EndRain 红包雨领完或过期；没有未结束的红包雨时清空流水
+func (g *AviatorGameContext) EndRain(msg *ChatMessage) {
+	g.RainJournal(JournalEntry{Type: JournalRainEnd, RainId: msg.ID})
+	if len(g.chat.rains) == 0 && g.rainJournal != nil {
+		g.rainJournal.Reset()
+	}
+}
+
+// RainJournal 写入一条红包雨流水，落盘后再入账；玩家不在房间时直接入账到钱包。
+// 发起人钱包可用余额不足时返回 ErrInsufficientFunds；流水写入失败时不入账，返回错误
+func (g *AviatorGameContext) RainJournal(entry JournalEntry) error {
+	_, balance, err := g.rainJournal.Record(&entry)
+	if errors.Is(err, ErrInsufficientFunds) {
+		return err
+	}
+	if err != nil {
+		g.log().Error("红包雨流水写入失败", "type", entry.Type, "rain", entry.RainId, "player", entry.AccountId, "err", err)
+		return err
+	}
+	if entry.Delta != 0 {
+		if player := g.FindPlayer(entry.AccountId); player != nil {
+			player.Balance = balance
+			g.S2cNewBalance(player, balance)
+		}
+	}
+	return nil
+}
+
+func rainJournalPath(roomId int) string {
+	return filepath.Join(DataDir, fmt.Sprintf("rain_%d.jsonl", roomId))
+}
+
+// RecoverRainJournal 启动时重放上次进程的红包雨流水：补记没有入账的余额变动，
+// 未结束的红包雨把未领取的部分退还发起人
+func RecoverRainJournal(roomId int) (*Journal, error) {
+	j, entries, err := openJournal(roomId, "rain_"+strconv.Itoa(roomId), rainJournalPath(roomId))
+	if err != nil {
+		return nil, err
+	}
+
+	type pendingRain struct {
+		starter  string
+		currency string
+		left     Money // 发起人已扣除、还未被领取或退还的金额
+	}
+	pending := make(map[int64]*pendingRain)
+	order := make([]int64, 0)
+	for _, entry := range entries {
+		if entry.Delta != 0 {
+			wallets.Apply(j.key, entry.Seq, entry.AccountId, entry.Delta)
+		}
+		switch entry.Type {
+		case JournalRain:
+			pending[entry.RainId] = &pendingRain{starter: entry.AccountId, currency: entry.Currency, left: -entry.Delta}
+			order = append(order, entry.RainId)
+		case JournalRainClaim, JournalRainRefund:
+			if rain, ok := pending[entry.RainId]; ok {
+				rain.left -= entry.Delta
+			}
+		case JournalRainEnd:
+			delete(pending, entry.RainId)
+		}
+	}
+
+	for _, id := range order {
+		rain, ok := pending[id]
+		if !ok {
+			continue
+		}
+		if rain.left > 0 {
+			entry := JournalEntry{Type: JournalRainRefund, RainId: id, AccountId: rain.starter, Currency: rain.currency, Delta: rain.left, Reason: "server restart"}
+			seq, err := j.Append(&entry)
+			if err != nil {
+				return nil, err
+			}
+			wallets.Apply(j.key, seq, rain.starter, rain.left)
+			logGame.Warn("重启后退还未领取的红包雨", "room", roomId, "rain", id, "player", rain.starter, "amount", rain.left, "currency", rain.currency)
+		}
+		if _, err := j.Append(&JournalEntry{Type: JournalRainEnd, RainId: id}); err != nil {
+			return nil, err
+		}
+	}
+	j.Reset()
+	return j, nil
+}
+
+func (g *AviatorGameContext) S2cRainUpdate(msg *ChatMessage, expired bool) {
+	update := &RainUpdate{
+		Code:    200,
+		ID:      msg.ID,
+		Claimed: msg.Rain.Claimed,
+		Expired: expired,
+	}
+	result, _ := StructToMap(update)
+	g.SendToAllClients("rainUpdate", result)
+}
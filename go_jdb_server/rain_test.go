@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// newRainTestRoom 房间1的余额和红包雨流水写入临时目录，starter 发起、其余玩家在线且最近活跃
+func newRainTestRoom(t *testing.T) (*AviatorGameContext, *AviatorPlayerInfo, []*AviatorPlayerInfo) {
+	t.Helper()
+	newRecoveryTestData(t)
+
+	g := NewGameContext()
+	g.RoomId = 1
+	journal, err := RecoverRainJournal(g.RoomId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if !journal.closed {
+			journal.Close()
+		}
+	})
+	g.rainJournal = journal
+
+	starter := &AviatorPlayerInfo{AccountId: "1&&demo", Currency: MainCurrency()}
+	g.players["p1"] = starter
+	recipients := make([]*AviatorPlayerInfo, 0, 3)
+	for _, account := range []string{"2&&demo", "3&&demo", "4&&demo"} {
+		player := &AviatorPlayerInfo{AccountId: account, Currency: MainCurrency()}
+		g.players[account] = player
+		g.TouchActivity(account)
+		recipients = append(recipients, player)
+	}
+	for _, player := range g.players {
+		player.Balance = wallets.Balance(player.AccountId)
+	}
+	return g, starter, recipients
+}
+
+func TestRainRefundOnExpiry(t *testing.T) {
+	g, starter, recipients := newRainTestRoom(t)
+
+	msg, reason := g.StartRain(starter, MoneyFromInt(30), MainCurrency(), 3)
+	if msg == nil {
+		t.Fatalf("StartRain rejected: %s", reason)
+	}
+	if got, want := wallets.Balance(starter.AccountId), DemoStartBalance-MoneyFromInt(30); got != want {
+		t.Fatalf("starter balance after rain = %s, want %s", got, want)
+	}
+	if resp := g.ClaimRain(recipients[0], msg.ID); resp.Code != 200 {
+		t.Fatalf("claim rejected: %s", resp.Reason)
+	}
+
+	g.ExpireRains(msg.Rain.ExpiresAt)
+	if len(g.chat.rains) != 0 {
+		t.Fatalf("rains = %d after expiry, want 0", len(g.chat.rains))
+	}
+	// 两份未领取的退还发起人
+	if got, want := wallets.Balance(starter.AccountId), DemoStartBalance-MoneyFromInt(10); got != want {
+		t.Errorf("starter balance = %s, want %s", got, want)
+	}
+	if got, want := wallets.Balance(recipients[0].AccountId), DemoStartBalance+MoneyFromInt(10); got != want {
+		t.Errorf("recipient balance = %s, want %s", got, want)
+	}
+	if resp := g.ClaimRain(recipients[1], msg.ID); resp.Code == 200 || resp.Reason != RainRejectExpired {
+		t.Errorf("claim after expiry = %+v, want %s", resp, RainRejectExpired)
+	}
+
+	// 最后一场红包雨结束后流水已清空
+	info, err := os.Stat(rainJournalPath(g.RoomId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("rain journal size = %d after the last rain ended, want 0", info.Size())
+	}
+}
+
+func TestRainClaimOnce(t *testing.T) {
+	g, starter, recipients := newRainTestRoom(t)
+
+	msg, reason := g.StartRain(starter, MoneyFromInt(30), MainCurrency(), 3)
+	if msg == nil {
+		t.Fatalf("StartRain rejected: %s", reason)
+	}
+	if resp := g.ClaimRain(recipients[0], msg.ID); resp.Code != 200 || resp.Share != MoneyFromInt(10) {
+		t.Fatalf("claim = %+v, want share 10", resp)
+	}
+	if resp := g.ClaimRain(recipients[0], msg.ID); resp.Code == 200 || resp.Reason != RainRejectClaimed {
+		t.Errorf("second claim = %+v, want %s", resp, RainRejectClaimed)
+	}
+	if resp := g.ClaimRain(starter, msg.ID); resp.Code == 200 || resp.Reason != RainRejectNotRecipient {
+		t.Errorf("starter claim = %+v, want %s", resp, RainRejectNotRecipient)
+	}
+	if got, want := wallets.Balance(recipients[0].AccountId), DemoStartBalance+MoneyFromInt(10); got != want {
+		t.Errorf("recipient balance = %s, want %s", got, want)
+	}
+}
+
+func TestRainRecoveryAfterRestart(t *testing.T) {
+	g, starter, recipients := newRainTestRoom(t)
+
+	msg, reason := g.StartRain(starter, MoneyFromInt(30), MainCurrency(), 3)
+	if msg == nil {
+		t.Fatalf("StartRain rejected: %s", reason)
+	}
+	if resp := g.ClaimRain(recipients[0], msg.ID); resp.Code != 200 {
+		t.Fatalf("claim rejected: %s", resp.Reason)
+	}
+
+	// 进程崩溃：流水没有清空，重启后从磁盘重新打开余额并重放两次
+	g.rainJournal.Close()
+	for restart := 1; restart <= 2; restart++ {
+		var err error
+		if wallets, err = OpenWalletStore(); err != nil {
+			t.Fatal(err)
+		}
+		journal, err := RecoverRainJournal(g.RoomId)
+		if err != nil {
+			t.Fatalf("restart %d: %v", restart, err)
+		}
+		journal.Close()
+
+		// 已领取的一份不重复入账，未领取的两份退还发起人
+		if got, want := wallets.Balance(starter.AccountId), DemoStartBalance-MoneyFromInt(10); got != want {
+			t.Errorf("restart %d: starter balance = %s, want %s", restart, got, want)
+		}
+		if got, want := wallets.Balance(recipients[0].AccountId), DemoStartBalance+MoneyFromInt(10); got != want {
+			t.Errorf("restart %d: recipient balance = %s, want %s", restart, got, want)
+		}
+		if got := wallets.Balance(recipients[1].AccountId); got != DemoStartBalance {
+			t.Errorf("restart %d: unclaimed recipient balance = %s, want %s", restart, got, DemoStartBalance)
+		}
+	}
+}
+
+func TestRainRejectedWithoutFunds(t *testing.T) {
+	g, starter, _ := newRainTestRoom(t)
+	wallets.Apply("", 0, starter.AccountId, MoneyFromInt(20)-DemoStartBalance)
+
+	if msg, reason := g.StartRain(starter, MoneyFromInt(30), MainCurrency(), 3); msg != nil || reason != RainRejectNoBalance {
+		t.Fatalf("StartRain = %v, %q; want rejected with %s", msg, reason, RainRejectNoBalance)
+	}
+	if got := wallets.Balance(starter.AccountId); got != MoneyFromInt(20) {
+		t.Errorf("starter balance = %s, want 20", got)
+	}
+	if len(g.chat.rains) != 0 {
+		t.Errorf("rains = %d, want 0", len(g.chat.rains))
+	}
+}
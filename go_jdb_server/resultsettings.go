@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 风控模式
+const (
+	RiskModeNone   = "none"   // 只按爆点结束，不干预
+	RiskModeNoLoss = "noLoss" // 本局系统即将亏损时提前爆炸
+)
+
+const resultSettingsKeep = 50 // 返回给后台的历史版本条数
+
+// ResultSettings 开奖设置，每个房间在下注阶段开始时读取，修改后下一局生效
+type ResultSettings struct {
+	Version       int     `json:"version"`
+	Rtp           float64 `json:"rtp"`           // 返奖率目标，百分比
+	MaxMultiplier float64 `json:"maxMultiplier"` // 爆点上限
+	MaxPayout     Money   `json:"maxPayout"`     // 每局真人赔付上限（主币种），0 表示不限
+	RiskMode      string  `json:"riskMode"`
+	UpdatedAt     int64   `json:"updatedAt"` // 毫秒时间戳
+	UpdatedBy     string  `json:"updatedBy"`
+}
+
+// ResultSettingsUpdate 后台修改开奖设置，未填写的字段保持不变
+type ResultSettingsUpdate struct {
+	Rtp           *float64 `json:"rtp"`
+	MaxMultiplier *float64 `json:"maxMultiplier"`
+	MaxPayout     *Money   `json:"maxPayout"`
+	RiskMode      *string  `json:"riskMode"`
+}
+
+func DefaultResultSettings() ResultSettings {
+	return ResultSettings{
+		Version:       1,
+		Rtp:           97,
+		MaxMultiplier: 1000,
+		MaxPayout:     0,
+		RiskMode:      RiskModeNone,
+	}
+}
+
+func (s *ResultSettings) Validate() error {
+	if s.Rtp <= 0 || s.Rtp > 100 {
+		return fmt.Errorf("rtp must be in (0, 100]")
+	}
+	if s.MaxMultiplier < 1.01 {
+		return fmt.Errorf("maxMultiplier must be at least 1.01")
+	}
+	if s.MaxPayout < 0 {
+		return fmt.Errorf("maxPayout must not be negative")
+	}
+	if s.RiskMode != RiskModeNone && s.RiskMode != RiskModeNoLoss {
+		return fmt.Errorf("unknown riskMode %q", s.RiskMode)
+	}
+	return nil
+}
+
+// ResultSettingsStore 开奖设置的所有版本，追加写入 data/result_settings.jsonl，最后一行为当前版本
+type ResultSettingsStore struct {
+	mutex    sync.Mutex
+	file     *os.File
+	versions []ResultSettings
+}
+
+var resultSettings = &ResultSettingsStore{versions: []ResultSettings{DefaultResultSettings()}}
+
+// OpenResultSettings 读取已保存的版本；没有时以配置文件（可选）为第1版
+func OpenResultSettings(configPath string) (*ResultSettingsStore, error) {
+	if err := os.MkdirAll(DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(DataDir, "result_settings.jsonl")
+	s := &ResultSettingsStore{versions: make([]ResultSettings, 0)}
+
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			var settings ResultSettings
+			if err := json.Unmarshal(scanner.Bytes(), &settings); err != nil {
+				logStore.Warn("跳过损坏的开奖设置", "path", path, "err", err)
+				continue
+			}
+			s.versions = append(s.versions, settings)
+		}
+		file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	if len(s.versions) > 0 {
+		return s, nil
+	}
+
+	settings, err := loadResultSettingsConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	settings.Version = 1
+	settings.UpdatedAt = time.Now().UnixMilli()
+	settings.UpdatedBy = "config"
+	if err := s.append(settings); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func loadResultSettingsConfig(path string) (ResultSettings, error) {
+	settings := DefaultResultSettings()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return settings, nil
+	}
+	if err != nil {
+		return settings, err
+	}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return settings, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if err := settings.Validate(); err != nil {
+		return settings, fmt.Errorf("%s: %v", path, err)
+	}
+	return settings, nil
+}
+
+// append 新版本落盘后才生效
+func (s *ResultSettingsStore) append(settings ResultSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	s.versions = append(s.versions, settings)
+	return nil
+}
+
+func (s *ResultSettingsStore) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// Current 当前版本
+func (s *ResultSettingsStore) Current() ResultSettings {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.versions[len(s.versions)-1]
+}
+
+// History 最近的 n 个版本，最新的在前
+func (s *ResultSettingsStore) History(n int) []ResultSettings {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	list := make([]ResultSettings, 0, n)
+	for i := len(s.versions) - 1; i >= 0 && len(list) < n; i-- {
+		list = append(list, s.versions[i])
+	}
+	return list
+}
+
+// Update 在当前版本上修改并生成新版本，各房间下一个下注阶段开始时生效
+func (s *ResultSettingsStore) Update(update ResultSettingsUpdate, actor string) (ResultSettings, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	settings := s.versions[len(s.versions)-1]
+	if update.Rtp != nil {
+		settings.Rtp = *update.Rtp
+	}
+	if update.MaxMultiplier != nil {
+		settings.MaxMultiplier = FloorMultiplier(*update.MaxMultiplier)
+	}
+	if update.MaxPayout != nil {
+		settings.MaxPayout = *update.MaxPayout
+	}
+	if update.RiskMode != nil {
+		settings.RiskMode = *update.RiskMode
+	}
+	if err := settings.Validate(); err != nil {
+		return settings, err
+	}
+	settings.Version++
+	settings.UpdatedAt = time.Now().UnixMilli()
+	settings.UpdatedBy = actor
+	if s.file == nil {
+		s.versions = append(s.versions, settings)
+		return settings, nil
+	}
+	if err := s.append(settings); err != nil {
+		return settings, err
+	}
+	return settings, nil
+}
+
+// RoundPayout 本局真人赔付（主币种）：已兑现的金额加上未兑现下注按 multiplier 兑现的金额
+func (g *AviatorGameContext) RoundPayout(multiplier float64) Money {
+	payout := Money(0)
+	for _, player := range g.players {
+		for _, bet := range player.BetList {
+			if bet.hasCashOut {
+				payout += mainCurrencyAmount(bet.CashOut, player.Currency)
+			} else {
+				payout += mainCurrencyAmount(bet.WinAmount(multiplier, player.Currency), player.Currency)
+			}
+		}
+	}
+	return payout
+}
+
+// 提前爆炸的原因，记录在牌局历史的 riskStop 中
+const (
+	RiskStopMaxPayout = "maxPayout" // 真人赔付将超过上限
+	RiskStopNoLoss    = "noLoss"    // 系统即将亏损
+)
+
+// RiskStop 按本局的风控设置判断倍数涨到 multiplier 前是否需要提前爆炸，返回原因，不需要时为空
+func (g *AviatorGameContext) RiskStop(multiplier float64) string {
+	if g.settings.MaxPayout > 0 && g.RoundPayout(multiplier) > g.settings.MaxPayout {
+		return RiskStopMaxPayout
+	}
+	if g.settings.RiskMode == RiskModeNoLoss && g.CacSysWin() < 0 {
+		return RiskStopNoLoss
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestRiskStop(t *testing.T) {
+	losing := []*PlayerBetSt{{BetArea: 1, BetValue: MoneyFromInt(10), CashOut: MoneyFromInt(30), hasCashOut: true}}
+	open := []*PlayerBetSt{{BetArea: 1, BetValue: MoneyFromInt(10)}}
+	tests := []struct {
+		name     string
+		settings ResultSettings
+		bets     []*PlayerBetSt
+		want     string
+	}{
+		{"default never stops", DefaultResultSettings(), losing, ""},
+		{"no loss stops a losing round", ResultSettings{RiskMode: RiskModeNoLoss}, losing, RiskStopNoLoss},
+		{"no loss lets a winning round fly", ResultSettings{RiskMode: RiskModeNoLoss}, open, ""},
+		{"max payout", ResultSettings{RiskMode: RiskModeNone, MaxPayout: MoneyFromInt(15)}, open, RiskStopMaxPayout},
+		{"under max payout", ResultSettings{RiskMode: RiskModeNone, MaxPayout: MoneyFromInt(25)}, open, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGameContext()
+			g.settings = tt.settings
+			g.players["p1"] = &AviatorPlayerInfo{AccountId: "1&&demo", Currency: MainCurrency(), BetList: tt.bets}
+			if got := g.RiskStop(2); got != tt.want {
+				t.Errorf("RiskStop(2) = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundRecordRiskStop(t *testing.T) {
+	g := NewGameContext()
+	g.crashPoint = 5.2
+	g.CurMultiplier = 1.3
+	g.riskStop = RiskStopNoLoss
+	record := g.RoundRecord()
+	if record.CrashPoint != 5.2 || record.RiskStop != RiskStopNoLoss || record.Multiplier != 1.3 {
+		t.Errorf("record = crashPoint %v riskStop %q multiplier %v", record.CrashPoint, record.RiskStop, record.Multiplier)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import "slices"
+
+// SFS2X VariableType
+const (
+	VarTypeNull   = 0
+	VarTypeBool   = 1
+	VarTypeInt    = 2
+	VarTypeDouble = 3
+	VarTypeString = 4
+)
+
+const maxClientRoomVariables = 20
+
+// 服务端维护的房间变量，客户端只读
+var serverRoomVariableNames = []string{"currency", "minBet", "maxBet"}
+
+type RoomVariable struct {
+	Name         string
+	Type         byte
+	Value        interface{}
+	IsPrivate    bool
+	IsPersistent bool
+}
+
+// ServerRoomVariables 由房间配置生成的初始变量
+func ServerRoomVariables(cfg RoomConfig) []RoomVariable {
+	return []RoomVariable{
+		{Name: "currency", Type: VarTypeString, Value: cfg.Currency, IsPersistent: true},
+		{Name: "minBet", Type: VarTypeDouble, Value: cfg.MinBet, IsPersistent: true},
+		{Name: "maxBet", Type: VarTypeDouble, Value: cfg.MaxBet, IsPersistent: true},
+	}
+}
+
+// ToSFSArray 房间变量的SFS2X数组格式：name, type, value, isPrivate, isPersistent
+func (v RoomVariable) ToSFSArray() []interface{} {
+	return []interface{}{v.Name, byte(v.Type), v.Value, v.IsPrivate, v.IsPersistent}
+}
+
+// RoomVariableFromSFSArray 解析客户端发来的房间变量，类型和值不匹配时返回 false
+func RoomVariableFromSFSArray(arr []interface{}) (RoomVariable, bool) {
+	var v RoomVariable
+	if len(arr) < 3 {
+		return v, false
+	}
+	name, ok := arr[0].(string)
+	if !ok || name == "" {
+		return v, false
+	}
+	typ, ok := arr[1].(byte)
+	if !ok {
+		return v, false
+	}
+
+	switch typ {
+	case VarTypeNull:
+		ok = arr[2] == nil
+	case VarTypeBool:
+		_, ok = arr[2].(bool)
+	case VarTypeInt:
+		_, ok = arr[2].(int32)
+	case VarTypeDouble:
+		_, ok = arr[2].(float64)
+	case VarTypeString:
+		_, ok = arr[2].(string)
+	default:
+		ok = false
+	}
+	if !ok {
+		return v, false
+	}
+
+	v = RoomVariable{Name: name, Type: typ, Value: arr[2]}
+	if len(arr) > 3 {
+		v.IsPrivate, _ = arr[3].(bool)
+	}
+	if len(arr) > 4 {
+		v.IsPersistent, _ = arr[4].(bool)
+	}
+	return v, true
+}
+
+// SetVariables 更新变量，Null 类型表示删除；返回实际变化的变量
+func (r *GameRoom) SetVariables(vars []RoomVariable, fromServer bool) []RoomVariable {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	changed := make([]RoomVariable, 0, len(vars))
+	for _, v := range vars {
+		if !fromServer && slices.Contains(serverRoomVariableNames, v.Name) {
+			continue
+		}
+
+		idx := slices.IndexFunc(r.vars, func(old RoomVariable) bool {
+			return old.Name == v.Name
+		})
+		switch {
+		case v.Type == VarTypeNull:
+			if idx < 0 {
+				continue
+			}
+			r.vars = slices.Delete(r.vars, idx, idx+1)
+		case idx >= 0:
+			r.vars[idx] = v
+		default:
+			if !fromServer && len(r.vars) >= len(serverRoomVariableNames)+maxClientRoomVariables {
+				continue
+			}
+			r.vars = append(r.vars, v)
+		}
+		changed = append(changed, v)
+	}
+	return changed
+}
+
+func (r *GameRoom) VariablesSFSArray() []interface{} {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	list := []interface{}{}
+	for _, v := range r.vars {
+		list = append(list, v.ToSFSArray())
+	}
+	return list
+}
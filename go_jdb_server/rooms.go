@@ -0,0 +1,454 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const GameZone = "aviator_core_inst2_demo1"
+
+// SFS2X 服务端推送的房间事件
+const (
+	SFSEventUserEnterRoom   = 1000
+	SFSEventUserCountChange = 1001
+	SFSEventUserExitRoom    = 1004
+	SFSEventDisconnection   = 1005
+)
+
+// SFS2X ClientDisconnectionReason
+const (
+	SFSDisconnectIdle    = 0
+	SFSDisconnectKick    = 1
+	SFSDisconnectBan     = 2
+	SFSDisconnectUnknown = 3 // 服务器停机
+)
+
+// SFS2X 登录错误码
+const (
+	SFSErrLoginBadUsername = 2
+	SFSErrLoginBadPassword = 3
+	SFSErrGeneric          = 28 // 其他登录错误，如币种不受支持
+)
+
+// SFS2X 加入房间错误码
+const (
+	SFSErrJoinAlreadyJoined = 19
+	SFSErrJoinRoomFull      = 20
+	SFSErrJoinBadPassword   = 21
+	SFSErrJoinBadRoom       = 22
+	SFSErrJoinRoomLocked    = 23
+)
+
+// RoomConfig 一张独立的游戏桌，rooms.json 中每项对应一个房间
+type RoomConfig struct {
+	Id              int      `json:"id"`
+	Name            string   `json:"name"`
+	GroupId         string   `json:"groupId"`
+	Currency        string   `json:"currency"` // 限定币种，为空时接受所有币种
+	MinBet          Money    `json:"minBet"`   // 限定币种时覆盖币种限额
+	MaxBet          Money    `json:"maxBet"`
+	MaxUsers        int      `json:"maxUsers"`
+	TickMs          int      `json:"tickMs"`          // 游戏循环间隔，决定倍数刷新频率
+	Speed           float64  `json:"speed"`           // 倍数增长速度，1 为标准速度，2 为两倍速；为0时按1处理
+	Private         bool     `json:"private"`         // 私人桌不出现在房间列表中
+	Password        string   `json:"password"`        // 私人桌密码
+	AllowedAccounts []string `json:"allowedAccounts"` // 私人桌白名单，如VIP玩家
+}
+
+var DefaultRoomConfigs = []RoomConfig{
+	{Id: 0, Name: "game_state", GroupId: "default", MaxUsers: 20, TickMs: 500},
+}
+
+type GameRoom struct {
+	RoomConfig
+	g *AviatorGameContext
+
+	mutex sync.Mutex
+	vars  []RoomVariable
+}
+
+// Session 一个websocket连接的登录信息
+type Session struct {
+	conn      *websocket.Conn
+	UserId    int32
+	Username  string
+	AccountId string
+	Currency  string // 启动链接中的币种
+	loginObj  map[string]interface{}
+	room      *GameRoom
+}
+
+// RoomManager 管理进程内所有房间及连接所在房间
+type RoomManager struct {
+	mutex      sync.Mutex
+	rooms      []*GameRoom
+	sessions   map[*websocket.Conn]*Session
+	nextUserId int32
+}
+
+var rooms *RoomManager = nil
+
+// LoadRoomConfigs 读取房间配置，文件不存在时使用默认的单房间配置
+func LoadRoomConfigs(path string) ([]RoomConfig, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return DefaultRoomConfigs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var configs []RoomConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("%s: no rooms configured", path)
+	}
+	for idx, cfg := range configs {
+		for _, other := range configs[:idx] {
+			if other.Id == cfg.Id || other.Name == cfg.Name {
+				return nil, fmt.Errorf("%s: duplicate room %d %q", path, cfg.Id, cfg.Name)
+			}
+		}
+		if cfg.Speed < 0 {
+			return nil, fmt.Errorf("%s: room %d speed must not be negative", path, cfg.Id)
+		}
+	}
+	return configs, nil
+}
+
+func NewRoomManager(configs []RoomConfig) (*RoomManager, error) {
+	m := &RoomManager{
+		sessions:   make(map[*websocket.Conn]*Session),
+		nextUserId: 1928827,
+	}
+	for _, cfg := range configs {
+		if cfg.GroupId == "" {
+			cfg.GroupId = "default"
+		}
+		if cfg.MaxUsers <= 0 {
+			cfg.MaxUsers = 20
+		}
+		if cfg.TickMs <= 0 {
+			cfg.TickMs = 500
+		}
+		if cfg.Speed <= 0 {
+			cfg.Speed = 1
+		}
+
+		history, err := OpenRoundHistory(cfg.Id)
+		if err != nil {
+			return nil, fmt.Errorf("room %d history: %v", cfg.Id, err)
+		}
+		journal, err := RecoverJournal(cfg.Id, history)
+		if err != nil {
+			return nil, fmt.Errorf("room %d recover: %v", cfg.Id, err)
+		}
+		rainJournal, err := RecoverRainJournal(cfg.Id)
+		if err != nil {
+			return nil, fmt.Errorf("room %d recover rain: %v", cfg.Id, err)
+		}
+
+		g := NewGameContext()
+		g.history = history
+		g.journal = journal
+		g.rainJournal = rainJournal
+		g.RecordId = history.LastRoundId()
+		g.RoomId = cfg.Id
+		g.Currency = cfg.Currency
+		g.MinBet = cfg.MinBet
+		g.MaxBet = cfg.MaxBet
+		g.tickInterval = time.Duration(cfg.TickMs) * time.Millisecond
+		g.speed = cfg.Speed
+		room := &GameRoom{RoomConfig: cfg, g: g}
+		room.vars = ServerRoomVariables(cfg)
+		m.rooms = append(m.rooms, room)
+	}
+	return m, nil
+}
+
+// Start 每个房间启动自己的游戏循环
+func (m *RoomManager) Start() {
+	for _, room := range m.rooms {
+		room.g.Init()
+		room.g.NewGameInit()
+	}
+}
+
+func (m *RoomManager) Rooms() []*GameRoom {
+	return m.rooms
+}
+
+func (m *RoomManager) Room(id int) *GameRoom {
+	for _, room := range m.rooms {
+		if room.Id == id {
+			return room
+		}
+	}
+	return nil
+}
+
+func (m *RoomManager) RoomByName(name string) *GameRoom {
+	for _, room := range m.rooms {
+		if room.Name == name {
+			return room
+		}
+	}
+	return nil
+}
+
+// DefaultRoom 登录后自动加入的房间：优先回到有未结算下注的房间，否则为第一个接受该币种且未满的公开房间；
+// 没有可加入的房间时返回nil
+func (m *RoomManager) DefaultRoom(accountId string, currency string) *GameRoom {
+	for _, room := range m.rooms {
+		if room.g.HasOfflinePlayer(accountId) {
+			return room
+		}
+	}
+	for _, room := range m.rooms {
+		if !room.Private && room.AcceptsCurrency(currency) && room.g.HumanPlayers() < room.MaxUsers {
+			return room
+		}
+	}
+	return nil
+}
+
+func (m *RoomManager) OnLogin(conn *websocket.Conn, obj map[string]interface{}) *Session {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	username, _ := obj["un"].(string)
+	m.nextUserId++
+	session := &Session{
+		conn:      conn,
+		UserId:    m.nextUserId,
+		Username:  username,
+		AccountId: LoginAccountId(obj),
+		Currency:  LoginCurrency(obj),
+		loginObj:  obj,
+	}
+	m.sessions[conn] = session
+	return session
+}
+
+func (m *RoomManager) Session(conn *websocket.Conn) *Session {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.sessions[conn]
+}
+
+// RoomOf 连接当前所在房间
+func (m *RoomManager) RoomOf(conn *websocket.Conn) *GameRoom {
+	if session := m.Session(conn); session != nil {
+		return session.room
+	}
+	return nil
+}
+
+// Join 加入房间，先离开当前房间；失败时返回SFS错误码。成功后需调用 Enter 下发游戏数据
+func (m *RoomManager) Join(session *Session, room *GameRoom, password string) int {
+	if session.room == room {
+		return SFSErrJoinAlreadyJoined
+	}
+	if room.Private && !room.CanEnter(session.AccountId, password) {
+		return SFSErrJoinBadPassword
+	}
+	if !room.AcceptsCurrency(session.Currency) {
+		return SFSErrJoinRoomLocked
+	}
+	if room.g.HumanPlayers() >= room.MaxUsers && !room.g.HasOfflinePlayer(session.AccountId) {
+		return SFSErrJoinRoomFull
+	}
+
+	m.Leave(session)
+	m.mutex.Lock()
+	session.room = room
+	m.mutex.Unlock()
+	return 0
+}
+
+// Enter 下发房间的初始化数据并加入游戏，通知房间内其他玩家
+func (m *RoomManager) Enter(session *Session) {
+	room := session.room
+	if room == nil {
+		return
+	}
+	AfterLogin(session.conn, session.loginObj, room)
+	room.g.OnLogin(session.conn, session.loginObj)
+
+	m.SendToRoom(room, session, SFSEventUserEnterRoom, map[string]interface{}{
+		"r": int32(room.Id),
+		"u": session.ToSFSArray(),
+	})
+	m.S2cUserCountChange(room)
+}
+
+// Leave 离开当前房间，未结算的下注和自动下注保留到重连
+func (m *RoomManager) Leave(session *Session) {
+	m.mutex.Lock()
+	room := session.room
+	session.room = nil
+	m.mutex.Unlock()
+
+	if room == nil {
+		return
+	}
+	room.g.OnLogout(session.conn)
+
+	p := map[string]interface{}{
+		"r": int32(room.Id),
+		"u": session.UserId,
+	}
+	m.SendToRoom(room, session, SFSEventUserExitRoom, p)
+	WritePacket(session.conn, BuildSFSMessage(SFSEventUserExitRoom, 0, p))
+	m.S2cUserCountChange(room)
+}
+
+// Members 房间内的连接
+func (m *RoomManager) Members(room *GameRoom) []*Session {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	members := make([]*Session, 0)
+	for _, session := range m.sessions {
+		if session.room == room {
+			members = append(members, session)
+		}
+	}
+	return members
+}
+
+// UserList 房间内用户列表，JoinRoom 响应的 ul 字段
+func (m *RoomManager) UserList(room *GameRoom) []interface{} {
+	list := []interface{}{}
+	for _, session := range m.Members(room) {
+		list = append(list, session.ToSFSArray())
+	}
+	return list
+}
+
+// SendToRoom 向房间内除 except 外的所有连接发送系统消息
+func (m *RoomManager) SendToRoom(room *GameRoom, except *Session, a int16, p map[string]interface{}) {
+	packet := BuildSFSMessage(a, 0, p)
+	for _, session := range m.Members(room) {
+		if session == except {
+			continue
+		}
+		WritePacket(session.conn, packet)
+	}
+}
+
+// S2cUserCountChange 房间人数变化通知所有已登录连接
+func (m *RoomManager) S2cUserCountChange(room *GameRoom) {
+	packet := BuildSFSMessage(SFSEventUserCountChange, 0, map[string]interface{}{
+		"r":  int32(room.Id),
+		"uc": int16(room.g.HumanPlayers()),
+	})
+
+	m.mutex.Lock()
+	conns := make([]*websocket.Conn, 0, len(m.sessions))
+	for conn := range m.sessions {
+		conns = append(conns, conn)
+	}
+	m.mutex.Unlock()
+
+	for _, conn := range conns {
+		WritePacket(conn, packet)
+	}
+}
+
+// SetRoomVariables 更新房间变量并通知房间内所有连接，客户端不能修改服务端变量
+func (m *RoomManager) SetRoomVariables(room *GameRoom, vars []RoomVariable, fromServer bool) {
+	changed := room.SetVariables(vars, fromServer)
+	if len(changed) == 0 {
+		return
+	}
+
+	vl := []interface{}{}
+	for _, v := range changed {
+		vl = append(vl, v.ToSFSArray())
+	}
+	m.SendToRoom(room, nil, 11, map[string]interface{}{
+		"r":  int32(room.Id),
+		"vl": vl,
+	})
+}
+
+// ToSFSArray 用户的SFS2X数组格式：id, name, privilegeId, playerId, userVariables
+func (s *Session) ToSFSArray() []interface{} {
+	return []interface{}{s.UserId, s.Username, int16(0), int16(0), []interface{}{}}
+}
+
+// Kick 通知客户端被踢出并关闭连接，未结算的下注保留到重连
+func (m *RoomManager) Kick(room *GameRoom, accountId string) bool {
+	kicked := false
+	for _, session := range m.Members(room) {
+		if session.AccountId != accountId {
+			continue
+		}
+		WritePacketAndClose(session.conn, BuildSFSMessage(SFSEventDisconnection, 0, map[string]interface{}{
+			"dr": byte(SFSDisconnectKick),
+		}), nil)
+		kicked = true
+	}
+	return kicked
+}
+
+func (m *RoomManager) OnDisconnect(conn *websocket.Conn) {
+	session := m.Session(conn)
+	if session == nil {
+		return
+	}
+	m.Leave(session)
+
+	m.mutex.Lock()
+	delete(m.sessions, conn)
+	m.mutex.Unlock()
+}
+
+// AcceptsCurrency 限定币种的房间只接受该币种的玩家
+func (r *GameRoom) AcceptsCurrency(currency string) bool {
+	if r.Currency == "" {
+		return true
+	}
+	if currency == "" {
+		currency = MainCurrency()
+	}
+	return r.Currency == currency
+}
+
+// CanEnter 私人桌校验密码或白名单
+func (r *GameRoom) CanEnter(accountId string, password string) bool {
+	if slices.Contains(r.AllowedAccounts, accountId) {
+		return true
+	}
+	return r.Password != "" && r.Password == password
+}
+
+// ToSFSArray 房间的SFS2X数组格式：id, name, groupId, isGame, isHidden, isPasswordProtected, userCount, maxUsers, roomVariables
+func (r *GameRoom) ToSFSArray() []interface{} {
+	return []interface{}{
+		r.Id, r.Name, r.GroupId, false, r.Private, r.Password != "",
+		int16(r.g.HumanPlayers()), int16(r.MaxUsers), r.VariablesSFSArray(),
+	}
+}
+
+// RoomList 登录时下发的房间列表，不包含私人桌
+func (m *RoomManager) RoomList() []interface{} {
+	list := []interface{}{}
+	for _, room := range m.rooms {
+		if room.Private {
+			continue
+		}
+		list = append(list, room.ToSFSArray())
+	}
+	return list
+}
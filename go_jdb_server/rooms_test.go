@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestDefaultRoom(t *testing.T) {
+	newRecoveryTestData(t)
+	m, err := NewRoomManager([]RoomConfig{
+		{Id: 1, Name: "vip", Private: true, Password: "secret"},
+		{Id: 2, Name: "usd", Currency: "USD"},
+		{Id: 3, Name: "full", Currency: "EUR", MaxUsers: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+	m.Room(3).g.players["p1"] = &AviatorPlayerInfo{AccountId: "9&&demo", Currency: "EUR"}
+
+	tests := []struct {
+		currency string
+		want     *GameRoom
+	}{
+		{"USD", m.Room(2)},
+		{"EUR", nil}, // 唯一接受该币种的房间已满
+		{"PHP", nil}, // 只有私人桌和限定其他币种的房间
+	}
+	for _, tt := range tests {
+		t.Run(tt.currency, func(t *testing.T) {
+			if got := m.DefaultRoom("1&&demo", tt.currency); got != tt.want {
+				t.Errorf("DefaultRoom(%s) = %v, want %v", tt.currency, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoomSpeed(t *testing.T) {
+	newRecoveryTestData(t)
+	m, err := NewRoomManager([]RoomConfig{
+		{Id: 1, Name: "standard"},
+		{Id: 2, Name: "turbo", Speed: 2, TickMs: 250},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(m.Close)
+
+	standard, turbo := m.Room(1).g, m.Room(2).g
+	if got, want := turbo.GenOdds(5000), standard.GenOdds(10000); got != want {
+		t.Errorf("turbo odds after 5s = %v, want standard odds after 10s %v", got, want)
+	}
+	if turbo.GenOdds(10000) <= standard.GenOdds(10000) {
+		t.Errorf("turbo room does not fly faster: %v <= %v", turbo.GenOdds(10000), standard.GenOdds(10000))
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+)
+
+// ServerConfig 监听地址、TLS 和跨域设置，读取 server.json（可选），命令行参数覆盖文件中的值
+type ServerConfig struct {
+	Listen         string   `json:"listen"`      // 玩家端：websocket、frontendAPI.do、客户端上报
+	AdminListen    string   `json:"adminListen"` // 运营后台和 /metrics，为空时与玩家端共用监听地址
+	TLSCertFile    string   `json:"tlsCertFile"` // 证书和私钥都填写时启用 TLS，两个监听地址共用
+	TLSKeyFile     string   `json:"tlsKeyFile"`
+	AllowedOrigins []string `json:"allowedOrigins"` // 浏览器来源白名单，CORS 和 websocket 共用；"*" 表示不限制
+	TrustedProxies []string `json:"trustedProxies"` // 反向代理的 IP 或 CIDR，只有来自这些地址的 X-Forwarded-For 才被采用；为空时以对端地址为准
+
+	PingIntervalMs              int `json:"pingIntervalMs"`              // 服务端 websocket ping 间隔，同时下发给客户端
+	InactivityTimeForDisconnect int `json:"inactivityTimeForDisconnect"` // 玩家无操作多少秒后断开，0 表示不断开，同时下发给客户端
+}
+
+func DefaultServerConfig() ServerConfig {
+	return ServerConfig{
+		Listen:         ":3333",
+		AllowedOrigins: []string{"*"},
+		PingIntervalMs: 15000,
+	}
+}
+
+// LoadServerConfig 先读取 -config 指定的文件，再用命令行中出现的参数覆盖
+func LoadServerConfig(args []string) (ServerConfig, error) {
+	config := DefaultServerConfig()
+
+	flags := flag.NewFlagSet("go_ws_server", flag.ContinueOnError)
+	path := flags.String("config", "server.json", "server config file")
+	listen := flags.String("listen", "", "player listen address, e.g. :3333")
+	adminListen := flags.String("admin-listen", "", "admin listen address, empty to serve admin routes on the player listener")
+	certFile := flags.String("tls-cert", "", "TLS certificate file")
+	keyFile := flags.String("tls-key", "", "TLS private key file")
+	origins := flags.String("allowed-origins", "", "comma separated allowed browser origins, * for any")
+	proxies := flags.String("trusted-proxies", "", "comma separated reverse proxy IPs or CIDRs whose X-Forwarded-For is trusted")
+	if err := flags.Parse(args); err != nil {
+		return config, err
+	}
+
+	data, err := os.ReadFile(*path)
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return config, fmt.Errorf("parse %s: %v", *path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return config, err
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "listen":
+			config.Listen = *listen
+		case "admin-listen":
+			config.AdminListen = *adminListen
+		case "tls-cert":
+			config.TLSCertFile = *certFile
+		case "tls-key":
+			config.TLSKeyFile = *keyFile
+		case "allowed-origins":
+			config.AllowedOrigins = strings.Split(*origins, ",")
+		case "trusted-proxies":
+			config.TrustedProxies = nil
+			for _, proxy := range strings.Split(*proxies, ",") {
+				if proxy = strings.TrimSpace(proxy); proxy != "" {
+					config.TrustedProxies = append(config.TrustedProxies, proxy)
+				}
+			}
+		}
+	})
+	for idx, origin := range config.AllowedOrigins {
+		config.AllowedOrigins[idx] = strings.TrimRight(strings.TrimSpace(origin), "/")
+	}
+
+	if err := config.Validate(); err != nil {
+		return config, fmt.Errorf("%s: %v", *path, err)
+	}
+	return config, nil
+}
+
+func (c *ServerConfig) Validate() error {
+	if _, _, err := net.SplitHostPort(c.Listen); err != nil {
+		return fmt.Errorf("invalid listen address %q", c.Listen)
+	}
+	if c.AdminListen != "" {
+		if _, _, err := net.SplitHostPort(c.AdminListen); err != nil {
+			return fmt.Errorf("invalid adminListen address %q", c.AdminListen)
+		}
+		if c.AdminListen == c.Listen {
+			return fmt.Errorf("adminListen must differ from listen")
+		}
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("tlsCertFile and tlsKeyFile must be set together")
+	}
+	if len(c.AllowedOrigins) == 0 {
+		return fmt.Errorf("allowedOrigins must not be empty, use \"*\" to allow any origin")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			return fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+		}
+	}
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				return fmt.Errorf("invalid trusted proxy %q, expected an IP or CIDR", proxy)
+			}
+		}
+	}
+	if c.PingIntervalMs < 1000 {
+		return fmt.Errorf("pingIntervalMs must be at least 1000")
+	}
+	if c.InactivityTimeForDisconnect < 0 {
+		return fmt.Errorf("inactivityTimeForDisconnect must not be negative")
+	}
+	return nil
+}
+
+func (c *ServerConfig) PingInterval() time.Duration {
+	return time.Duration(c.PingIntervalMs) * time.Millisecond
+}
+
+// InactivityTimeout 0 表示不因无操作断开
+func (c *ServerConfig) InactivityTimeout() time.Duration {
+	return time.Duration(c.InactivityTimeForDisconnect) * time.Second
+}
+
+func (c *ServerConfig) TLS() bool {
+	return c.TLSCertFile != ""
+}
+
+func (c *ServerConfig) AnyOrigin() bool {
+	return slices.Contains(c.AllowedOrigins, "*")
+}
+
+// OriginAllowed 请求头没有 Origin 的非浏览器客户端不受限制
+func (c *ServerConfig) OriginAllowed(origin string) bool {
+	if origin == "" || c.AnyOrigin() {
+		return true
+	}
+	return slices.Contains(c.AllowedOrigins, strings.TrimRight(origin, "/"))
+}
+
+// NewRouter 新建 gin 路由：c.ClientIP() 只采用可信代理转发的 X-Forwarded-For，
+// 防刷限制、封禁、审计和日志中的地址都以此为准
+func (c *ServerConfig) NewRouter() (*gin.Engine, error) {
+	r := gin.New()
+	if err := r.SetTrustedProxies(c.TrustedProxies); err != nil {
+		return nil, err
+	}
+	r.Use(gin.Recovery(), ginLogger, c.CORS())
+	r.GET("/healthz", healthzHandler)
+	r.GET("/readyz", readyzHandler)
+	return r, nil
+}
+
+// CORS 白名单模式下回显来源并允许携带凭据；不限制来源时不允许携带凭据
+func (c *ServerConfig) CORS() gin.HandlerFunc {
+	config := cors.Config{
+		AllowMethods:  []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowHeaders:  []string{"Origin", "Content-Type", "Accept", "Authorization", "key", "timestamp", "x-trace-id", "x-token", "client-version", "User-Agent", "Cache-Control", "Pragma", "Expires"},
+		ExposeHeaders: []string{"Content-Length"},
+		MaxAge:        12 * time.Hour,
+	}
+	if c.AnyOrigin() {
+		config.AllowAllOrigins = true
+	} else {
+		config.AllowOriginFunc = c.OriginAllowed
+		config.AllowCredentials = true
+	}
+	return cors.New(config)
+}
+
+// WebsocketURL 启动日志中显示的地址
+func (c *ServerConfig) WebsocketURL() string {
+	scheme := "ws"
+	if c.TLS() {
+		scheme = "wss"
+	}
+	host, port, _ := net.SplitHostPort(c.Listen)
+	if host == "" {
+		host = "localhost"
+	}
+	return fmt.Sprintf("%s://%s/websocket", scheme, net.JoinHostPort(host, port))
+}
+
+// Serve 在后台启动监听，异常退出时把错误写入 errs
+func (c *ServerConfig) Serve(srv *http.Server, errs chan<- error) {
+	go func() {
+		var err error
+		if c.TLS() {
+			err = srv.ListenAndServeTLS(c.TLSCertFile, c.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			errs <- fmt.Errorf("%s: %v", srv.Addr, err)
+		}
+	}()
+}
+
+var serverConfig = DefaultServerConfig()
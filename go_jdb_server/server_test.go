@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestNewRouterClientIP(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name    string
+		proxies []string
+		remote  string
+		xff     string
+		want    string
+	}{
+		{"no proxies ignores the header", nil, "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", []string{"10.0.0.0/8"}, "10.1.2.3:5000", "198.51.100.1", "198.51.100.1"},
+		{"untrusted peer", []string{"10.0.0.0/8"}, "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"spoofed hop before the proxy", []string{"10.0.0.1"}, "10.0.0.1:5000", "1.1.1.1, 198.51.100.1", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultServerConfig()
+			config.TrustedProxies = tt.proxies
+			if err := config.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			r, err := config.NewRouter()
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.GET("/ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+			req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			req.RemoteAddr = tt.remote
+			req.Header.Set("X-Forwarded-For", tt.xff)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if got := w.Body.String(); got != tt.want {
+				t.Errorf("ClientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerConfigTrustedProxiesValidate(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.1", "10.0.0.0/8", "::1", "fd00::/8"} {
+		config := DefaultServerConfig()
+		config.TrustedProxies = []string{proxy}
+		if err := config.Validate(); err != nil {
+			t.Errorf("Validate(%q) = %v", proxy, err)
+		}
+	}
+	for _, proxy := range []string{"proxy.local", "10.0.0.0/33", ""} {
+		config := DefaultServerConfig()
+		config.TrustedProxies = []string{proxy}
+		if err := config.Validate(); err == nil {
+			t.Errorf("Validate(%q) accepted", proxy)
+		}
+	}
+}
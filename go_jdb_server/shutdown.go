@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	shutdownRoundTimeout = 2 * time.Minute  // 等待进行中的牌局结算的最长时间
+	shutdownHttpTimeout  = 10 * time.Second // 等待 HTTP 请求处理完的最长时间
+)
+
+// shuttingDown 收到停机信号后置位：不再接受新连接和下注，/readyz 返回 503
+var shuttingDown atomic.Bool
+
+var wsConns sync.Map // *websocket.Conn -> struct{}，所有已升级的连接，包括未登录的
+
+// healthzHandler 进程存活检查
+func healthzHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": "ok"})
+}
+
+// readyzHandler 是否可以接收新玩家，停机期间返回 503 让负载均衡摘除本实例
+func readyzHandler(c *gin.Context) {
+	if rooms == nil || shuttingDown.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "not ready"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": "ready"})
+}
+
+// Drain 停机时调用：不再接受下注，进行中的牌局照常结算，之后不再开新局。
+// 没有进行中的牌局或房间已暂停时立即停止；返回的通道在游戏循环停止后关闭
+func (g *AviatorGameContext) Drain() <-chan struct{} {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.drained == nil {
+		g.drained = make(chan struct{})
+	}
+	g.draining = true
+	//暂停的牌局留给重启后的流水恢复处理
+	if g.paused || g.CurStage == EAviatorStageNone || g.CurStage == EAviatorStageZero || g.CurStage == EAviatorStageCashOutAward {
+		g.finishDrain()
+	}
+	return g.drained
+}
+
+// finishDrain 停止游戏循环，调用方需持有 g.mutex
+func (g *AviatorGameContext) finishDrain() {
+	g.StopTimer()
+	select {
+	case <-g.drained:
+	default:
+		close(g.drained)
+		g.log().Info("房间已停止")
+	}
+}
+
+// Drain 等待所有房间的牌局结算；超时时强制停止游戏循环，未结算的牌局在重启后由流水恢复
+func (m *RoomManager) Drain(ctx context.Context) error {
+	waits := make([]<-chan struct{}, 0, len(m.rooms))
+	for _, room := range m.rooms {
+		waits = append(waits, room.g.Drain())
+	}
+	for idx, wait := range waits {
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			for _, room := range m.rooms[idx:] {
+				room.g.mutex.Lock()
+				room.g.finishDrain()
+				room.g.mutex.Unlock()
+			}
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// DisconnectAll 通知所有连接服务器断开并关闭，包括尚未登录的连接
+func (m *RoomManager) DisconnectAll() {
+	packet := BuildSFSMessage(SFSEventDisconnection, 0, map[string]interface{}{
+		"dr": byte(SFSDisconnectUnknown),
+	})
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	wsConns.Range(func(key, _ any) bool {
+		WritePacketAndClose(key.(*websocket.Conn), packet, closeMsg)
+		return true
+	})
+	// 等待断开通知发出，慢速连接最多等一个写超时
+	if !WaitWriters(wsWriteWait) {
+		logMain.Warn("部分连接的断开通知未能发出")
+	}
+}
+
+// Close 关闭各房间的历史和流水文件，需在游戏循环停止后调用；之后运营后台的作废等操作因流水已关闭而失败
+func (m *RoomManager) Close() {
+	for _, room := range m.rooms {
+		room.g.mutex.Lock()
+		if err := room.g.history.Close(); err != nil {
+			logStore.Error("牌局历史关闭失败", "room", room.Id, "err", err)
+		}
+		for _, journal := range []*Journal{room.g.journal, room.g.rainJournal} {
+			if journal == nil {
+				continue
+			}
+			if err := journal.Close(); err != nil {
+				logStore.Error("流水关闭失败", "room", room.Id, "journal", journal.key, "err", err)
+			}
+		}
+		room.g.mutex.Unlock()
+	}
+}
+
+// Shutdown 优雅停机：摘除流量、等进行中的牌局结算、断开客户端、停止 HTTP 服务，最后关闭持久化文件
+func Shutdown(servers ...*http.Server) {
+	logMain.Info("开始停机")
+	shuttingDown.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownRoundTimeout)
+	defer cancel()
+	if err := rooms.Drain(ctx); err != nil {
+		logMain.Warn("等待牌局结算超时，未结算的牌局将在重启后恢复", "err", err)
+	}
+
+	rooms.DisconnectAll()
+
+	httpCtx, httpCancel := context.WithTimeout(context.Background(), shutdownHttpTimeout)
+	defer httpCancel()
+	for _, srv := range servers {
+		if err := srv.Shutdown(httpCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logMain.Warn("HTTP 服务停止超时", "addr", srv.Addr, "err", err)
+		}
+	}
+
+	rooms.Close()
+	// 余额变动只在清空流水时批量写盘，停机时补写一次；失败时重启后按流水重放
+	wallets.Sync()
+	leaderboards.Flush()
+	if err := auditLog.Close(); err != nil {
+		logStore.Error("审计日志关闭失败", "err", err)
+	}
+	if err := resultSettings.Close(); err != nil {
+		logStore.Error("开奖设置关闭失败", "err", err)
+	}
+	if err := accounts.Close(); err != nil {
+		logStore.Error("账号文件关闭失败", "err", err)
+	}
+	telemetry.Close()
+	logMain.Info("停机完成")
+}
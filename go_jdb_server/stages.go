@@ -0,0 +1,136 @@
+package main
+
+import (
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// EAviatorStageNone 房间启动前，第一局开始时进入 EAviatorStageZero
+const EAviatorStageNone = -1
+
+// stageTransitions 每个阶段允许切换到的阶段：
+// 开局 -> 下注 -> 飞行 -> 爆炸后展示 -> 开局；下注和飞行阶段作废时直接进入爆炸后展示
+var stageTransitions = map[int32][]int32{
+	EAviatorStageNone:         {EAviatorStageZero},
+	EAviatorStageZero:         {EAviatorStageBet},
+	EAviatorStageBet:          {EAviatorStageCashOut, EAviatorStageCashOutAward},
+	EAviatorStageCashOut:      {EAviatorStageCashOutAward},
+	EAviatorStageCashOutAward: {EAviatorStageZero},
+}
+
+// UpdateStatus 切换阶段：依次执行旧阶段的退出、写流水、新阶段的进入，并通知客户端。
+// 不在 stageTransitions 中的切换被拒绝
+func (g *AviatorGameContext) UpdateStatus(newStatus int32) {
+	oldStatus := g.CurStage
+	if !slices.Contains(stageTransitions[oldStatus], newStatus) {
+		g.log().Error("非法的阶段切换", "from", oldStatus, "to", newStatus)
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	if oldStatus != EAviatorStageNone {
+		g.onExitStage(oldStatus, now)
+	}
+	g.CurStage = newStatus
+	g.curStateStartTime = now
+	g.stageDeadline = 0
+	if duration := StageDuration(newStatus); duration > 0 {
+		g.stageDeadline = now + duration.Milliseconds()
+	}
+	g.Journal(JournalEntry{Type: JournalStage, Stage: newStatus}, nil)
+	g.onEnterStage(newStatus)
+}
+
+// onExitStage 离开阶段
+func (g *AviatorGameContext) onExitStage(stage int32, now int64) {
+	logGame.Debug("阶段结束", "room", g.RoomId, "round", g.RecordId, "stage", stage, "elapsedMs", now-g.curStateStartTime)
+
+	switch stage {
+	case EAviatorStageBet:
+		// 下注截止，飞行开始前下发最终的下注列表
+		g.S2cUpdateCurrentBets()
+	}
+}
+
+// onEnterStage 进入阶段，每个阶段都通知客户端
+func (g *AviatorGameContext) onEnterStage(stage int32) {
+	logGame.Debug("阶段开始", "room", g.RoomId, "round", g.RecordId, "stage", stage)
+
+	switch stage {
+	case EAviatorStageBet:
+		// 后台修改的开奖设置从下一个下注阶段开始生效
+		g.settings = resultSettings.Current()
+		g.crashPoint, g.riskStop = 0, ""
+	case EAviatorStageCashOut:
+		// 客户端种子在下注阶段收集完毕
+		g.crashPoint = CrashPoint(g.serverSeed, g.clientSeeds, g.settings.Rtp, g.settings.MaxMultiplier)
+		g.riskStop = ""
+	}
+
+	g.S2cChangeState(stage)
+
+	if stage == EAviatorStageBet {
+		g.PlaceAutoBets()
+	}
+}
+
+// Snapshot 当前牌局的完整状态，accountId 不为空时附带该玩家本局的下注。调用方需持有 g.mutex
+func (g *AviatorGameContext) Snapshot(accountId string) RoundSnapshot {
+	now := time.Now().UnixMilli()
+	elapsedUntil := now
+	if g.paused {
+		elapsedUntil = g.pausedAt
+	}
+	snapshot := RoundSnapshot{
+		Code:               200,
+		RoundID:            g.RecordId,
+		StageID:            int(g.CurStage),
+		StateStartTime:     g.curStateStartTime,
+		ServerTime:         now,
+		Elapsed:            max(elapsedUntil-g.curStateStartTime, 0),
+		Paused:             g.paused,
+		Multiplier:         g.CurMultiplier,
+		BetsCount:          g.BetsCount(),
+		OpenBetsCount:      g.OpenBetsCount(),
+		TotalCashOut:       g.TotalCashOut,
+		ActivePlayersCount: g.OnlinePlayers(),
+		Bets:               append([]Bet{}, g.CurrentBets...),
+		CashOuts:           append([]CashOut{}, g.CashOuts...),
+		ActiveBets:         []Bet{},
+	}
+	if end, ok := g.StageEndTime(); ok && !g.paused {
+		snapshot.TimeLeft = max(end-now, 0)
+	}
+	if accountId != "" {
+		for _, bet := range g.CurrentBets {
+			if bet.PlayerID == accountId {
+				snapshot.ActiveBets = append(snapshot.ActiveBets, bet)
+			}
+		}
+	}
+	return snapshot
+}
+
+// LoginSnapshot 登录初始化数据使用的牌局状态
+func (g *AviatorGameContext) LoginSnapshot(accountId string) RoundSnapshot {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.Snapshot(accountId)
+}
+
+// S2cSnapshot 向玩家下发牌局快照
+func (g *AviatorGameContext) S2cSnapshot(player *AviatorPlayerInfo) {
+	result, _ := StructToMap(g.Snapshot(player.AccountId))
+	g.SendToClient(player, "snapshot", result)
+}
+
+// C2sSnapshot 客户端随时可以请求快照，例如切回前台或漏收消息后
+func (g *AviatorGameContext) C2sSnapshot(conn *websocket.Conn) {
+	playerInfo := g.players[conn.RemoteAddr().String()]
+	if playerInfo == nil {
+		return
+	}
+	g.S2cSnapshot(playerInfo)
+}
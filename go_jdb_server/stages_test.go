@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStageDeadline(t *testing.T) {
+	tests := []struct {
+		name      string
+		stage     int32
+		remaining time.Duration // 距截止时间的剩余时长，负数表示已过截止时间
+		want      int32
+	}{
+		{"bet before deadline", EAviatorStageBet, time.Second, EAviatorStageBet},
+		{"bet past deadline", EAviatorStageBet, -time.Millisecond, EAviatorStageCashOut},
+		{"award before deadline", EAviatorStageCashOutAward, time.Second, EAviatorStageCashOutAward},
+		{"award past deadline", EAviatorStageCashOutAward, -time.Millisecond, EAviatorStageBet},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newVoidTestRoom(t)
+			g.CurStage = tt.stage
+			g.stageDeadline = time.Now().Add(tt.remaining).UnixMilli()
+
+			g.OnTick()
+			if g.CurStage != tt.want {
+				t.Fatalf("stage = %d, want %d", g.CurStage, tt.want)
+			}
+		})
+	}
+}
+
+func TestStageEndTime(t *testing.T) {
+	tests := []struct {
+		name   string
+		from   int32
+		to     int32
+		want   time.Duration
+		wantOk bool
+	}{
+		{"bet", EAviatorStageZero, EAviatorStageBet, BET_TIME, true},
+		{"award", EAviatorStageCashOut, EAviatorStageCashOutAward, CASH_OUT_TIME, true},
+		{"flight has no fixed end", EAviatorStageBet, EAviatorStageCashOut, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newVoidTestRoom(t)
+			g.CurStage = tt.from
+			g.UpdateStatus(tt.to)
+
+			end, ok := g.StageEndTime()
+			if ok != tt.wantOk {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOk)
+			}
+			if ok && end != g.curStateStartTime+tt.want.Milliseconds() {
+				t.Fatalf("end = %d, want start %d + %d", end, g.curStateStartTime, tt.want.Milliseconds())
+			}
+		})
+	}
+}
+
+func TestResumeShiftsStageDeadline(t *testing.T) {
+	g := newVoidTestRoom(t)
+	g.CurStage = EAviatorStageZero
+	g.UpdateStatus(EAviatorStageBet)
+	deadline := g.stageDeadline
+
+	g.paused = true
+	g.pausedAt = time.Now().Add(-2 * time.Second).UnixMilli()
+	if err := g.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	g.StopTimer()
+	if shift := g.stageDeadline - deadline; shift < 2000 {
+		t.Fatalf("deadline shifted by %dms, want at least 2000", shift)
+	}
+}
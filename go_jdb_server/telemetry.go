@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 客户端上报类型
+const (
+	TelemetryLog = "log" // /batchLog
+	TelemetryRum = "rum" // /rum
+)
+
+const (
+	telemetryKeep       = 10000            // 内存中保留的上报条数，供客服查询
+	telemetryFileSize   = 50 * 1024 * 1024 // 单个文件大小上限
+	telemetryFileKeep   = 5                // 轮转保留的旧文件个数
+	telemetryQueueSize  = 1000             // 等待导出的批次
+	telemetryExportWait = 5 * time.Second  // 导出请求超时
+)
+
+// TelemetryEvent 一条客户端日志或 RUM 上报，Data 为客户端原始内容，其余字段由服务端补充
+type TelemetryEvent struct {
+	Kind       string          `json:"kind"`
+	ReceivedAt int64           `json:"receivedAt"`                 // 毫秒时间戳
+	AccountId  string          `json:"accountId,omitempty"`        // 登录令牌校验通过的账号
+	ClaimedId  string          `json:"claimedAccountId,omitempty"` // 上报内容中自称的账号，未经校验，不用于查询
+	SessionId  string          `json:"sessionId,omitempty"`
+	Remote     string          `json:"remote"`
+	UserAgent  string          `json:"userAgent,omitempty"`
+	ID         string          `json:"id,omitempty"`
+	Namespace  string          `json:"namespace,omitempty"`
+	Level      string          `json:"level,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// TelemetryExporter 把上报转发到外部系统，在后台协程中调用
+type TelemetryExporter interface {
+	Name() string
+	Export(events []TelemetryEvent) error
+}
+
+// Telemetry 客户端上报：写入本地轮转文件，保留最近的记录供查询，并交给导出器
+type Telemetry struct {
+	mutex     sync.Mutex
+	sink      *RotatingFile
+	events    []TelemetryEvent
+	next      int // 环形缓冲区下一个写入位置
+	exporters []TelemetryExporter
+	queue     chan []TelemetryEvent
+}
+
+var telemetry = NewTelemetry(nil)
+
+// NewTelemetry sink 为空时不写文件
+func NewTelemetry(sink *RotatingFile) *Telemetry {
+	t := &Telemetry{
+		sink:   sink,
+		events: make([]TelemetryEvent, 0, telemetryKeep),
+		queue:  make(chan []TelemetryEvent, telemetryQueueSize),
+	}
+	go t.exportLoop()
+	return t
+}
+
+func OpenTelemetry() (*Telemetry, error) {
+	sink, err := OpenRotatingFile(filepath.Join(DataDir, "telemetry", "client.jsonl"), telemetryFileSize, telemetryFileKeep)
+	if err != nil {
+		return nil, err
+	}
+	return NewTelemetry(sink), nil
+}
+
+// AddExporter 需在开始接收上报前调用
+func (t *Telemetry) AddExporter(exporter TelemetryExporter) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.exporters = append(t.exporters, exporter)
+}
+
+// Ingest 保存一批上报；导出队列满时丢弃该批次的导出，本地文件不受影响
+func (t *Telemetry) Ingest(events []TelemetryEvent) {
+	if len(events) == 0 {
+		return
+	}
+	t.mutex.Lock()
+	for _, event := range events {
+		if len(t.events) < telemetryKeep {
+			t.events = append(t.events, event)
+		} else {
+			t.events[t.next] = event
+		}
+		t.next = (t.next + 1) % telemetryKeep
+		if t.sink != nil {
+			if data, err := json.Marshal(event); err == nil {
+				if err := t.sink.WriteLine(data); err != nil {
+					logTelemetry.Error("客户端日志写入失败", "err", err)
+				}
+			}
+		}
+	}
+	hasExporters := len(t.exporters) > 0
+	t.mutex.Unlock()
+
+	if hasExporters {
+		select {
+		case t.queue <- events:
+		default:
+			logTelemetry.Warn("导出队列已满，丢弃本批上报", "events", len(events))
+		}
+	}
+}
+
+func (t *Telemetry) exportLoop() {
+	for events := range t.queue {
+		t.mutex.Lock()
+		exporters := append([]TelemetryExporter{}, t.exporters...)
+		t.mutex.Unlock()
+		for _, exporter := range exporters {
+			if err := exporter.Export(events); err != nil {
+				logTelemetry.Error("客户端日志导出失败", "exporter", exporter.Name(), "err", err)
+			}
+		}
+	}
+}
+
+// Close 停止接收导出并关闭本地文件，已排队的批次不再导出
+func (t *Telemetry) Close() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.sink != nil {
+		if err := t.sink.Close(); err != nil {
+			logTelemetry.Error("客户端日志关闭失败", "err", err)
+		}
+		t.sink = nil
+	}
+}
+
+// Recent 玩家最近的 n 条上报，最新的在前；level、kind 为空时不过滤
+func (t *Telemetry) Recent(accountId string, level string, kind string, n int) []TelemetryEvent {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	list := make([]TelemetryEvent, 0, n)
+	for i := 1; i <= len(t.events) && len(list) < n; i++ {
+		event := t.events[(t.next-i+len(t.events))%len(t.events)]
+		if event.AccountId != accountId {
+			continue
+		}
+		if level != "" && !strings.EqualFold(event.Level, level) {
+			continue
+		}
+		if kind != "" && event.Kind != kind {
+			continue
+		}
+		list = append(list, event)
+	}
+	return list
+}
+
+// RotatingFile 按大小轮转的追加文件：client.jsonl 写满后改名为 client.jsonl.1，依次后移
+type RotatingFile struct {
+	mutex   sync.Mutex
+	path    string
+	maxSize int64
+	keep    int
+	file    *os.File
+	size    int64
+}
+
+func OpenRotatingFile(path string, maxSize int64, keep int) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f := &RotatingFile{path: path, maxSize: maxSize, keep: keep}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+// rotate 轮转失败时重新打开原文件继续写入；原文件也打不开时 f.file 为 nil，下次写入时重试
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+	f.file = nil
+	os.Remove(fmt.Sprintf("%s.%d", f.path, f.keep))
+	for i := f.keep - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", f.path, i), fmt.Sprintf("%s.%d", f.path, i+1))
+	}
+	renameErr := os.Rename(f.path, f.path+".1")
+	if err := f.open(); err != nil {
+		return errors.Join(renameErr, err)
+	}
+	return renameErr
+}
+
+func (f *RotatingFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// WriteLine 写入一行，超过大小上限时先轮转
+func (f *RotatingFile) WriteLine(data []byte) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	if f.size > 0 && f.size+int64(len(data))+1 > f.maxSize {
+		if err := f.rotate(); err != nil {
+			logTelemetry.Error("客户端日志轮转失败", "path", f.path, "err", err)
+			if f.file == nil {
+				return err
+			}
+		}
+	}
+	n, err := f.file.Write(append(data, '\n'))
+	f.size += int64(n)
+	return err
+}
+
+// HTTPExporter 把每批上报以 JSON 数组 POST 到外部日志服务
+type HTTPExporter struct {
+	url    string
+	client *http.Client
+}
+
+func NewHTTPExporter(url string) *HTTPExporter {
+	return &HTTPExporter{url: url, client: &http.Client{Timeout: telemetryExportWait}}
+}
+
+func (e *HTTPExporter) Name() string {
+	return e.url
+}
+
+func (e *HTTPExporter) Export(events []TelemetryEvent) error {
+	data, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+const telemetryBodyLimit = 1 << 20 // 单次上报的大小上限
+
+// telemetryIdentity 上报的玩家和会话：玩家只取自校验通过的登录令牌
+func telemetryIdentity(c *gin.Context) (accountId string, sessionId string) {
+	token := c.GetHeader("x-token")
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		token = c.Query("token")
+	}
+	if token != "" {
+		if claims, err := launch.VerifyToken(token); err == nil {
+			accountId = fmt.Sprintf("%d&&%s", claims.UserId, claims.Operator)
+		}
+	}
+	return accountId, c.GetHeader("x-trace-id")
+}
+
+// telemetryEvents 把客户端原始内容拆成上报记录：JSON 数组每项一条，其他内容整体一条
+func telemetryEvents(c *gin.Context, kind string, body []byte) []TelemetryEvent {
+	accountId, sessionId := telemetryIdentity(c)
+	base := TelemetryEvent{
+		Kind:       kind,
+		ReceivedAt: time.Now().UnixMilli(),
+		AccountId:  accountId,
+		SessionId:  sessionId,
+		Remote:     c.ClientIP(),
+		UserAgent:  c.GetHeader("User-Agent"),
+	}
+
+	items := make([]json.RawMessage, 0)
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil
+	}
+	if trimmed[0] != '[' || json.Unmarshal(trimmed, &items) != nil {
+		if !json.Valid(trimmed) {
+			trimmed, _ = json.Marshal(string(trimmed))
+		}
+		items = []json.RawMessage{trimmed}
+	}
+
+	events := make([]TelemetryEvent, 0, len(items))
+	for _, item := range items {
+		event := base
+		event.Data = item
+		var fields map[string]interface{}
+		if json.Unmarshal(item, &fields) == nil {
+			event.ID = telemetryField(fields, "id")
+			event.Namespace = telemetryField(fields, "namespace")
+			event.Level = telemetryField(fields, "level")
+			event.Message = telemetryField(fields, "message", "msg")
+			if claimed := telemetryField(fields, "accountId", "userId", "uid"); claimed != event.AccountId {
+				event.ClaimedId = claimed
+			}
+			if event.SessionId == "" {
+				event.SessionId = telemetryField(fields, "sessionId", "traceId")
+			}
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+func telemetryField(fields map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if v, ok := fields[key]; ok && v != nil {
+			if str, ok := v.(string); ok {
+				return str
+			}
+			return fmt.Sprint(v)
+		}
+	}
+	return ""
+}
+
+func readTelemetryBody(c *gin.Context) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, telemetryBodyLimit))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "body too large"})
+		return nil, false
+	}
+	return body, true
+}
+
+// reportLogHandler /batchLog 客户端日志，内容为日志数组
+func reportLogHandler(c *gin.Context) {
+	body, ok := readTelemetryBody(c)
+	if !ok {
+		return
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(body, &items); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid JSON format", "detail": err.Error()})
+		return
+	}
+	events := telemetryEvents(c, TelemetryLog, body)
+	telemetry.Ingest(events)
+	c.JSON(http.StatusOK, gin.H{"data": fmt.Sprintf("%d has been created.", len(events))})
+}
+
+// reportRumHandler /rum 前端性能数据
+func reportRumHandler(c *gin.Context) {
+	body, ok := readTelemetryBody(c)
+	if !ok {
+		return
+	}
+	telemetry.Ingest(telemetryEvents(c, TelemetryRum, body))
+	c.String(http.StatusOK, "1\t1")
+}
+
+// adminPlayerTelemetry 客服查询玩家最近的客户端上报，默认只看错误
+func adminPlayerTelemetry(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > telemetryKeep {
+		limit = 100
+	}
+	level := c.DefaultQuery("level", "error")
+	if level == "all" {
+		level = ""
+	}
+	c.JSON(http.StatusOK, gin.H{"data": telemetry.Recent(c.Param("accountId"), level, c.Query("kind"), limit)})
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTelemetryEventsIdentity(t *testing.T) {
+	user := Account{UserId: 100001, Operator: "demo", Currency: MainCurrency()}
+	token := launch.IssueToken(user, 14054)
+	tests := []struct {
+		name        string
+		token       string
+		body        string
+		wantAccount string
+		wantClaimed string
+	}{
+		{"verified token", token, `{"message":"hi"}`, "100001&&demo", ""},
+		{"body cannot impersonate", "", `{"accountId":"100001&&demo"}`, "", "100001&&demo"},
+		{"body differs from token", token, `{"uid":"42&&demo"}`, "100001&&demo", "42&&demo"},
+		{"body matches token", token, `{"accountId":"100001&&demo"}`, "100001&&demo", ""},
+		{"forged token", "forged", `{"userId":7}`, "", "7"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("POST", "/batchLog", strings.NewReader(tt.body))
+			if tt.token != "" {
+				c.Request.Header.Set("x-token", tt.token)
+			}
+			events := telemetryEvents(c, "log", []byte(tt.body))
+			if len(events) != 1 {
+				t.Fatalf("events = %d, want 1", len(events))
+			}
+			if events[0].AccountId != tt.wantAccount || events[0].ClaimedId != tt.wantClaimed {
+				t.Errorf("account = %q claimed = %q, want %q %q", events[0].AccountId, events[0].ClaimedId, tt.wantAccount, tt.wantClaimed)
+			}
+		})
+	}
+}
+
+func TestRotatingFileRotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "client.jsonl")
+	f, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// 轮转目标都是非空目录，改名失败
+	for _, dir := range []string{path + ".1", path + ".2"} {
+		if err := os.MkdirAll(filepath.Join(dir, "x"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, line := range []string{"first line", "second line", "third line"} {
+		if err := f.WriteLine([]byte(line)); err != nil {
+			t.Fatalf("WriteLine(%q) = %v", line, err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "first line\nsecond line\nthird line\n"; string(data) != want {
+		t.Errorf("file = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 作废时已兑现下注的处理策略
+const (
+	VoidKeepCashOuts    = "keep"    // 已兑现的保持不变，只退还未兑现的下注
+	VoidReverseCashOuts = "reverse" // 收回兑现金额并退还下注，玩家回到本局开始前的余额
+)
+
+// DefaultVoidPolicy 运营未指定策略和重启自动作废时使用
+var DefaultVoidPolicy = VoidKeepCashOuts
+
+// VoidResult 作废一局的结果，金额折算为主币种
+type VoidResult struct {
+	RoomId         int    `json:"roomId"`
+	RoundId        int    `json:"roundId"`
+	Reason         string `json:"reason"`
+	Policy         string `json:"policy"`
+	RefundedBets   int    `json:"refundedBets"`
+	RefundedAmount Money  `json:"refundedAmount"`
+	ReversedBets   int    `json:"reversedBets"`
+	ReversedAmount Money  `json:"reversedAmount"`
+}
+
+// voidAdjustment 作废时一注下注的退款和收回金额
+func voidAdjustment(stake Money, cashOut Money, isFreeBet bool, hasCashOut bool, policy string) (refund Money, reversed Money) {
+	if !hasCashOut {
+		if isFreeBet {
+			return 0, 0
+		}
+		return stake, 0
+	}
+	if policy != VoidReverseCashOuts {
+		return 0, 0
+	}
+	if isFreeBet {
+		return 0, cashOut
+	}
+	return stake, cashOut
+}
+
+// ErrVoidIncomplete 作废时退款流水写入失败，房间已暂停，需用同一策略重试作废
+var ErrVoidIncomplete = errors.New("void incomplete")
+
+// VoidRound 作废进行中的一局：退还未兑现的下注，已兑现的按策略处理，本局不结算，
+// 历史中记为作废并通知客户端。每注的退款先写流水再入账；流水写入失败时停止，
+// 未处理的下注保持不变，暂停房间并返回 ErrVoidIncomplete，重试时跳过已退款的下注。
+// 调用方需持有 g.mutex
+func (g *AviatorGameContext) VoidRound(reason string, policy string) (VoidResult, error) {
+	if policy == "" {
+		policy = DefaultVoidPolicy
+	}
+	result := VoidResult{RoomId: g.RoomId, RoundId: g.RecordId, Reason: reason, Policy: policy}
+	if policy != VoidKeepCashOuts && policy != VoidReverseCashOuts {
+		return result, fmt.Errorf("unknown cash-out policy %q", policy)
+	}
+	if g.CurStage != EAviatorStageBet && g.CurStage != EAviatorStageCashOut {
+		return result, fmt.Errorf("room %d has no round in progress", g.RoomId)
+	}
+	if g.journal != nil && g.journal.closed {
+		return result, fmt.Errorf("room %d: %w", g.RoomId, ErrJournalClosed)
+	}
+	if g.voidPolicy != "" && policy != g.voidPolicy {
+		return result, fmt.Errorf("room %d: round is partially voided with policy %q", g.RoomId, g.voidPolicy)
+	}
+
+	for _, player := range g.players {
+		for _, bet := range player.BetList {
+			if bet.voided {
+				continue
+			}
+			refund, reversed := voidAdjustment(bet.BetValue, bet.CashOut, bet.isFreeBet, bet.hasCashOut, policy)
+			if refund != 0 || reversed != 0 {
+				entry := JournalEntry{
+					Type:      JournalAdjust,
+					AccountId: player.AccountId,
+					Currency:  player.Currency,
+					BetId:     bet.BetArea,
+					Delta:     refund - reversed,
+					Reason:    reason,
+					Policy:    policy,
+				}
+				if !g.Journal(entry, player) {
+					g.voidPolicy = policy
+					if !g.paused {
+						g.Pause()
+					}
+					return result, fmt.Errorf("room %d round %d: %w, room paused", g.RoomId, g.RecordId, ErrVoidIncomplete)
+				}
+			}
+			bet.voided = true
+			//免费下注券退回，保留兑现的券已使用
+			if bet.isFreeBet {
+				if !bet.hasCashOut || policy == VoidReverseCashOuts {
+					freeBets.Release(bet.freeBetId, g.freeBetKey(bet))
+					g.S2cActiveFreeBetsInfo(player)
+				} else {
+					freeBets.Consume(bet.freeBetId, g.freeBetKey(bet))
+				}
+			}
+		}
+	}
+
+	for _, player := range g.players {
+		var refund, reversed Money
+		for _, bet := range player.BetList {
+			betRefund, betReversed := voidAdjustment(bet.BetValue, bet.CashOut, bet.isFreeBet, bet.hasCashOut, policy)
+			refund += betRefund
+			reversed += betReversed
+			if betRefund > 0 {
+				result.RefundedBets++
+			}
+			if betReversed > 0 {
+				result.ReversedBets++
+			}
+		}
+		result.RefundedAmount += mainCurrencyAmount(refund, player.Currency)
+		result.ReversedAmount += mainCurrencyAmount(reversed, player.Currency)
+
+		ntf, _ := StructToMap(&RoundVoided{
+			Code:     200,
+			RoundId:  g.RecordId,
+			Reason:   reason,
+			Refund:   refund,
+			Reversed: reversed,
+		})
+		g.SendToClient(player, "roundVoided", ntf)
+	}
+
+	g.endTime = time.Now().UnixMilli()
+	record := g.RoundRecord()
+	record.Void = true
+	record.VoidReason = reason
+	g.history.Append(record)
+	//已写入历史，结束流水写入失败时重启后按已结束处理
+	g.Journal(JournalEntry{Type: JournalVoid, Reason: reason}, nil)
+
+	g.voidPolicy = ""
+	g.ClearBets()
+	g.UpdateStatus(EAviatorStageCashOutAward)
+	metricVoidRounds.Inc(strconv.Itoa(g.RoomId))
+
+	logGame.Warn("牌局作废", "room", g.RoomId, "round", result.RoundId, "reason", reason, "policy", policy,
+		"refundedBets", result.RefundedBets, "refundedAmount", result.RefundedAmount,
+		"reversedBets", result.ReversedBets, "reversedAmount", result.ReversedAmount, "currency", MainCurrency())
+	return result, nil
+}
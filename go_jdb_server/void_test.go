@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// newVoidTestRoom 房间处于飞行阶段，流水和历史写入临时目录
+func newVoidTestRoom(t *testing.T) *AviatorGameContext {
+	t.Helper()
+	dir, w, f := DataDir, wallets, freeBets
+	t.Cleanup(func() { DataDir, wallets, freeBets = dir, w, f })
+	DataDir = t.TempDir()
+	wallets = NewWalletStore("")
+	freeBets = NewFreeBetLedger("")
+
+	g := NewGameContext()
+	g.RoomId = 1
+	history, err := OpenRoundHistory(g.RoomId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal, _, err := OpenJournal(g.RoomId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		history.Close()
+		if !journal.closed {
+			journal.Close()
+		}
+	})
+	g.history = history
+	g.journal = journal
+	g.NewGameInit()
+	g.CurStage = EAviatorStageCashOut
+	return g
+}
+
+func voidTestPlayer(accountId string, bets ...*PlayerBetSt) *AviatorPlayerInfo {
+	return &AviatorPlayerInfo{AccountId: accountId, Currency: MainCurrency(), IsOffline: true, BetList: bets}
+}
+
+func TestVoidRound(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       string
+		bet          PlayerBetSt
+		wantDelta    Money
+		wantRefunded int
+		wantReversed int
+	}{
+		{"open bet refunded", VoidKeepCashOuts, PlayerBetSt{BetValue: MoneyFromInt(10)}, MoneyFromInt(10), 1, 0},
+		{"cash out kept", VoidKeepCashOuts, PlayerBetSt{BetValue: MoneyFromInt(10), CashOut: MoneyFromInt(25), hasCashOut: true}, 0, 0, 0},
+		{"cash out reversed", VoidReverseCashOuts, PlayerBetSt{BetValue: MoneyFromInt(10), CashOut: MoneyFromInt(25), hasCashOut: true}, MoneyFromInt(-15), 1, 1},
+		{"open free bet", VoidKeepCashOuts, PlayerBetSt{BetValue: MoneyFromInt(10), isFreeBet: true}, 0, 0, 0},
+		{"free bet win reversed", VoidReverseCashOuts, PlayerBetSt{BetValue: MoneyFromInt(10), CashOut: MoneyFromInt(15), hasCashOut: true, isFreeBet: true}, MoneyFromInt(-15), 0, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := newVoidTestRoom(t)
+			bet := tt.bet
+			bet.BetArea = 1
+			player := voidTestPlayer("1&&demo", &bet)
+			g.players["p1"] = player
+			before := wallets.Balance("1&&demo")
+
+			result, err := g.VoidRound("test", tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := wallets.Balance("1&&demo") - before; got != tt.wantDelta {
+				t.Errorf("balance delta = %v, want %v", got, tt.wantDelta)
+			}
+			if result.RefundedBets != tt.wantRefunded || result.ReversedBets != tt.wantReversed {
+				t.Errorf("refunded %d reversed %d, want %d %d", result.RefundedBets, result.ReversedBets, tt.wantRefunded, tt.wantReversed)
+			}
+			record, ok := g.history.Last()
+			if !ok || !record.Void || record.RoundId != g.RecordId {
+				t.Errorf("history last = %+v, want void round %d", record, g.RecordId)
+			}
+			if len(player.BetList) != 0 || g.CurStage != EAviatorStageCashOutAward {
+				t.Errorf("bets = %d stage = %d after void", len(player.BetList), g.CurStage)
+			}
+		})
+	}
+}
+
+func TestVoidRoundJournalFailure(t *testing.T) {
+	g := newVoidTestRoom(t)
+	g.players["p1"] = voidTestPlayer("1&&demo", &PlayerBetSt{BetArea: 1, BetValue: MoneyFromInt(10)})
+	g.players["p2"] = voidTestPlayer("2&&demo", &PlayerBetSt{BetArea: 1, BetValue: MoneyFromInt(20)})
+	before1, before2 := wallets.Balance("1&&demo"), wallets.Balance("2&&demo")
+
+	// 流水文件写入失败
+	file := g.journal.file
+	file.Close()
+	_, err := g.VoidRound("test", VoidKeepCashOuts)
+	if !errors.Is(err, ErrVoidIncomplete) {
+		t.Fatalf("err = %v, want ErrVoidIncomplete", err)
+	}
+	if wallets.Balance("1&&demo") != before1 || wallets.Balance("2&&demo") != before2 {
+		t.Error("balances changed without a journal entry")
+	}
+	if len(g.players["p1"].BetList) != 1 || len(g.players["p2"].BetList) != 1 {
+		t.Error("bets removed after a failed void")
+	}
+	if _, ok := g.history.Last(); ok {
+		t.Error("failed void appended to the history")
+	}
+	if !g.paused || g.CurStage != EAviatorStageCashOut {
+		t.Errorf("paused = %v stage = %d, want paused in flight", g.paused, g.CurStage)
+	}
+	if err := g.Resume(); err == nil {
+		t.Error("Resume() allowed a partially voided round")
+	}
+	if _, err := g.VoidRound("test", VoidReverseCashOuts); err == nil {
+		t.Error("retry with a different policy allowed")
+	}
+
+	// 模拟一注已退款后流水恢复，重试只退还剩下的
+	g.players["p1"].BetList[0].voided = true
+	wallets.Apply("", 0, "1&&demo", MoneyFromInt(10))
+	journal, _, err := OpenJournal(g.RoomId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.journal = journal
+	if _, err := g.VoidRound("test", VoidKeepCashOuts); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+	if got, want := wallets.Balance("1&&demo"), before1+MoneyFromInt(10); got != want {
+		t.Errorf("p1 balance = %v, want %v", got, want)
+	}
+	if got, want := wallets.Balance("2&&demo"), before2+MoneyFromInt(20); got != want {
+		t.Errorf("p2 balance = %v, want %v", got, want)
+	}
+	if err := g.Resume(); err != nil {
+		t.Errorf("Resume() after the void = %v", err)
+	}
+	g.StopTimer()
+}
+
+func TestVoidRoundAfterClose(t *testing.T) {
+	g := newVoidTestRoom(t)
+	g.players["p1"] = voidTestPlayer("1&&demo", &PlayerBetSt{BetArea: 1, BetValue: MoneyFromInt(10)})
+	g.journal.Close()
+	if _, err := g.VoidRound("test", ""); !errors.Is(err, ErrJournalClosed) {
+		t.Fatalf("err = %v, want ErrJournalClosed", err)
+	}
+	if len(g.players["p1"].BetList) != 1 {
+		t.Error("bets removed after a rejected void")
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 试玩账号首次登录的余额
+var DemoStartBalance = MoneyFromInt(10000)
+
+// ErrWalletCurrency 登录币种与钱包币种不一致
+var ErrWalletCurrency = errors.New("currency does not match the wallet")
+
+// ErrInsufficientFunds 可用余额不足以扣款
+var ErrInsufficientFunds = errors.New("insufficient funds")
+
+// Wallet 账号余额，所有房间共用；一个钱包只有一个币种，在首次登录时确定
+type Wallet struct {
+	Currency  string           `json:"currency,omitempty"`
+	Balance   Money            `json:"balance"`
+	UpdatedAt int64            `json:"updatedAt"`      // 毫秒时间戳
+	Seqs      map[string]int64 `json:"seqs,omitempty"` // 每份流水已入账的最后一条流水序号，键为 Journal.key
+	reserved  Money            // 已占用、等待流水落盘后扣除的金额，只保存在内存中
+}
+
+// WalletStore 账号余额的持久化存储。开户和绑定币种立即写盘；余额变动先写流水，
+// 只在内存中标记，清空流水前由 Sync 批量写盘，崩溃后按流水重放，重启后余额不丢失
+type WalletStore struct {
+	mutex   sync.Mutex
+	path    string
+	wallets map[string]*Wallet
+	dirty   bool // 有余额变动还没有写盘
+}
+
+var wallets = NewWalletStore("")
+
+// NewWalletStore path 为空时只保存在内存中
+func NewWalletStore(path string) *WalletStore {
+	return &WalletStore{
+		path:    path,
+		wallets: make(map[string]*Wallet),
+	}
+}
+
+func OpenWalletStore() (*WalletStore, error) {
+	if err := os.MkdirAll(DataDir, 0o755); err != nil {
+		return nil, err
+	}
+	s := NewWalletStore(filepath.Join(DataDir, "wallets.json"))
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.wallets); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", s.path, err)
+	}
+	return s, nil
+}
+
+// Balance 账号余额，新账号按试玩余额开户
+func (s *WalletStore) Balance(accountId string) Money {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if wallet, ok := s.wallets[accountId]; ok {
+		return wallet.Balance
+	}
+	s.wallets[accountId] = &Wallet{Balance: DemoStartBalance, UpdatedAt: time.Now().UnixMilli()}
+	s.save()
+	return DemoStartBalance
+}
+
+// Open 登录时绑定钱包币种：新账号按试玩余额开户，旧钱包没有币种时使用本次登录的币种；
+// 与钱包币种不一致时返回 ErrWalletCurrency
+func (s *WalletStore) Open(accountId string, currency string) (Money, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	wallet, ok := s.wallets[accountId]
+	if !ok {
+		wallet = &Wallet{Currency: currency, Balance: DemoStartBalance, UpdatedAt: time.Now().UnixMilli()}
+		s.wallets[accountId] = wallet
+		s.save()
+		return wallet.Balance, nil
+	}
+	if wallet.Currency == "" {
+		wallet.Currency = currency
+		s.save()
+	}
+	if wallet.Currency != currency {
+		return 0, fmt.Errorf("%w: wallet %s, login %s", ErrWalletCurrency, wallet.Currency, currency)
+	}
+	return wallet.Balance, nil
+}
+
+// Currency 钱包的币种，没有钱包时为空
+func (s *WalletStore) Currency(accountId string) string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if wallet, ok := s.wallets[accountId]; ok {
+		return wallet.Currency
+	}
+	return ""
+}
+
+// Reserve 占用 amount 的余额用于下注或发起红包雨，可用余额（余额减去已占用）不足时返回 ErrInsufficientFunds。
+// 钱包由所有房间共用，先占用再写流水，同一账号在多个房间同时扣款也不会扣成负数；
+// 流水落盘后用 Debit 扣除，写入失败时用 Unreserve 归还
+func (s *WalletStore) Reserve(accountId string, amount Money) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	wallet, ok := s.wallets[accountId]
+	if !ok {
+		wallet = &Wallet{Balance: DemoStartBalance}
+		s.wallets[accountId] = wallet
+	}
+	if wallet.Balance-wallet.reserved < amount {
+		return fmt.Errorf("%w: balance %s, amount %s", ErrInsufficientFunds, wallet.Balance-wallet.reserved, amount)
+	}
+	wallet.reserved += amount
+	return nil
+}
+
+// Unreserve 归还 Reserve 占用的余额
+func (s *WalletStore) Unreserve(accountId string, amount Money) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if wallet, ok := s.wallets[accountId]; ok {
+		wallet.reserved -= amount
+	}
+}
+
+// Debit 按流水扣除 Reserve 占用的金额，返回新余额；与 Apply 一样忽略已入账的序号
+func (s *WalletStore) Debit(key string, seq int64, accountId string, amount Money) Money {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	wallet, ok := s.wallets[accountId]
+	if !ok {
+		wallet = &Wallet{Balance: DemoStartBalance}
+		s.wallets[accountId] = wallet
+	}
+	wallet.reserved -= amount
+	return s.apply(wallet, key, seq, -amount)
+}
+
+// Apply 按流水入账，序号不大于已入账序号的流水说明已经入过账，直接忽略；
+// seq 为0表示没有流水，直接入账
+func (s *WalletStore) Apply(key string, seq int64, accountId string, delta Money) Money {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	wallet, ok := s.wallets[accountId]
+	if !ok {
+		wallet = &Wallet{Balance: DemoStartBalance}
+		s.wallets[accountId] = wallet
+	}
+	return s.apply(wallet, key, seq, delta)
+}
+
+func (s *WalletStore) apply(wallet *Wallet, key string, seq int64, delta Money) Money {
+	if seq > 0 {
+		if seq <= wallet.Seqs[key] {
+			return wallet.Balance
+		}
+		if wallet.Seqs == nil {
+			wallet.Seqs = make(map[string]int64)
+		}
+		wallet.Seqs[key] = seq
+	}
+	wallet.Balance += delta
+	wallet.UpdatedAt = time.Now().UnixMilli()
+	s.dirty = true
+	return wallet.Balance
+}
+
+// LastSeq 流水已入账的最大序号
+func (s *WalletStore) LastSeq(key string) int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	last := int64(0)
+	for _, wallet := range s.wallets {
+		last = max(last, wallet.Seqs[key])
+	}
+	return last
+}
+
+// save 写临时文件后改名，进程崩溃时不会留下半个文件；写盘失败只打印日志
+func (s *WalletStore) save() error {
+	if s.path == "" {
+		s.dirty = false
+		return nil
+	}
+	data, err := json.Marshal(s.wallets)
+	if err != nil {
+		logStore.Error("余额序列化失败", "err", err)
+		return err
+	}
+	if err := writeFileSync(s.path, data); err != nil {
+		logStore.Error("余额写入失败", "path", s.path, "err", err)
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// Sync 把余额变动写盘，没有变动时不写；清空流水前调用，确保流水中的余额变动和已入账序号都已落盘
+func (s *WalletStore) Sync() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.dirty {
+		return nil
+	}
+	return s.save()
+}
+
+// writeFileSync 写临时文件并落盘后改名，再同步目录，改名后断电也不会丢失
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
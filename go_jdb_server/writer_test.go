@@ -0,0 +1,92 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newWriterTestConn 服务端连接和一个从不读取的客户端
+func newWriterTestConn(t *testing.T) (*websocket.Conn, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server := <-conns
+	t.Cleanup(func() { server.Close() })
+	return server, client
+}
+
+func TestWritePacketDropsSlowClient(t *testing.T) {
+	server, _ := newWriterTestConn(t)
+	StartWriter(server)
+	defer ReleaseConn(server)
+
+	packet := make([]byte, 1<<20)
+	start := time.Now()
+	var err error
+	for i := 0; i < wsSendQueueSize*4 && err == nil; i++ {
+		err = WritePacket(server, packet)
+	}
+	if !errors.Is(err, ErrSendQueueFull) && !errors.Is(err, ErrConnClosed) {
+		t.Fatalf("err = %v, want the slow client to be dropped", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("writers blocked for %v", elapsed)
+	}
+}
+
+func TestWritePacketAndClose(t *testing.T) {
+	server, client := newWriterTestConn(t)
+	StartWriter(server)
+	defer ReleaseConn(server)
+
+	if err := WritePacket(server, []byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "bye")
+	WritePacketAndClose(server, []byte("last"), closeMsg)
+
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []string{"first", "last"} {
+		_, data, err := client.ReadMessage()
+		if err != nil || string(data) != want {
+			t.Fatalf("ReadMessage() = %q, %v, want %q", data, err, want)
+		}
+	}
+	_, _, err := client.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("err = %v, want a going away close frame", err)
+	}
+	if err := WritePacket(server, []byte("late")); err == nil {
+		// 发送协程可能还没退出，稍后再试
+		time.Sleep(100 * time.Millisecond)
+		if err := WritePacket(server, []byte("late")); !errors.Is(err, ErrConnClosed) {
+			t.Errorf("write after close = %v, want ErrConnClosed", err)
+		}
+	}
+}
+
+func TestWritePacketUnknownConn(t *testing.T) {
+	server, _ := newWriterTestConn(t)
+	if err := WritePacket(server, []byte("x")); !errors.Is(err, ErrConnClosed) {
+		t.Errorf("err = %v, want ErrConnClosed", err)
+	}
+}